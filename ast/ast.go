@@ -0,0 +1,333 @@
+// Package ast parses GraphQL executable documents and schema definition language, http://spec.graphql.org/draft/#sec-Language
+package ast
+
+import (
+	"strings"
+)
+
+// Document keeps definitions by kind in their source order
+type Document struct {
+	Operations []*OperationDefinition
+	Fragments  []*FragmentDefinition
+
+	Schemas    []*SchemaDefinition
+	Types      []*TypeDefinition
+	Directives []*DirectiveDefinition
+}
+
+type OperationType string
+
+const (
+	Query        OperationType = "query"
+	Mutation     OperationType = "mutation"
+	Subscription OperationType = "subscription"
+)
+
+type OperationDefinition struct {
+	Operation           OperationType
+	Name                string
+	VariableDefinitions []*VariableDefinition
+	Directives          []*Directive
+	SelectionSet        SelectionSet
+	Loc                 Location
+}
+
+type VariableDefinition struct {
+	Variable     string
+	Type         *Type
+	DefaultValue *Value
+	Directives   []*Directive
+	Loc          Location
+}
+
+type FragmentDefinition struct {
+	Name          string
+	TypeCondition string
+	Directives    []*Directive
+	SelectionSet  SelectionSet
+	Loc           Location
+}
+
+// Selection is one of *Field, *FragmentSpread and *InlineFragment
+type Selection interface {
+	Location() Location
+}
+
+type SelectionSet []Selection
+
+type Field struct {
+	Alias        string
+	Name         string
+	Arguments    []*Argument
+	Directives   []*Directive
+	SelectionSet SelectionSet
+	Loc          Location
+}
+
+type FragmentSpread struct {
+	Name       string
+	Directives []*Directive
+	Loc        Location
+}
+
+// InlineFragment has empty TypeCondition if omitted
+type InlineFragment struct {
+	TypeCondition string
+	Directives    []*Directive
+	SelectionSet  SelectionSet
+	Loc           Location
+}
+
+type Argument struct {
+	Name  string
+	Value *Value
+	Loc   Location
+}
+
+type Directive struct {
+	Name      string
+	Arguments []*Argument
+	Loc       Location
+}
+
+// Type is a named type if Elem is nil, or a list of Elem
+type Type struct {
+	NamedType string
+	Elem      *Type
+	NonNull   bool
+	Loc       Location
+}
+
+type ValueKind int
+
+const (
+	Variable ValueKind = iota
+	IntValue
+	FloatValue
+	StringValue
+	BlockValue
+	BooleanValue
+	NullValue
+	EnumValue
+	ListValue
+	ObjectValue
+)
+
+// Value keeps the name of variable and enum, the literal of number and boolean, or the content of string in Raw
+type Value struct {
+	Kind   ValueKind
+	Raw    string
+	List   []*Value
+	Fields []*ObjectField
+	Loc    Location
+}
+
+type ObjectField struct {
+	Name  string
+	Value *Value
+	Loc   Location
+}
+
+// SchemaDefinition is `schema` or `extend schema`
+type SchemaDefinition struct {
+	Description    string
+	Directives     []*Directive
+	OperationTypes []*OperationTypeDefinition
+	Extend         bool
+	Loc            Location
+}
+
+type OperationTypeDefinition struct {
+	Operation OperationType
+	Type      string
+	Loc       Location
+}
+
+// DefinitionKind is the same as the kind of introspection
+type DefinitionKind string
+
+const (
+	Scalar      DefinitionKind = "SCALAR"
+	Object      DefinitionKind = "OBJECT"
+	Interface   DefinitionKind = "INTERFACE"
+	Union       DefinitionKind = "UNION"
+	Enum        DefinitionKind = "ENUM"
+	InputObject DefinitionKind = "INPUT_OBJECT"
+)
+
+// TypeDefinition is a type definition or extension, fields are set according to Kind
+type TypeDefinition struct {
+	Kind        DefinitionKind
+	Description string
+	Name        string
+	Interfaces  []string
+	Directives  []*Directive
+	Fields      []*FieldDefinition
+	Types       []string
+	EnumValues  []*EnumValueDefinition
+	InputFields []*InputValueDefinition
+	Extend      bool
+	Loc         Location
+}
+
+type FieldDefinition struct {
+	Description string
+	Name        string
+	Arguments   []*InputValueDefinition
+	Type        *Type
+	Directives  []*Directive
+	Loc         Location
+}
+
+type InputValueDefinition struct {
+	Description  string
+	Name         string
+	Type         *Type
+	DefaultValue *Value
+	Directives   []*Directive
+	Loc          Location
+}
+
+type EnumValueDefinition struct {
+	Description string
+	Name        string
+	Directives  []*Directive
+	Loc         Location
+}
+
+type DirectiveDefinition struct {
+	Description string
+	Name        string
+	Arguments   []*InputValueDefinition
+	Repeatable  bool
+	Locations   []string
+	Loc         Location
+}
+
+func (f *Field) Location() Location          { return f.Loc }
+func (f *FragmentSpread) Location() Location { return f.Loc }
+func (f *InlineFragment) Location() Location { return f.Loc }
+
+// ResponseKey is the alias, or the name if no alias
+func (f *Field) ResponseKey() string {
+	if f.Alias != "" {
+		return f.Alias
+	}
+	return f.Name
+}
+
+// Operation returns the operation named name, or the only operation if name is empty, otherwise nil
+func (d *Document) Operation(name string) *OperationDefinition {
+	if name == "" {
+		if len(d.Operations) == 1 {
+			return d.Operations[0]
+		}
+		return nil
+	}
+	for _, op := range d.Operations {
+		if op.Name == name {
+			return op
+		}
+	}
+	return nil
+}
+
+// Fragment returns the fragment named name, or nil if not found
+func (d *Document) Fragment(name string) *FragmentDefinition {
+	for _, fragment := range d.Fragments {
+		if fragment.Name == name {
+			return fragment
+		}
+	}
+	return nil
+}
+
+// Argument returns the argument named name, or nil if not found
+func (d *Directive) Argument(name string) *Argument {
+	return findArgument(d.Arguments, name)
+}
+
+// Argument returns the argument named name, or nil if not found
+func (f *Field) Argument(name string) *Argument {
+	return findArgument(f.Arguments, name)
+}
+
+func findArgument(args []*Argument, name string) *Argument {
+	for _, arg := range args {
+		if arg.Name == name {
+			return arg
+		}
+	}
+	return nil
+}
+
+// String returns type in GraphQL syntax like [String!]!
+func (t *Type) String() string {
+	s := t.NamedType
+	if t.Elem != nil {
+		s = "[" + t.Elem.String() + "]"
+	}
+	if t.NonNull {
+		s += "!"
+	}
+	return s
+}
+
+// String returns value in GraphQL syntax
+func (v *Value) String() string {
+	switch v.Kind {
+	case Variable:
+		return "$" + v.Raw
+	case StringValue, BlockValue:
+		return quote(v.Raw)
+	case ListValue:
+		items := make([]string, len(v.List))
+		for i, item := range v.List {
+			items[i] = item.String()
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	case ObjectValue:
+		fields := make([]string, len(v.Fields))
+		for i, field := range v.Fields {
+			fields[i] = field.Name + ": " + field.Value.String()
+		}
+		return "{" + strings.Join(fields, ", ") + "}"
+	case NullValue:
+		return "null"
+	}
+	return v.Raw
+}
+
+// quote escapes s as GraphQL string value
+func quote(s string) string {
+	b := &strings.Builder{}
+	b.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\b':
+			b.WriteString(`\b`)
+		case '\f':
+			b.WriteString(`\f`)
+		default:
+			if r < 0x20 {
+				b.WriteString(`\u00`)
+				b.WriteByte("0123456789abcdef"[r>>4])
+				b.WriteByte("0123456789abcdef"[r&0xF])
+				continue
+			}
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
@@ -0,0 +1,485 @@
+package ast
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+type TokenKind int
+
+const (
+	TokenEOF TokenKind = iota
+	TokenBang
+	TokenDollar
+	TokenAmp
+	TokenParenL
+	TokenParenR
+	TokenSpread
+	TokenColon
+	TokenEquals
+	TokenAt
+	TokenBracketL
+	TokenBracketR
+	TokenBraceL
+	TokenPipe
+	TokenBraceR
+	TokenName
+	TokenInt
+	TokenFloat
+	TokenString
+	TokenBlockString
+)
+
+var tokenKindNames = [...]string{
+	TokenEOF:         "<EOF>",
+	TokenBang:        "!",
+	TokenDollar:      "$",
+	TokenAmp:         "&",
+	TokenParenL:      "(",
+	TokenParenR:      ")",
+	TokenSpread:      "...",
+	TokenColon:       ":",
+	TokenEquals:      "=",
+	TokenAt:          "@",
+	TokenBracketL:    "[",
+	TokenBracketR:    "]",
+	TokenBraceL:      "{",
+	TokenPipe:        "|",
+	TokenBraceR:      "}",
+	TokenName:        "Name",
+	TokenInt:         "Int",
+	TokenFloat:       "Float",
+	TokenString:      "String",
+	TokenBlockString: "BlockString",
+}
+
+func (k TokenKind) String() string {
+	if int(k) < len(tokenKindNames) {
+		return tokenKindNames[k]
+	}
+	return "TokenKind(" + strconv.Itoa(int(k)) + ")"
+}
+
+// Token is a lexical token, Value is the name, the number or the string value without quotes and escapes
+type Token struct {
+	Kind  TokenKind
+	Value string
+	Loc   Location
+}
+
+func (t Token) String() string {
+	switch t.Kind {
+	case TokenName, TokenInt, TokenFloat, TokenString, TokenBlockString:
+		return fmt.Sprintf("%s %q", t.Kind, t.Value)
+	}
+	return t.Kind.String()
+}
+
+// Location is 1-based like GraphQLErrorLocation, columns are counted by characters
+type Location struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// SyntaxError is the error of lexing or parsing with the location in source
+type SyntaxError struct {
+	Message string
+	Loc     Location
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("Syntax Error: %s (%d:%d)", e.Message, e.Loc.Line, e.Loc.Column)
+}
+
+type lexer struct {
+	source    string
+	pos       int
+	line      int
+	lineStart int
+	// colPos and col cache the last counted offset of current line and its 0-based column,
+	// so counting runes stays linear on long lines
+	colPos int
+	col    int
+}
+
+// Lex splits source into tokens ending with TokenEOF, ignored tokens like comments and commas are skipped
+func Lex(source string) ([]Token, error) {
+	l := &lexer{source: source, line: 1}
+	if strings.HasPrefix(source, "\uFEFF") {
+		l.pos = len("\uFEFF")
+		l.lineStart = l.pos
+		l.colPos = l.pos
+	}
+	var tokens []Token
+	for {
+		token, err := l.next()
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+		if token.Kind == TokenEOF {
+			return tokens, nil
+		}
+	}
+}
+
+// location returns the location of byte offset pos in current line
+func (l *lexer) location(pos int) Location {
+	if pos < l.colPos {
+		l.colPos = l.lineStart
+		l.col = 0
+	}
+	l.col += utf8.RuneCountInString(l.source[l.colPos:pos])
+	l.colPos = pos
+	return Location{
+		Line:   l.line,
+		Column: l.col + 1,
+	}
+}
+
+func (l *lexer) errorf(pos int, format string, args ...interface{}) error {
+	return &SyntaxError{
+		Message: fmt.Sprintf(format, args...),
+		Loc:     l.location(pos),
+	}
+}
+
+// newLine is called with pos after a line terminator
+func (l *lexer) newLine(pos int) {
+	l.line++
+	l.lineStart = pos
+	l.colPos = pos
+	l.col = 0
+}
+
+func (l *lexer) next() (Token, error) {
+	l.skipIgnored()
+	start := l.pos
+	token := Token{Loc: l.location(start)}
+	if l.pos >= len(l.source) {
+		token.Kind = TokenEOF
+		return token, nil
+	}
+	ch := l.source[l.pos]
+	switch ch {
+	case '!':
+		token.Kind = TokenBang
+	case '$':
+		token.Kind = TokenDollar
+	case '&':
+		token.Kind = TokenAmp
+	case '(':
+		token.Kind = TokenParenL
+	case ')':
+		token.Kind = TokenParenR
+	case ':':
+		token.Kind = TokenColon
+	case '=':
+		token.Kind = TokenEquals
+	case '@':
+		token.Kind = TokenAt
+	case '[':
+		token.Kind = TokenBracketL
+	case ']':
+		token.Kind = TokenBracketR
+	case '{':
+		token.Kind = TokenBraceL
+	case '|':
+		token.Kind = TokenPipe
+	case '}':
+		token.Kind = TokenBraceR
+	case '.':
+		if !strings.HasPrefix(l.source[l.pos:], "...") {
+			return token, l.errorf(start, "Unexpected character: %q", ch)
+		}
+		token.Kind = TokenSpread
+		l.pos += 3
+		return token, nil
+	case '"':
+		var err error
+		if strings.HasPrefix(l.source[l.pos:], `"""`) {
+			token.Kind = TokenBlockString
+			token.Value, err = l.readBlockString()
+		} else {
+			token.Kind = TokenString
+			token.Value, err = l.readString()
+		}
+		return token, err
+	default:
+		switch {
+		case isNameStart(ch):
+			token.Kind = TokenName
+			for l.pos++; l.pos < len(l.source) && isNameContinue(l.source[l.pos]); l.pos++ {
+			}
+			token.Value = l.source[start:l.pos]
+			return token, nil
+		case ch == '-' || isDigit(ch):
+			var err error
+			token.Kind, err = l.readNumber()
+			token.Value = l.source[start:l.pos]
+			return token, err
+		}
+		r, _ := utf8.DecodeRuneInString(l.source[l.pos:])
+		return token, l.errorf(start, "Unexpected character: %q", r)
+	}
+	l.pos++
+	return token, nil
+}
+
+// skipIgnored skips white spaces, line terminators, commas and comments
+func (l *lexer) skipIgnored() {
+	for l.pos < len(l.source) {
+		switch l.source[l.pos] {
+		case ' ', '\t', ',':
+			l.pos++
+		case '\n':
+			l.pos++
+			l.newLine(l.pos)
+		case '\r':
+			l.pos++
+			if l.pos < len(l.source) && l.source[l.pos] == '\n' {
+				l.pos++
+			}
+			l.newLine(l.pos)
+		case '#':
+			for l.pos < len(l.source) && l.source[l.pos] != '\n' && l.source[l.pos] != '\r' {
+				l.pos++
+			}
+		default:
+			if strings.HasPrefix(l.source[l.pos:], "\uFEFF") {
+				l.pos += len("\uFEFF")
+				continue
+			}
+			return
+		}
+	}
+}
+
+// readNumber reads IntValue or FloatValue
+func (l *lexer) readNumber() (TokenKind, error) {
+	kind := TokenInt
+	if l.source[l.pos] == '-' {
+		l.pos++
+	}
+	if l.pos < len(l.source) && l.source[l.pos] == '0' {
+		l.pos++
+		if l.pos < len(l.source) && isDigit(l.source[l.pos]) {
+			return kind, l.errorf(l.pos, "Invalid number, unexpected digit after 0: %q", l.source[l.pos])
+		}
+	} else if err := l.readDigits(); err != nil {
+		return kind, err
+	}
+	if l.pos < len(l.source) && l.source[l.pos] == '.' {
+		kind = TokenFloat
+		l.pos++
+		if err := l.readDigits(); err != nil {
+			return kind, err
+		}
+	}
+	if l.pos < len(l.source) && (l.source[l.pos] == 'e' || l.source[l.pos] == 'E') {
+		kind = TokenFloat
+		l.pos++
+		if l.pos < len(l.source) && (l.source[l.pos] == '+' || l.source[l.pos] == '-') {
+			l.pos++
+		}
+		if err := l.readDigits(); err != nil {
+			return kind, err
+		}
+	}
+	if l.pos < len(l.source) && (l.source[l.pos] == '.' || isNameStart(l.source[l.pos])) {
+		return kind, l.errorf(l.pos, "Invalid number, expected digit but got: %q", l.source[l.pos])
+	}
+	return kind, nil
+}
+
+func (l *lexer) readDigits() error {
+	if l.pos >= len(l.source) {
+		return l.errorf(l.pos, "Invalid number, expected digit but got: <EOF>")
+	}
+	if !isDigit(l.source[l.pos]) {
+		r, _ := utf8.DecodeRuneInString(l.source[l.pos:])
+		return l.errorf(l.pos, "Invalid number, expected digit but got: %q", r)
+	}
+	for l.pos < len(l.source) && isDigit(l.source[l.pos]) {
+		l.pos++
+	}
+	return nil
+}
+
+// readString reads a single line string with escapes
+func (l *lexer) readString() (string, error) {
+	start := l.pos
+	l.pos++
+	value := &strings.Builder{}
+	for l.pos < len(l.source) {
+		r, size := utf8.DecodeRuneInString(l.source[l.pos:])
+		switch {
+		case r == '"':
+			l.pos++
+			return value.String(), nil
+		case r == '\n' || r == '\r':
+			return "", l.errorf(start, "Unterminated string")
+		case r == '\\':
+			escaped, err := l.readEscape()
+			if err != nil {
+				return "", err
+			}
+			value.WriteRune(escaped)
+			continue
+		case r < 0x20 && r != '\t':
+			return "", l.errorf(l.pos, "Invalid character within String: %q", r)
+		}
+		value.WriteRune(r)
+		l.pos += size
+	}
+	return "", l.errorf(start, "Unterminated string")
+}
+
+// readEscape reads an escape sequence at pos, including \u{...} and surrogate pairs
+func (l *lexer) readEscape() (rune, error) {
+	start := l.pos
+	if l.pos+1 >= len(l.source) {
+		return 0, l.errorf(start, "Unterminated string")
+	}
+	l.pos += 2
+	switch l.source[l.pos-1] {
+	case '"':
+		return '"', nil
+	case '\\':
+		return '\\', nil
+	case '/':
+		return '/', nil
+	case 'b':
+		return '\b', nil
+	case 'f':
+		return '\f', nil
+	case 'n':
+		return '\n', nil
+	case 'r':
+		return '\r', nil
+	case 't':
+		return '\t', nil
+	case 'u':
+		r, ok := l.readUnicode()
+		if !ok {
+			return 0, l.errorf(start, "Invalid Unicode escape sequence: %q", l.source[start:l.pos])
+		}
+		if 0xD800 <= r && r <= 0xDBFF && strings.HasPrefix(l.source[l.pos:], `\u`) {
+			pos := l.pos
+			l.pos += 2
+			if trail, ok := l.readUnicode(); ok && 0xDC00 <= trail && trail <= 0xDFFF {
+				return (r-0xD800)<<10 + (trail - 0xDC00) + 0x10000, nil
+			}
+			l.pos = pos
+		}
+		if 0xD800 <= r && r <= 0xDFFF || r > utf8.MaxRune {
+			return 0, l.errorf(start, "Invalid Unicode escape sequence: %q", l.source[start:l.pos])
+		}
+		return r, nil
+	}
+	return 0, l.errorf(start, "Invalid character escape sequence: %q", l.source[start:l.pos])
+}
+
+// readUnicode reads XXXX or {X...} after \u
+func (l *lexer) readUnicode() (rune, bool) {
+	if strings.HasPrefix(l.source[l.pos:], "{") {
+		end := strings.IndexByte(l.source[l.pos:], '}')
+		if end < 2 || end > 9 {
+			return 0, false
+		}
+		v, err := strconv.ParseUint(l.source[l.pos+1:l.pos+end], 16, 32)
+		l.pos += end + 1
+		return rune(v), err == nil
+	}
+	if l.pos+4 > len(l.source) {
+		return 0, false
+	}
+	v, err := strconv.ParseUint(l.source[l.pos:l.pos+4], 16, 32)
+	if err != nil {
+		return 0, false
+	}
+	l.pos += 4
+	return rune(v), true
+}
+
+// readBlockString reads a block string, its value is dedented by BlockStringValue
+func (l *lexer) readBlockString() (string, error) {
+	start := l.pos
+	startLoc := l.location(start)
+	l.pos += 3
+	raw := &strings.Builder{}
+	for l.pos < len(l.source) {
+		rest := l.source[l.pos:]
+		switch {
+		case strings.HasPrefix(rest, `"""`):
+			l.pos += 3
+			return BlockStringValue(raw.String()), nil
+		case strings.HasPrefix(rest, `\"""`):
+			raw.WriteString(`"""`)
+			l.pos += 4
+			continue
+		case rest[0] == '\n':
+			raw.WriteByte('\n')
+			l.pos++
+			l.newLine(l.pos)
+			continue
+		case rest[0] == '\r':
+			raw.WriteByte('\n')
+			l.pos++
+			if l.pos < len(l.source) && l.source[l.pos] == '\n' {
+				l.pos++
+			}
+			l.newLine(l.pos)
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(rest)
+		if r < 0x20 && r != '\t' {
+			return "", l.errorf(l.pos, "Invalid character within String: %q", r)
+		}
+		raw.WriteString(rest[:size])
+		l.pos += size
+	}
+	return "", &SyntaxError{Message: "Unterminated string", Loc: startLoc}
+}
+
+// BlockStringValue removes the common indentation and the leading and trailing blank lines of raw block string
+func BlockStringValue(raw string) string {
+	lines := strings.Split(raw, "\n")
+	commonIndent := -1
+	for _, line := range lines[1:] {
+		indent := len(line) - len(strings.TrimLeft(line, " \t"))
+		if indent < len(line) && (commonIndent < 0 || indent < commonIndent) {
+			commonIndent = indent
+		}
+	}
+	if commonIndent > 0 {
+		for i := 1; i < len(lines); i++ {
+			if len(lines[i]) >= commonIndent {
+				lines[i] = lines[i][commonIndent:]
+			} else {
+				lines[i] = ""
+			}
+		}
+	}
+	for len(lines) > 0 && strings.TrimLeft(lines[0], " \t") == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && strings.TrimLeft(lines[len(lines)-1], " \t") == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return strings.Join(lines, "\n")
+}
+
+func isNameStart(ch byte) bool {
+	return ch == '_' || 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z'
+}
+
+func isNameContinue(ch byte) bool {
+	return isNameStart(ch) || isDigit(ch)
+}
+
+func isDigit(ch byte) bool {
+	return '0' <= ch && ch <= '9'
+}
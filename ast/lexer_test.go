@@ -0,0 +1,95 @@
+package ast
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLex(t *testing.T) {
+	as := assert.New(t)
+	tokens, err := Lex("\uFEFFquery($a: [Int!] = -1.5e3) {\r\n  # comment\n  f(s: \"a\\u00e9\\uD83D\\uDE00\\u{1F600}\\n\", b: \"\"\"\n    x\n      \\\"\"\"\n  \"\"\") ...F,\n}")
+	require.NoError(t, err)
+	kinds := make([]TokenKind, len(tokens))
+	for i, token := range tokens {
+		kinds[i] = token.Kind
+	}
+	as.Equal([]TokenKind{
+		TokenName, TokenParenL, TokenDollar, TokenName, TokenColon, TokenBracketL, TokenName, TokenBang, TokenBracketR, TokenEquals, TokenFloat, TokenParenR, TokenBraceL,
+		TokenName, TokenParenL, TokenName, TokenColon, TokenString, TokenName, TokenColon, TokenBlockString, TokenParenR, TokenSpread, TokenName,
+		TokenBraceR, TokenEOF,
+	}, kinds)
+	as.Equal(Location{Line: 1, Column: 1}, tokens[0].Loc)
+	as.Equal("-1.5e3", tokens[10].Value)
+	as.Equal(Location{Line: 3, Column: 3}, tokens[13].Loc)
+	as.Equal("aé😀😀\n", tokens[17].Value)
+	as.Equal("x\n  \"\"\"", tokens[20].Value)
+	as.Equal(Location{Line: 6, Column: 8}, tokens[22].Loc)
+	as.Equal(Location{Line: 7, Column: 1}, tokens[24].Loc)
+}
+
+func TestLexError(t *testing.T) {
+	as := assert.New(t)
+	for source, expected := range map[string]string{
+		"{ ? }":         `Syntax Error: Unexpected character: '?' (1:3)`,
+		"{\n  a(s: \"x": `Syntax Error: Unterminated string (2:8)`,
+		`"\x"`:          `Syntax Error: Invalid character escape sequence: "\\x" (1:2)`,
+		"01":            `Syntax Error: Invalid number, unexpected digit after 0: '1' (1:2)`,
+		"1.":            `Syntax Error: Invalid number, expected digit but got: <EOF> (1:3)`,
+		"1a":            `Syntax Error: Invalid number, expected digit but got: 'a' (1:2)`,
+		`"""abc`:        `Syntax Error: Unterminated string (1:1)`,
+		"é..":           `Syntax Error: Unexpected character: 'é' (1:1)`,
+	} {
+		_, err := Lex(source)
+		if as.Error(err, source) {
+			as.Equal(expected, err.Error(), source)
+		}
+	}
+}
+
+func TestBlockStringValue(t *testing.T) {
+	as := assert.New(t)
+	as.Equal("Hello,\n  World!\n\nYours,\n  GraphQL.", BlockStringValue("\n    Hello,\n      World!\n\n    Yours,\n      GraphQL.\n  "))
+	as.Equal("a", BlockStringValue("a"))
+	as.Equal("", BlockStringValue("  \n  "))
+}
+
+func oneLineQuery(fields int) string {
+	b := &strings.Builder{}
+	b.WriteString("{")
+	for i := 0; i < fields; i++ {
+		fmt.Fprintf(b, " f%d(s: \"é\") { id }", i)
+	}
+	b.WriteString(" }")
+	return b.String()
+}
+
+func TestLexOneLine(t *testing.T) {
+	as := assert.New(t)
+	source := oneLineQuery(10000)
+	tokens, err := Lex(source)
+	require.NoError(t, err)
+	last := tokens[len(tokens)-2]
+	as.Equal(TokenBraceR, last.Kind)
+	as.Equal(Location{Line: 1, Column: utf8.RuneCountInString(source)}, last.Loc)
+	as.Equal(Location{Line: 1, Column: 12}, tokens[6].Loc)
+
+	_, err = Lex(source[:len(source)-1] + "?")
+	if as.Error(err) {
+		as.Equal(fmt.Sprintf("Syntax Error: Unexpected character: '?' (1:%d)", utf8.RuneCountInString(source)), err.Error())
+	}
+}
+
+func BenchmarkParseOneLine(b *testing.B) {
+	source := oneLineQuery(10000)
+	b.SetBytes(int64(len(source)))
+	for i := 0; i < b.N; i++ {
+		if _, err := Parse(source); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,825 @@
+package ast
+
+import (
+	"fmt"
+)
+
+// directiveLocations are the valid locations of directive definitions
+var directiveLocations = map[string]bool{
+	"QUERY":                  true,
+	"MUTATION":               true,
+	"SUBSCRIPTION":           true,
+	"FIELD":                  true,
+	"FRAGMENT_DEFINITION":    true,
+	"FRAGMENT_SPREAD":        true,
+	"INLINE_FRAGMENT":        true,
+	"VARIABLE_DEFINITION":    true,
+	"SCHEMA":                 true,
+	"SCALAR":                 true,
+	"OBJECT":                 true,
+	"FIELD_DEFINITION":       true,
+	"ARGUMENT_DEFINITION":    true,
+	"INTERFACE":              true,
+	"UNION":                  true,
+	"ENUM":                   true,
+	"ENUM_VALUE":             true,
+	"INPUT_OBJECT":           true,
+	"INPUT_FIELD_DEFINITION": true,
+}
+
+type parser struct {
+	tokens []Token
+	pos    int
+}
+
+// Parse parses executable definitions and type system definitions or extensions in source
+func Parse(source string) (*Document, error) {
+	tokens, err := Lex(source)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	doc := &Document{}
+	for {
+		if err := p.parseDefinition(doc); err != nil {
+			return nil, err
+		}
+		if p.peek(TokenEOF) {
+			return doc, nil
+		}
+	}
+}
+
+// ParseValue parses a single constant value like the default value of introspection
+func ParseValue(source string) (*Value, error) {
+	tokens, err := Lex(source)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	v, err := p.parseValue(true)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.expect(TokenEOF); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// ParseType parses a type reference like [String!]!
+func ParseType(source string) (*Type, error) {
+	tokens, err := Lex(source)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	t, err := p.parseType()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.expect(TokenEOF); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (p *parser) token() Token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) lookahead() Token {
+	if p.pos+1 < len(p.tokens) {
+		return p.tokens[p.pos+1]
+	}
+	return p.tokens[len(p.tokens)-1]
+}
+
+func (p *parser) advance() Token {
+	token := p.tokens[p.pos]
+	if token.Kind != TokenEOF {
+		p.pos++
+	}
+	return token
+}
+
+func (p *parser) peek(kind TokenKind) bool {
+	return p.token().Kind == kind
+}
+
+func (p *parser) peekKeyword(keyword string) bool {
+	token := p.token()
+	return token.Kind == TokenName && token.Value == keyword
+}
+
+// skip advances if the current token is kind
+func (p *parser) skip(kind TokenKind) bool {
+	if p.peek(kind) {
+		p.advance()
+		return true
+	}
+	return false
+}
+
+func (p *parser) skipKeyword(keyword string) bool {
+	if p.peekKeyword(keyword) {
+		p.advance()
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(kind TokenKind) (Token, error) {
+	if !p.peek(kind) {
+		return Token{}, p.errorf("Expected %s, found %s", kind, p.token())
+	}
+	return p.advance(), nil
+}
+
+func (p *parser) expectKeyword(keyword string) error {
+	if !p.skipKeyword(keyword) {
+		return p.errorf("Expected %q, found %s", keyword, p.token())
+	}
+	return nil
+}
+
+func (p *parser) unexpected() error {
+	return p.errorf("Unexpected %s", p.token())
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return &SyntaxError{
+		Message: fmt.Sprintf(format, args...),
+		Loc:     p.token().Loc,
+	}
+}
+
+// many parses open item+ close
+func (p *parser) many(open, close TokenKind, item func() error) error {
+	if _, err := p.expect(open); err != nil {
+		return err
+	}
+	for {
+		if err := item(); err != nil {
+			return err
+		}
+		if p.skip(close) {
+			return nil
+		}
+	}
+}
+
+// optionalMany parses open item+ close if the current token is open
+func (p *parser) optionalMany(open, close TokenKind, item func() error) error {
+	if !p.peek(open) {
+		return nil
+	}
+	return p.many(open, close, item)
+}
+
+func (p *parser) parseName() (string, error) {
+	token, err := p.expect(TokenName)
+	return token.Value, err
+}
+
+func (p *parser) parseDefinition(doc *Document) error {
+	if p.peek(TokenBraceL) {
+		op, err := p.parseOperationDefinition()
+		if err != nil {
+			return err
+		}
+		doc.Operations = append(doc.Operations, op)
+		return nil
+	}
+	keyword := p.token()
+	if keyword.Kind == TokenString || keyword.Kind == TokenBlockString {
+		keyword = p.lookahead()
+	}
+	if keyword.Kind != TokenName {
+		return p.unexpected()
+	}
+	switch keyword.Value {
+	case "query", "mutation", "subscription", "fragment":
+		if keyword != p.token() {
+			return p.unexpected()
+		}
+		if keyword.Value == "fragment" {
+			fragment, err := p.parseFragmentDefinition()
+			if err != nil {
+				return err
+			}
+			doc.Fragments = append(doc.Fragments, fragment)
+			return nil
+		}
+		op, err := p.parseOperationDefinition()
+		if err != nil {
+			return err
+		}
+		doc.Operations = append(doc.Operations, op)
+		return nil
+	case "schema":
+		schema, err := p.parseSchemaDefinition()
+		if err != nil {
+			return err
+		}
+		doc.Schemas = append(doc.Schemas, schema)
+		return nil
+	case "scalar", "type", "interface", "union", "enum", "input":
+		def, err := p.parseTypeDefinition()
+		if err != nil {
+			return err
+		}
+		doc.Types = append(doc.Types, def)
+		return nil
+	case "directive":
+		def, err := p.parseDirectiveDefinition()
+		if err != nil {
+			return err
+		}
+		doc.Directives = append(doc.Directives, def)
+		return nil
+	case "extend":
+		if keyword != p.token() {
+			return p.unexpected()
+		}
+		return p.parseExtension(doc)
+	}
+	if keyword != p.token() {
+		p.advance()
+	}
+	return p.unexpected()
+}
+
+func (p *parser) parseOperationDefinition() (*OperationDefinition, error) {
+	op := &OperationDefinition{
+		Operation: Query,
+		Loc:       p.token().Loc,
+	}
+	var err error
+	if !p.peek(TokenBraceL) {
+		if op.Operation, err = p.parseOperationType(); err != nil {
+			return nil, err
+		}
+		if p.peek(TokenName) {
+			op.Name = p.advance().Value
+		}
+		if op.VariableDefinitions, err = p.parseVariableDefinitions(); err != nil {
+			return nil, err
+		}
+		if op.Directives, err = p.parseDirectives(false); err != nil {
+			return nil, err
+		}
+	}
+	if op.SelectionSet, err = p.parseSelectionSet(); err != nil {
+		return nil, err
+	}
+	return op, nil
+}
+
+func (p *parser) parseOperationType() (OperationType, error) {
+	token, err := p.expect(TokenName)
+	if err != nil {
+		return "", err
+	}
+	switch OperationType(token.Value) {
+	case Query, Mutation, Subscription:
+		return OperationType(token.Value), nil
+	}
+	p.pos--
+	return "", p.unexpected()
+}
+
+func (p *parser) parseVariableDefinitions() (defs []*VariableDefinition, err error) {
+	err = p.optionalMany(TokenParenL, TokenParenR, func() error {
+		def := &VariableDefinition{Loc: p.token().Loc}
+		var err error
+		if def.Variable, err = p.parseVariable(); err != nil {
+			return err
+		}
+		if _, err = p.expect(TokenColon); err != nil {
+			return err
+		}
+		if def.Type, err = p.parseType(); err != nil {
+			return err
+		}
+		if p.skip(TokenEquals) {
+			if def.DefaultValue, err = p.parseValue(true); err != nil {
+				return err
+			}
+		}
+		if def.Directives, err = p.parseDirectives(true); err != nil {
+			return err
+		}
+		defs = append(defs, def)
+		return nil
+	})
+	return
+}
+
+func (p *parser) parseVariable() (string, error) {
+	if _, err := p.expect(TokenDollar); err != nil {
+		return "", err
+	}
+	return p.parseName()
+}
+
+func (p *parser) parseSelectionSet() (set SelectionSet, err error) {
+	err = p.many(TokenBraceL, TokenBraceR, func() error {
+		selection, err := p.parseSelection()
+		if err != nil {
+			return err
+		}
+		set = append(set, selection)
+		return nil
+	})
+	return
+}
+
+func (p *parser) parseSelection() (Selection, error) {
+	loc := p.token().Loc
+	if p.skip(TokenSpread) {
+		if p.peek(TokenName) && !p.peekKeyword("on") {
+			spread := &FragmentSpread{
+				Name: p.advance().Value,
+				Loc:  loc,
+			}
+			var err error
+			if spread.Directives, err = p.parseDirectives(false); err != nil {
+				return nil, err
+			}
+			return spread, nil
+		}
+		fragment := &InlineFragment{Loc: loc}
+		var err error
+		if p.skipKeyword("on") {
+			if fragment.TypeCondition, err = p.parseName(); err != nil {
+				return nil, err
+			}
+		}
+		if fragment.Directives, err = p.parseDirectives(false); err != nil {
+			return nil, err
+		}
+		if fragment.SelectionSet, err = p.parseSelectionSet(); err != nil {
+			return nil, err
+		}
+		return fragment, nil
+	}
+	return p.parseField()
+}
+
+func (p *parser) parseField() (*Field, error) {
+	field := &Field{Loc: p.token().Loc}
+	var err error
+	if field.Name, err = p.parseName(); err != nil {
+		return nil, err
+	}
+	if p.skip(TokenColon) {
+		field.Alias = field.Name
+		if field.Name, err = p.parseName(); err != nil {
+			return nil, err
+		}
+	}
+	if field.Arguments, err = p.parseArguments(false); err != nil {
+		return nil, err
+	}
+	if field.Directives, err = p.parseDirectives(false); err != nil {
+		return nil, err
+	}
+	if p.peek(TokenBraceL) {
+		if field.SelectionSet, err = p.parseSelectionSet(); err != nil {
+			return nil, err
+		}
+	}
+	return field, nil
+}
+
+func (p *parser) parseArguments(isConst bool) (args []*Argument, err error) {
+	err = p.optionalMany(TokenParenL, TokenParenR, func() error {
+		arg := &Argument{Loc: p.token().Loc}
+		var err error
+		if arg.Name, err = p.parseName(); err != nil {
+			return err
+		}
+		if _, err = p.expect(TokenColon); err != nil {
+			return err
+		}
+		if arg.Value, err = p.parseValue(isConst); err != nil {
+			return err
+		}
+		args = append(args, arg)
+		return nil
+	})
+	return
+}
+
+func (p *parser) parseDirectives(isConst bool) (directives []*Directive, err error) {
+	for p.peek(TokenAt) {
+		directive := &Directive{Loc: p.advance().Loc}
+		if directive.Name, err = p.parseName(); err != nil {
+			return nil, err
+		}
+		if directive.Arguments, err = p.parseArguments(isConst); err != nil {
+			return nil, err
+		}
+		directives = append(directives, directive)
+	}
+	return directives, nil
+}
+
+func (p *parser) parseFragmentDefinition() (*FragmentDefinition, error) {
+	fragment := &FragmentDefinition{Loc: p.token().Loc}
+	if err := p.expectKeyword("fragment"); err != nil {
+		return nil, err
+	}
+	if p.peekKeyword("on") {
+		return nil, p.unexpected()
+	}
+	var err error
+	if fragment.Name, err = p.parseName(); err != nil {
+		return nil, err
+	}
+	if err = p.expectKeyword("on"); err != nil {
+		return nil, err
+	}
+	if fragment.TypeCondition, err = p.parseName(); err != nil {
+		return nil, err
+	}
+	if fragment.Directives, err = p.parseDirectives(false); err != nil {
+		return nil, err
+	}
+	if fragment.SelectionSet, err = p.parseSelectionSet(); err != nil {
+		return nil, err
+	}
+	return fragment, nil
+}
+
+// parseValue parses value, variables are not allowed if isConst
+func (p *parser) parseValue(isConst bool) (*Value, error) {
+	token := p.token()
+	v := &Value{Loc: token.Loc}
+	switch token.Kind {
+	case TokenBracketL:
+		v.Kind = ListValue
+		p.advance()
+		for !p.skip(TokenBracketR) {
+			item, err := p.parseValue(isConst)
+			if err != nil {
+				return nil, err
+			}
+			v.List = append(v.List, item)
+		}
+		return v, nil
+	case TokenBraceL:
+		v.Kind = ObjectValue
+		p.advance()
+		for !p.skip(TokenBraceR) {
+			field := &ObjectField{Loc: p.token().Loc}
+			var err error
+			if field.Name, err = p.parseName(); err != nil {
+				return nil, err
+			}
+			if _, err = p.expect(TokenColon); err != nil {
+				return nil, err
+			}
+			if field.Value, err = p.parseValue(isConst); err != nil {
+				return nil, err
+			}
+			v.Fields = append(v.Fields, field)
+		}
+		return v, nil
+	case TokenInt:
+		v.Kind = IntValue
+	case TokenFloat:
+		v.Kind = FloatValue
+	case TokenString:
+		v.Kind = StringValue
+	case TokenBlockString:
+		v.Kind = BlockValue
+	case TokenName:
+		switch token.Value {
+		case "true", "false":
+			v.Kind = BooleanValue
+		case "null":
+			v.Kind = NullValue
+		default:
+			v.Kind = EnumValue
+		}
+	case TokenDollar:
+		if isConst {
+			return nil, p.unexpected()
+		}
+		v.Kind = Variable
+		var err error
+		v.Raw, err = p.parseVariable()
+		return v, err
+	default:
+		return nil, p.unexpected()
+	}
+	v.Raw = p.advance().Value
+	return v, nil
+}
+
+func (p *parser) parseType() (*Type, error) {
+	t := &Type{Loc: p.token().Loc}
+	if p.skip(TokenBracketL) {
+		var err error
+		if t.Elem, err = p.parseType(); err != nil {
+			return nil, err
+		}
+		if _, err = p.expect(TokenBracketR); err != nil {
+			return nil, err
+		}
+	} else {
+		var err error
+		if t.NamedType, err = p.parseName(); err != nil {
+			return nil, err
+		}
+	}
+	t.NonNull = p.skip(TokenBang)
+	return t, nil
+}
+
+func (p *parser) parseDescription() string {
+	if p.peek(TokenString) || p.peek(TokenBlockString) {
+		return p.advance().Value
+	}
+	return ""
+}
+
+func (p *parser) parseSchemaDefinition() (*SchemaDefinition, error) {
+	schema := &SchemaDefinition{
+		Loc:         p.token().Loc,
+		Description: p.parseDescription(),
+	}
+	if err := p.expectKeyword("schema"); err != nil {
+		return nil, err
+	}
+	return schema, p.parseSchemaBody(schema)
+}
+
+func (p *parser) parseSchemaBody(schema *SchemaDefinition) (err error) {
+	if schema.Directives, err = p.parseDirectives(true); err != nil {
+		return err
+	}
+	parse := p.many
+	if schema.Extend {
+		parse = p.optionalMany
+	}
+	return parse(TokenBraceL, TokenBraceR, func() error {
+		def := &OperationTypeDefinition{Loc: p.token().Loc}
+		var err error
+		if def.Operation, err = p.parseOperationType(); err != nil {
+			return err
+		}
+		if _, err = p.expect(TokenColon); err != nil {
+			return err
+		}
+		if def.Type, err = p.parseName(); err != nil {
+			return err
+		}
+		schema.OperationTypes = append(schema.OperationTypes, def)
+		return nil
+	})
+}
+
+var definitionKinds = map[string]DefinitionKind{
+	"scalar":    Scalar,
+	"type":      Object,
+	"interface": Interface,
+	"union":     Union,
+	"enum":      Enum,
+	"input":     InputObject,
+}
+
+func (p *parser) parseTypeDefinition() (*TypeDefinition, error) {
+	def := &TypeDefinition{
+		Loc:         p.token().Loc,
+		Description: p.parseDescription(),
+	}
+	def.Kind = definitionKinds[p.advance().Value]
+	return def, p.parseTypeBody(def)
+}
+
+func (p *parser) parseTypeBody(def *TypeDefinition) (err error) {
+	if def.Name, err = p.parseName(); err != nil {
+		return err
+	}
+	if def.Kind == Object || def.Kind == Interface {
+		if def.Interfaces, err = p.parseImplementsInterfaces(); err != nil {
+			return err
+		}
+	}
+	if def.Directives, err = p.parseDirectives(true); err != nil {
+		return err
+	}
+	switch def.Kind {
+	case Object, Interface:
+		err = p.optionalMany(TokenBraceL, TokenBraceR, func() error {
+			field, err := p.parseFieldDefinition()
+			if err != nil {
+				return err
+			}
+			def.Fields = append(def.Fields, field)
+			return nil
+		})
+	case Union:
+		if p.skip(TokenEquals) {
+			p.skip(TokenPipe)
+			for {
+				name, err := p.parseName()
+				if err != nil {
+					return err
+				}
+				def.Types = append(def.Types, name)
+				if !p.skip(TokenPipe) {
+					break
+				}
+			}
+		}
+	case Enum:
+		err = p.optionalMany(TokenBraceL, TokenBraceR, func() error {
+			value := &EnumValueDefinition{
+				Loc:         p.token().Loc,
+				Description: p.parseDescription(),
+			}
+			if p.peekKeyword("true") || p.peekKeyword("false") || p.peekKeyword("null") {
+				return p.errorf("%s is reserved and cannot be used for an enum value", p.token().Value)
+			}
+			var err error
+			if value.Name, err = p.parseName(); err != nil {
+				return err
+			}
+			if value.Directives, err = p.parseDirectives(true); err != nil {
+				return err
+			}
+			def.EnumValues = append(def.EnumValues, value)
+			return nil
+		})
+	case InputObject:
+		err = p.optionalMany(TokenBraceL, TokenBraceR, func() error {
+			value, err := p.parseInputValueDefinition()
+			if err != nil {
+				return err
+			}
+			def.InputFields = append(def.InputFields, value)
+			return nil
+		})
+	}
+	if err == nil && def.Extend && len(def.Interfaces) == 0 && len(def.Directives) == 0 && len(def.Fields) == 0 &&
+		len(def.Types) == 0 && len(def.EnumValues) == 0 && len(def.InputFields) == 0 {
+		err = p.unexpected()
+	}
+	return err
+}
+
+func (p *parser) parseImplementsInterfaces() (names []string, err error) {
+	if !p.skipKeyword("implements") {
+		return nil, nil
+	}
+	p.skip(TokenAmp)
+	for {
+		name, err := p.parseName()
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+		if !p.skip(TokenAmp) {
+			return names, nil
+		}
+	}
+}
+
+func (p *parser) parseFieldDefinition() (*FieldDefinition, error) {
+	field := &FieldDefinition{
+		Loc:         p.token().Loc,
+		Description: p.parseDescription(),
+	}
+	var err error
+	if field.Name, err = p.parseName(); err != nil {
+		return nil, err
+	}
+	if field.Arguments, err = p.parseArgumentDefinitions(); err != nil {
+		return nil, err
+	}
+	if _, err = p.expect(TokenColon); err != nil {
+		return nil, err
+	}
+	if field.Type, err = p.parseType(); err != nil {
+		return nil, err
+	}
+	if field.Directives, err = p.parseDirectives(true); err != nil {
+		return nil, err
+	}
+	return field, nil
+}
+
+func (p *parser) parseArgumentDefinitions() (args []*InputValueDefinition, err error) {
+	err = p.optionalMany(TokenParenL, TokenParenR, func() error {
+		arg, err := p.parseInputValueDefinition()
+		if err != nil {
+			return err
+		}
+		args = append(args, arg)
+		return nil
+	})
+	return
+}
+
+func (p *parser) parseInputValueDefinition() (*InputValueDefinition, error) {
+	value := &InputValueDefinition{
+		Loc:         p.token().Loc,
+		Description: p.parseDescription(),
+	}
+	var err error
+	if value.Name, err = p.parseName(); err != nil {
+		return nil, err
+	}
+	if _, err = p.expect(TokenColon); err != nil {
+		return nil, err
+	}
+	if value.Type, err = p.parseType(); err != nil {
+		return nil, err
+	}
+	if p.skip(TokenEquals) {
+		if value.DefaultValue, err = p.parseValue(true); err != nil {
+			return nil, err
+		}
+	}
+	if value.Directives, err = p.parseDirectives(true); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+func (p *parser) parseDirectiveDefinition() (*DirectiveDefinition, error) {
+	def := &DirectiveDefinition{
+		Loc:         p.token().Loc,
+		Description: p.parseDescription(),
+	}
+	if err := p.expectKeyword("directive"); err != nil {
+		return nil, err
+	}
+	if _, err := p.expect(TokenAt); err != nil {
+		return nil, err
+	}
+	var err error
+	if def.Name, err = p.parseName(); err != nil {
+		return nil, err
+	}
+	if def.Arguments, err = p.parseArgumentDefinitions(); err != nil {
+		return nil, err
+	}
+	def.Repeatable = p.skipKeyword("repeatable")
+	if err = p.expectKeyword("on"); err != nil {
+		return nil, err
+	}
+	p.skip(TokenPipe)
+	for {
+		token := p.token()
+		if token.Kind != TokenName || !directiveLocations[token.Value] {
+			return nil, p.unexpected()
+		}
+		def.Locations = append(def.Locations, p.advance().Value)
+		if !p.skip(TokenPipe) {
+			return def, nil
+		}
+	}
+}
+
+func (p *parser) parseExtension(doc *Document) error {
+	loc := p.advance().Loc
+	keyword := p.token()
+	if keyword.Kind != TokenName {
+		return p.unexpected()
+	}
+	if keyword.Value == "schema" {
+		p.advance()
+		schema := &SchemaDefinition{
+			Extend: true,
+			Loc:    loc,
+		}
+		if err := p.parseSchemaBody(schema); err != nil {
+			return err
+		}
+		if len(schema.Directives) == 0 && len(schema.OperationTypes) == 0 {
+			return p.unexpected()
+		}
+		doc.Schemas = append(doc.Schemas, schema)
+		return nil
+	}
+	kind, ok := definitionKinds[keyword.Value]
+	if !ok {
+		return p.unexpected()
+	}
+	p.advance()
+	def := &TypeDefinition{
+		Kind:   kind,
+		Extend: true,
+		Loc:    loc,
+	}
+	if err := p.parseTypeBody(def); err != nil {
+		return err
+	}
+	doc.Types = append(doc.Types, def)
+	return nil
+}
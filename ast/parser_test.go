@@ -0,0 +1,163 @@
+package ast
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseExecutable(t *testing.T) {
+	as := assert.New(t)
+	doc, err := Parse(`
+query Q($id: ID!, $n: [Int] = [1, 2] @d) @live {
+  u: user(id: $id, filter: {name: "x", tags: [A, B], nil: null, ok: true}) {
+    ...F @include(if: $ok)
+    ... on User { id }
+    ... @defer { name }
+  }
+}
+
+fragment F on User { friends(first: 1.5) { id } }
+
+{ a }
+`)
+	require.NoError(t, err)
+	as.Len(doc.Operations, 2)
+	as.Len(doc.Fragments, 1)
+
+	op := doc.Operation("Q")
+	as.Equal(Query, op.Operation)
+	as.Equal(Location{Line: 2, Column: 1}, op.Loc)
+	as.Equal("id", op.VariableDefinitions[0].Variable)
+	as.Equal("ID!", op.VariableDefinitions[0].Type.String())
+	as.Equal("[Int]", op.VariableDefinitions[1].Type.String())
+	as.Equal("[1, 2]", op.VariableDefinitions[1].DefaultValue.String())
+	as.Equal("d", op.VariableDefinitions[1].Directives[0].Name)
+	as.Equal("live", op.Directives[0].Name)
+
+	user := op.SelectionSet[0].(*Field)
+	as.Equal("u", user.ResponseKey())
+	as.Equal("user", user.Name)
+	as.Equal(Location{Line: 3, Column: 3}, user.Loc)
+	as.Equal(Variable, user.Argument("id").Value.Kind)
+	as.Equal(`{name: "x", tags: [A, B], nil: null, ok: true}`, user.Argument("filter").Value.String())
+	as.Nil(user.Argument("missing"))
+
+	spread := user.SelectionSet[0].(*FragmentSpread)
+	as.Equal("F", spread.Name)
+	as.Equal("$ok", spread.Directives[0].Argument("if").Value.String())
+	as.Equal("User", user.SelectionSet[1].(*InlineFragment).TypeCondition)
+	inline := user.SelectionSet[2].(*InlineFragment)
+	as.Equal("", inline.TypeCondition)
+	as.Equal("defer", inline.Directives[0].Name)
+	as.Equal(Location{Line: 6, Column: 5}, inline.Location())
+
+	fragment := doc.Fragment("F")
+	as.Equal("User", fragment.TypeCondition)
+	as.Equal(FloatValue, fragment.SelectionSet[0].(*Field).Arguments[0].Value.Kind)
+	as.Nil(doc.Fragment("G"))
+
+	as.Nil(doc.Operation(""))
+	doc, err = Parse(`{ a }`)
+	require.NoError(t, err)
+	as.Equal(Query, doc.Operation("").Operation)
+}
+
+func TestParseSDL(t *testing.T) {
+	as := assert.New(t)
+	doc, err := Parse(`
+schema @d { query: Root mutation: M }
+
+"""
+The user
+"""
+type User implements & Node & Entity @key(fields: "id") {
+  "the id"
+  id: ID!
+  friends(first: Int = 10 @deprecated, after: String): [User!]! @deprecated(reason: "no")
+}
+
+interface Node implements Entity { id: ID! }
+union Result = | User | Node
+enum Role { ADMIN "guest" GUEST @deprecated }
+input Filter { role: Role = ADMIN, tags: [String!] }
+scalar Date @specifiedBy(url: "https://tools.ietf.org/html/rfc3339")
+directive @key("the fields" fields: String!) repeatable on | OBJECT | INTERFACE
+
+extend schema { subscription: S }
+extend type User { name: String }
+extend union Result = Other
+extend enum Role @d
+`)
+	require.NoError(t, err)
+	as.Len(doc.Schemas, 2)
+	as.Equal(Mutation, doc.Schemas[0].OperationTypes[1].Operation)
+	as.Equal("M", doc.Schemas[0].OperationTypes[1].Type)
+	as.True(doc.Schemas[1].Extend)
+
+	as.Len(doc.Types, 9)
+	user := doc.Types[0]
+	as.Equal(Object, user.Kind)
+	as.Equal("The user", user.Description)
+	as.Equal([]string{"Node", "Entity"}, user.Interfaces)
+	as.Equal(`"id"`, user.Directives[0].Arguments[0].Value.String())
+	as.Equal("the id", user.Fields[0].Description)
+	as.Equal(Location{Line: 8, Column: 3}, user.Fields[0].Loc)
+	friends := user.Fields[1]
+	as.Equal("[User!]!", friends.Type.String())
+	as.Equal("10", friends.Arguments[0].DefaultValue.String())
+	as.Equal("deprecated", friends.Directives[0].Name)
+	as.Equal([]string{"Entity"}, doc.Types[1].Interfaces)
+	as.Equal([]string{"User", "Node"}, doc.Types[2].Types)
+	as.Equal("guest", doc.Types[3].EnumValues[1].Description)
+	as.Equal("ADMIN", doc.Types[4].InputFields[0].DefaultValue.String())
+	as.Equal(Scalar, doc.Types[5].Kind)
+	as.True(doc.Types[6].Extend)
+	as.Equal(Enum, doc.Types[8].Kind)
+
+	key := doc.Directives[0]
+	as.True(key.Repeatable)
+	as.Equal([]string{"OBJECT", "INTERFACE"}, key.Locations)
+	as.Equal("the fields", key.Arguments[0].Description)
+}
+
+func TestParseError(t *testing.T) {
+	as := assert.New(t)
+	for source, expected := range map[string]string{
+		"":                          `Syntax Error: Unexpected <EOF> (1:1)`,
+		"{}":                        `Syntax Error: Expected Name, found } (1:2)`,
+		"{ a(b: $c }":               `Syntax Error: Expected Name, found } (1:11)`,
+		"query Q($a: Int = $b) {a}": `Syntax Error: Unexpected $ (1:19)`,
+		"fragment on on T {a}":      `Syntax Error: Unexpected Name "on" (1:10)`,
+		"notAnOperation {a}":        `Syntax Error: Unexpected Name "notAnOperation" (1:1)`,
+		`"desc" query {a}`:          `Syntax Error: Unexpected String "desc" (1:1)`,
+		"type T {\n  a: [Int\n}":    `Syntax Error: Expected ], found } (3:1)`,
+		"extend type T":             `Syntax Error: Unexpected <EOF> (1:14)`,
+		"enum E { true }":           `Syntax Error: true is reserved and cannot be used for an enum value (1:10)`,
+		"directive @d on NOWHERE":   `Syntax Error: Unexpected Name "NOWHERE" (1:17)`,
+	} {
+		_, err := Parse(source)
+		if as.Error(err, source) {
+			as.Equal(expected, err.Error(), source)
+		}
+	}
+}
+
+func TestParseValueAndType(t *testing.T) {
+	as := assert.New(t)
+	v, err := ParseValue(`{a: "x\ny", b: [1, -2.5]}`)
+	require.NoError(t, err)
+	as.Equal(`{a: "x\ny", b: [1, -2.5]}`, v.String())
+	_, err = ParseValue(`$a`)
+	as.Error(err)
+	_, err = ParseValue(`1 2`)
+	as.Error(err)
+
+	typ, err := ParseType("[[Int!]]!")
+	require.NoError(t, err)
+	as.Equal("[[Int!]]!", typ.String())
+	as.Equal("Int", typ.Elem.Elem.NamedType)
+	_, err = ParseType("[Int")
+	as.Error(err)
+}
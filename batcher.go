@@ -0,0 +1,213 @@
+package gqlgo
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// BatchOption be changed at anytime after NewBatcher
+type BatchOption struct {
+	// Window is the time of collecting requests since the first one, default is 10 milliseconds
+	Window time.Duration
+
+	// MaxSize is the maximum requests in a batch, default is 10
+	MaxSize int
+}
+
+// Batcher collects concurrent single requests and sends them as batch requests by Client.Do.
+// Only requests with the same Headers are sent in a batch, because a batch is a single HTTP request.
+// A batch is sent with the values of ctx of its first call, and cancelled once ctx of every call is done.
+type Batcher struct {
+	*BatchOption
+	client *Client
+
+	mutex sync.Mutex
+	// pending batches by the key of Headers
+	pending map[string]*batch
+	// generation increases for every new batch
+	generation uint64
+}
+
+// batch collects calls of the same Headers until it's flushed
+type batch struct {
+	calls      []*batchCall
+	timer      *time.Timer
+	generation uint64
+}
+
+// NewBatcher only take the first BatchOption if given
+func NewBatcher(client *Client, opt ...BatchOption) *Batcher {
+	batcher := &Batcher{
+		BatchOption: &BatchOption{},
+		client:      client,
+		pending:     make(map[string]*batch),
+	}
+	if len(opt) > 0 {
+		batcher.BatchOption = &opt[0]
+	}
+	return batcher
+}
+
+// batchCall receives the result of a request into data, so result of cancelled call is dropped without touching res
+type batchCall struct {
+	ctx  context.Context
+	req  Request
+	data json.RawMessage
+	resp *Response
+	err  error
+	done chan struct{}
+}
+
+// Do is like Client.Do with a single request, res can be *Response as well
+func (b *Batcher) Do(ctx context.Context, res interface{}, req Request) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+	}
+	call := &batchCall{
+		ctx:  ctx,
+		req:  req,
+		done: make(chan struct{}),
+	}
+	call.resp = &Response{Data: &call.data}
+	b.add(call)
+	select {
+	case <-call.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if r, ok := res.(*Response); ok {
+		data := r.Data
+		*r = *call.resp
+		r.Data = data
+		res = data
+	}
+	if res != nil && len(call.data) > 0 {
+		if err := json.Unmarshal(call.data, res); err != nil {
+			return errors.Wrap(err, "json decode graphql data")
+		}
+	}
+	return call.err
+}
+
+func (b *Batcher) add(call *batchCall) {
+	maxSize := b.MaxSize
+	if maxSize <= 0 {
+		maxSize = 10
+	}
+	window := b.Window
+	if window == 0 {
+		window = 10 * time.Millisecond
+	}
+	key := headersKey(call.req.Headers)
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	pending := b.pending[key]
+	if pending == nil {
+		b.generation++
+		pending = &batch{generation: b.generation}
+		b.pending[key] = pending
+	}
+	pending.calls = append(pending.calls, call)
+	switch {
+	case len(pending.calls) >= maxSize:
+		b.flush(key)
+	case len(pending.calls) == 1:
+		generation := pending.generation
+		pending.timer = time.AfterFunc(window, func() {
+			b.mutex.Lock()
+			defer b.mutex.Unlock()
+			// the batch may be flushed by MaxSize while this callback is waiting for mutex,
+			// then it must not flush the next batch of key early
+			if current := b.pending[key]; current != nil && current.generation == generation {
+				b.flush(key)
+			}
+		})
+	}
+}
+
+// flush sends pending calls of key in background, mutex must be held
+func (b *Batcher) flush(key string) {
+	pending := b.pending[key]
+	if pending == nil {
+		return
+	}
+	delete(b.pending, key)
+	if pending.timer != nil {
+		pending.timer.Stop()
+	}
+	go b.send(pending.calls)
+}
+
+// headersKey identifies headers regardless of the order of map
+func headersKey(headers map[string]string) string {
+	pairs := make([]string, 0, len(headers))
+	for k, v := range headers {
+		pairs = append(pairs, http.CanonicalHeaderKey(k)+":"+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "\n")
+}
+
+// send fans GraphQL errors of BatchError out to calls, other errors are shared by all calls
+func (b *Batcher) send(calls []*batchCall) {
+	requests := make([]Request, len(calls))
+	var res interface{} = calls[0].resp
+	if len(calls) > 1 {
+		resList := make([]interface{}, len(calls))
+		for i, call := range calls {
+			requests[i] = call.req
+			resList[i] = call.resp
+		}
+		res = resList
+	} else {
+		requests[0] = calls[0].req
+	}
+	ctx, cancel := batchContext(calls)
+	defer cancel()
+	err := b.client.Do(ctx, res, requests...)
+	batchErr := &BatchError{}
+	isBatchErr := errors.As(err, &batchErr)
+	for i, call := range calls {
+		call.err = err
+		if isBatchErr {
+			call.err = batchErr.Err(i)
+		}
+		close(call.done)
+	}
+}
+
+// valuesContext takes values from another context
+type valuesContext struct {
+	context.Context
+	values context.Context
+}
+
+func (c valuesContext) Value(key interface{}) interface{} {
+	return c.values.Value(key)
+}
+
+// batchContext has values of ctx of the first call, it's cancelled when ctx of every call is done,
+// but not by the deadline or cancellation of a single call
+func batchContext(calls []*batchCall) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		for _, call := range calls {
+			select {
+			case <-call.ctx.Done():
+			case <-ctx.Done():
+				return
+			}
+		}
+		cancel()
+	}()
+	return valuesContext{Context: ctx, values: calls[0].ctx}, cancel
+}
@@ -0,0 +1,225 @@
+package gqlgo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatcher(t *testing.T) {
+	as := assert.New(t)
+	var (
+		mutex sync.Mutex
+		sizes []int
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqs []Request
+		as.NoError(json.NewDecoder(r.Body).Decode(&reqs))
+		mutex.Lock()
+		sizes = append(sizes, len(reqs))
+		mutex.Unlock()
+		var resps []interface{}
+		for _, req := range reqs {
+			if req.Variables["n"] == float64(0) {
+				resps = append(resps, map[string]interface{}{"errors": []GraphQLError{{Message: "zero"}}})
+				continue
+			}
+			resps = append(resps, map[string]interface{}{"data": map[string]interface{}{"n": req.Variables["n"]}})
+		}
+		_ = json.NewEncoder(w).Encode(resps)
+	}))
+	defer server.Close()
+	batcher := NewBatcher(NewClient(server.URL), BatchOption{Window: 50 * time.Millisecond, MaxSize: 3})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			data := struct{ N int }{}
+			err := batcher.Do(context.Background(), &data, Request{
+				Query:     "query($n:Int){n}",
+				Variables: map[string]interface{}{"n": i},
+			})
+			if i == 0 {
+				as.Equal(GraphQLErrors{{Message: "zero"}}, err)
+				return
+			}
+			as.NoError(err)
+			as.Equal(i, data.N, fmt.Sprint("request ", i))
+		}(i)
+	}
+	wg.Wait()
+	as.Equal([]int{3, 3}, sizes)
+}
+
+func TestBatcherHeaders(t *testing.T) {
+	as := assert.New(t)
+	var (
+		mutex   sync.Mutex
+		batches = map[string][]string{}
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// different headers are never batched, so every request is single
+		req := Request{}
+		as.NoError(json.NewDecoder(r.Body).Decode(&req))
+		auth := r.Header.Get("Authorization")
+		mutex.Lock()
+		batches[auth] = append(batches[auth], req.Variables["user"].(string))
+		mutex.Unlock()
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"auth": auth}})
+	}))
+	defer server.Close()
+	batcher := NewBatcher(NewClient(server.URL), BatchOption{Window: 50 * time.Millisecond, MaxSize: 2})
+
+	var wg sync.WaitGroup
+	for _, user := range []string{"a", "b"} {
+		wg.Add(1)
+		go func(user string) {
+			defer wg.Done()
+			data := struct{ Auth string }{}
+			as.NoError(batcher.Do(context.Background(), &data, Request{
+				Query:     "query($user:String){auth}",
+				Variables: map[string]interface{}{"user": user},
+				Headers:   map[string]string{"Authorization": "Bearer " + user},
+			}))
+			as.Equal("Bearer "+user, data.Auth)
+		}(user)
+	}
+	wg.Wait()
+	as.Equal(map[string][]string{"Bearer a": {"a"}, "Bearer b": {"b"}}, batches)
+}
+
+func TestBatcherSingleAndCancel(t *testing.T) {
+	as := assert.New(t)
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := Request{}
+		as.NoError(json.NewDecoder(r.Body).Decode(&req), "call of a batch alone is sent as single request")
+		if req.Variables["block"] == true {
+			<-release
+		}
+		_, _ = w.Write([]byte(`{"data":{"n":1},"extensions":{"cost":1}}`))
+	}))
+	defer server.Close()
+	batcher := NewBatcher(NewClient(server.URL), BatchOption{Window: 10 * time.Millisecond})
+
+	data := struct{ N int }{}
+	resp := &Response{Data: &data}
+	as.NoError(batcher.Do(context.Background(), resp, Request{Query: "{n}"}))
+	as.Equal(1, data.N)
+	as.Equal(float64(1), resp.Extensions["cost"])
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	as.Equal(context.Canceled, batcher.Do(ctx, &data, Request{Query: "{n}"}))
+
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	as.Equal(context.DeadlineExceeded, batcher.Do(ctx, &data, Request{
+		Query:     "query($block:Boolean){n}",
+		Variables: map[string]interface{}{"block": true},
+	}))
+	close(release)
+}
+
+func TestBatcherStaleTimer(t *testing.T) {
+	as := assert.New(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"data":{}}`))
+	}))
+	defer server.Close()
+	batcher := NewBatcher(NewClient(server.URL), BatchOption{Window: 10 * time.Millisecond})
+	newCall := func() *batchCall {
+		call := &batchCall{ctx: context.Background(), req: Request{Query: "{n}"}, done: make(chan struct{})}
+		call.resp = &Response{Data: &call.data}
+		return call
+	}
+
+	first := newCall()
+	batcher.add(first)
+	batcher.mutex.Lock()
+	// the timer of first batch fires and waits for mutex
+	time.Sleep(50 * time.Millisecond)
+	// first batch is flushed like reaching MaxSize, and the next batch starts
+	batcher.flush("")
+	next := newCall()
+	batcher.generation++
+	batcher.pending[""] = &batch{calls: []*batchCall{next}, generation: batcher.generation}
+	batcher.mutex.Unlock()
+
+	<-first.done
+	time.Sleep(50 * time.Millisecond)
+	select {
+	case <-next.done:
+		as.Fail("next batch is flushed by the timer of first batch")
+	default:
+	}
+	batcher.mutex.Lock()
+	batcher.flush("")
+	batcher.mutex.Unlock()
+	<-next.done
+}
+
+func TestBatcherContext(t *testing.T) {
+	as := assert.New(t)
+	cancelled := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = ioutil.ReadAll(r.Body)
+		<-r.Context().Done()
+		close(cancelled)
+	}))
+	defer server.Close()
+	type key struct{}
+	values := make(chan interface{}, 1)
+	client := NewClient(server.URL, Option{Middlewares: []Middleware{func(next Handler) Handler {
+		return func(ctx context.Context, res interface{}, requests []Request) error {
+			values <- ctx.Value(key{})
+			return next(ctx, res, requests)
+		}
+	}}})
+	// both calls are in the batch flushed by MaxSize
+	batcher := NewBatcher(client, BatchOption{Window: time.Minute, MaxSize: 2})
+
+	first, cancelFirst := context.WithCancel(context.WithValue(context.Background(), key{}, "first"))
+	second, cancelSecond := context.WithCancel(context.WithValue(context.Background(), key{}, "second"))
+	wg := sync.WaitGroup{}
+	do := func(ctx context.Context) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			as.Equal(context.Canceled, batcher.Do(ctx, nil, Request{Query: "{n}"}))
+		}()
+	}
+	do(first)
+	// second call is added after first one
+	as.Eventually(func() bool {
+		batcher.mutex.Lock()
+		defer batcher.mutex.Unlock()
+		return batcher.pending[""] != nil
+	}, time.Second, time.Millisecond)
+	do(second)
+	as.Equal("first", <-values)
+
+	cancelFirst()
+	select {
+	case <-cancelled:
+		as.Fail("batch is cancelled while second call is waiting")
+	case <-time.After(50 * time.Millisecond):
+	}
+	cancelSecond()
+	select {
+	case <-cancelled:
+	case <-time.After(5 * time.Second):
+		as.Fail("batch is not cancelled after every call gave up")
+	}
+	wg.Wait()
+}
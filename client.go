@@ -7,22 +7,28 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"mime"
 	"mime/multipart"
 	"net/http"
+	"net/url"
 	"strings"
 
 	"github.com/pkg/errors"
+	"github.com/poohvpn/gqlgo/introspection"
 )
 
 type Client struct {
 	*Option
 	WebSocketClient *WSClient
+
+	persistedQueries *persistedQueryState
 }
 
 // NewClient only take the first Option if given
 func NewClient(endpoint string, opt ...Option) *Client {
 	client := &Client{
-		Option: &Option{},
+		Option:           &Option{},
+		persistedQueries: &persistedQueryState{},
 	}
 	if len(opt) > 0 {
 		client.Option = &opt[0]
@@ -35,10 +41,110 @@ func NewClient(endpoint string, opt ...Option) *Client {
 		client.WebSocketEndpoint = "ws" + strings.TrimPrefix(client.Endpoint, "http")
 	}
 	client.WebSocketClient = NewWSClient(client.WebSocketEndpoint, client.WebSocketOption)
+	client.WebSocketClient.persistedQueries = client.persistedQueries
 	return client
 }
 
+// Do sends requests through Middlewares, res should be a list of results for batch requests.
+// GraphQL errors of a single request are returned as GraphQLErrors. GraphQL errors of batch requests are returned
+// as *BatchError keeping them by request index, errors.As into GraphQLErrors gets the errors of all requests flattened.
 func (c *Client) Do(ctx context.Context, res interface{}, requests ...Request) error {
+	requests = parseRequests(requests)
+	if err := c.validate(requests...); err != nil {
+		return err
+	}
+	return c.handler(nil)(ctx, res, requests)
+}
+
+// DoIncremental is like Do with a single request, handler is called every time a chunk of @defer or @stream arrived.
+// res is filled with the data merged from all chunks, it can be nil if handler is enough.
+func (c *Client) DoIncremental(ctx context.Context, res interface{}, req Request, handler IncrementalHandler) error {
+	requests := parseRequests([]Request{req})
+	if err := c.validate(requests...); err != nil {
+		return err
+	}
+	return c.handler(handler)(ctx, res, requests)
+}
+
+// validate checks requests by Validator, GraphQLErrors of batch requests are returned as BatchError
+func (c *Client) validate(requests ...Request) error {
+	if c.Validator == nil {
+		return nil
+	}
+	if len(requests) == 1 {
+		return c.Validator.Validate(requests[0])
+	}
+	batchErr := &BatchError{Errors: make([]GraphQLErrors, len(requests))}
+	failed := false
+	for i, req := range requests {
+		err := c.Validator.Validate(req)
+		if err == nil {
+			continue
+		}
+		gqlErrs := GraphQLErrors{}
+		if !errors.As(err, &gqlErrs) {
+			return err
+		}
+		batchErr.Errors[i] = gqlErrs
+		failed = true
+	}
+	if failed {
+		return batchErr
+	}
+	return nil
+}
+
+// Introspect runs introspection.FullQuery by Do, and introspection.Query again if server rejected it by GraphQL errors,
+// so older servers not knowing deprecated arguments or repeatable directives are introspected too.
+func (c *Client) Introspect(ctx context.Context) (*introspection.Schema, error) {
+	schema, err := c.introspect(ctx, introspection.FullQuery)
+	if err != nil && len(graphQLErrorsOf(err)) > 0 {
+		return c.introspect(ctx, introspection.Query)
+	}
+	return schema, err
+}
+
+func (c *Client) introspect(ctx context.Context, query string) (*introspection.Schema, error) {
+	res := &introspection.Response{}
+	err := c.Do(ctx, res, Request{
+		Query:         query,
+		OperationName: introspection.OperationName,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &res.Schema, nil
+}
+
+// handler wraps the sending of requests with Middlewares, the first middleware is the outermost
+func (c *Client) handler(onChunk IncrementalHandler) Handler {
+	h := Handler(func(ctx context.Context, res interface{}, requests []Request) error {
+		return c.doRetry(ctx, res, onChunk, requests)
+	})
+	for i := len(c.Middlewares) - 1; i >= 0; i-- {
+		h = c.Middlewares[i](h)
+	}
+	return h
+}
+
+// sendOption is decided by the original requests, before their queries are replaced by hashes of persisted queries
+type sendOption struct {
+	// allowGET means the single request is a query which can be sent by GET
+	allowGET bool
+
+	// incremental means the single request may be delivered incrementally
+	incremental bool
+}
+
+func (c *Client) sendOption(requests []Request) sendOption {
+	return sendOption{
+		allowGET:    c.allowGET(requests),
+		incremental: len(requests) == 1 && hasIncrementalDirective(requests[0]),
+	}
+}
+
+// doRequests calls onChunk for every chunk of the single request if onChunk is not nil
+func (c *Client) doRequests(ctx context.Context, res interface{}, onChunk IncrementalHandler, opt sendOption, requests ...Request) error {
 	select {
 	case <-ctx.Done():
 		return ctx.Err()
@@ -85,6 +191,14 @@ func (c *Client) Do(ctx context.Context, res interface{}, requests ...Request) e
 		return err
 	}
 
+	// send query by GET when URL is not too long
+	method, endpoint := http.MethodPost, c.Endpoint
+	if opt.allowGET && len(graphqlFiles) == 0 {
+		if getURL, ok := c.getURL(requests[0]); ok {
+			method, endpoint = http.MethodGet, getURL
+		}
+	}
+
 	// when uploading file, use http multipart body, otherwise use json body
 	// graphql file upload spec: https://github.com/jaydenseric/graphql-multipart-request-spec
 	if len(graphqlFiles) > 0 {
@@ -122,7 +236,7 @@ func (c *Client) Do(ctx context.Context, res interface{}, requests ...Request) e
 		if err := writer.Close(); err != nil {
 			return errors.Wrap(err, "close multipart writer")
 		}
-	} else {
+	} else if method == http.MethodPost {
 		contentType = "application/json; charset=utf-8"
 		_, err = httpReqBody.Write(operationsJson)
 		if err != nil {
@@ -130,26 +244,16 @@ func (c *Client) Do(ctx context.Context, res interface{}, requests ...Request) e
 		}
 	}
 
-	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.Endpoint, &httpReqBody)
+	httpReq, err := http.NewRequestWithContext(ctx, method, endpoint, &httpReqBody)
 	if err != nil {
 		return err
 	}
 
-	// set http request options and headers
-	httpReq.Close = c.CloseBody
-	for k, v := range c.Headers {
-		httpReq.Header.Set(k, v)
-	}
-	httpReq.Header.Set("Content-Type", contentType)
-	httpReq.Header.Set("Accept", "application/json; charset=utf-8")
-	if c.BearerAuth != "" {
-		httpReq.Header.Set("Authorization", "Bearer "+c.BearerAuth)
-	}
-	for _, req := range requests {
-		for k, v := range req.Headers {
-			httpReq.Header.Set(k, v)
-		}
+	accept := "application/json; charset=utf-8"
+	if singleReq && (onChunk != nil || opt.incremental) {
+		accept = incrementalAccept
 	}
+	c.setHeaders(httpReq, contentType, accept, requests)
 
 	if c.Log != nil {
 		c.Log(fmt.Sprintf("%s %s %s, headers: %s, body: %s",
@@ -166,8 +270,20 @@ func (c *Client) Do(ctx context.Context, res interface{}, requests ...Request) e
 	}
 	defer httpResp.Body.Close()
 
-	savedBody, _ := ioutil.ReadAll(httpResp.Body)
+	mediaType, _, _ := mime.ParseMediaType(httpResp.Header.Get("Content-Type"))
+	if singleReq && mediaType == "multipart/mixed" && (c.NotCheckHTTPStatusCode200 || httpResp.StatusCode == http.StatusOK) {
+		return c.readIncremental(httpResp, res, onChunk)
+	}
+
+	savedBody, err := ioutil.ReadAll(httpResp.Body)
 	respJson := string(savedBody)
+	if err != nil {
+		return &DetailError{
+			OriginError: errors.Wrap(err, "read response"),
+			Content:     respJson,
+			Response:    httpResp,
+		}
+	}
 	if c.Log != nil {
 		c.Log(fmt.Sprintf("%s %s %s <Response %s>, headers: %s, body: %s",
 			httpReq.Method,
@@ -179,6 +295,11 @@ func (c *Client) Do(ctx context.Context, res interface{}, requests ...Request) e
 		))
 	}
 	if !c.NotCheckHTTPStatusCode200 && httpResp.StatusCode != http.StatusOK {
+		if singleReq {
+			setErrorResult(res, savedBody, httpResp)
+		} else {
+			setErrorResults(resList, savedBody, httpResp)
+		}
 		return &DetailError{
 			OriginError: errors.Errorf("unexpected HTTP response code: %d", httpResp.StatusCode),
 			Content:     respJson,
@@ -187,9 +308,7 @@ func (c *Client) Do(ctx context.Context, res interface{}, requests ...Request) e
 	}
 
 	if singleReq {
-		resp := response{
-			Data: res,
-		}
+		resp := rawResponse{}
 		if err := json.Unmarshal(savedBody, &resp); err != nil {
 			return &DetailError{
 				OriginError: err,
@@ -197,14 +316,23 @@ func (c *Client) Do(ctx context.Context, res interface{}, requests ...Request) e
 				Response:    httpResp,
 			}
 		}
+		if onChunk != nil {
+			if err := onChunk(resp.Data, resp.Errors, false); err != nil {
+				return err
+			}
+		}
+		if err := setResult(res, &resp, httpResp); err != nil {
+			return &DetailError{
+				OriginError: err,
+				Content:     respJson,
+				Response:    httpResp,
+			}
+		}
 		if len(resp.Errors) > 0 {
 			return GraphQLErrors(resp.Errors)
 		}
 	} else {
-		resp := make([]response, requestsLen)
-		for k, v := range resList {
-			resp[k].Data = v
-		}
+		resp := make([]rawResponse, requestsLen)
 		if err := json.Unmarshal(savedBody, &resp); err != nil {
 			return &DetailError{
 				OriginError: err,
@@ -212,26 +340,172 @@ func (c *Client) Do(ctx context.Context, res interface{}, requests ...Request) e
 				Response:    httpResp,
 			}
 		}
-		errs := make([]GraphQLError, 0)
-		for _, v := range resp {
-			if len(v.Errors) > 0 {
-				errs = append(errs, v.Errors...)
+		batchErr := &BatchError{Errors: make([]GraphQLErrors, requestsLen)}
+		failed := false
+		for k, v := range resp {
+			if k < len(resList) {
+				if err := setResult(resList[k], &v, httpResp); err != nil {
+					return &DetailError{
+						OriginError: err,
+						Content:     respJson,
+						Response:    httpResp,
+					}
+				}
+			}
+			if len(v.Errors) > 0 && k < requestsLen {
+				batchErr.Errors[k] = v.Errors
+				failed = true
 			}
 		}
-		if len(errs) > 0 {
-			return GraphQLErrors(errs)
+		if failed {
+			return batchErr
 		}
 	}
 
 	return nil
 }
 
+// getURL returns Endpoint with request in URL parameters, ok is false if URL is longer than MaxGETURLLength
+func (o *Option) getURL(req Request) (getURL string, ok bool) {
+	u, err := url.Parse(o.Endpoint)
+	if err != nil {
+		return "", false
+	}
+	params := u.Query()
+	if req.Query != "" {
+		params.Set("query", req.Query)
+	}
+	if len(req.Variables) > 0 {
+		variables, err := json.Marshal(req.Variables)
+		if err != nil {
+			return "", false
+		}
+		params.Set("variables", string(variables))
+	}
+	if req.OperationName != "" {
+		params.Set("operationName", req.OperationName)
+	}
+	if req.Extensions != nil {
+		extensions, err := json.Marshal(req.Extensions)
+		if err != nil {
+			return "", false
+		}
+		params.Set("extensions", string(extensions))
+	}
+	u.RawQuery = params.Encode()
+	getURL = u.String()
+	maxLength := o.MaxGETURLLength
+	if maxLength == 0 {
+		maxLength = 2048
+	}
+	return getURL, len(getURL) <= maxLength
+}
+
+// allowGET reports whether requests is a single query which can be sent by GET
+func (o *Option) allowGET(requests []Request) bool {
+	return o.UseGETForQueries && len(requests) == 1 &&
+		operationType(requests[0]) == "query"
+}
+
+// setHeaders sets http request options and headers
+func (o *Option) setHeaders(httpReq *http.Request, contentType, accept string, requests []Request) {
+	httpReq.Close = o.CloseBody
+	for k, v := range o.Headers {
+		httpReq.Header.Set(k, v)
+	}
+	if contentType != "" {
+		httpReq.Header.Set("Content-Type", contentType)
+	}
+	httpReq.Header.Set("Accept", accept)
+	if o.BearerAuth != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+o.BearerAuth)
+	}
+	for _, req := range requests {
+		for k, v := range req.Headers {
+			httpReq.Header.Set(k, v)
+		}
+	}
+}
+
+// newRequest creates http request of JSON body with headers of Option, requests' headers are applied at last
+func (o *Option) newRequest(ctx context.Context, method, endpoint string, body []byte, accept string, requests ...Request) (*http.Request, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, method, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	contentType := ""
+	if body != nil {
+		contentType = "application/json; charset=utf-8"
+	}
+	o.setHeaders(httpReq, contentType, accept, requests)
+	if o.Log != nil {
+		o.Log(fmt.Sprintf("%s %s %s, headers: %s, body: %s",
+			httpReq.Method,
+			httpReq.URL,
+			httpReq.Proto,
+			httpReq.Header,
+			string(body),
+		))
+	}
+	return httpReq, nil
+}
+
+// do returns DetailError if response status is not one of statusCodes
+func (o *Option) do(httpReq *http.Request, statusCodes ...int) (*http.Response, error) {
+	httpClient := o.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	for _, code := range statusCodes {
+		if resp.StatusCode == code {
+			return resp, nil
+		}
+	}
+	defer resp.Body.Close()
+	content, _ := ioutil.ReadAll(resp.Body)
+	return nil, &DetailError{
+		OriginError: errors.Errorf("unexpected HTTP response code: %d", resp.StatusCode),
+		Content:     string(content),
+		Response:    resp,
+	}
+}
+
+// subscriptionTransport returns Option.SubscriptionTransport, default is WebSocketClient
+func (c *Client) subscriptionTransport() SubscriptionTransport {
+	if c.SubscriptionTransport != nil {
+		return c.SubscriptionTransport
+	}
+	return c.WebSocketClient
+}
+
 func (c *Client) Subscribe(req Request, handler SubscriptionHandler) (id string, err error) {
-	return c.WebSocketClient.Subscribe(req, handler)
+	return c.SubscribeContext(context.Background(), req, handler)
+}
+
+func (c *Client) SubscribeContext(ctx context.Context, req Request, handler SubscriptionHandler) (id string, err error) {
+	if err := c.validate(req); err != nil {
+		return "", err
+	}
+	return c.subscriptionTransport().SubscribeContext(ctx, req, handler)
+}
+
+func (c *Client) SubscribeChan(req Request) (*Subscription, error) {
+	return c.SubscribeChanContext(context.Background(), req)
+}
+
+func (c *Client) SubscribeChanContext(ctx context.Context, req Request) (*Subscription, error) {
+	if err := c.validate(req); err != nil {
+		return nil, err
+	}
+	return c.subscriptionTransport().SubscribeChanContext(ctx, req)
 }
 
 func (c *Client) Unsubscribe(id string) error {
-	return c.WebSocketClient.Unsubscribe(id)
+	return c.subscriptionTransport().Unsubscribe(id)
 }
 
 func checkFileUpload(singleReq bool, requests []Request) (res map[io.Reader]*graphQLFileWithPath, err error) {
@@ -317,14 +591,79 @@ func getPath(singleReq bool, reqIndex int, varName string, fileIndex ...int) (re
 	return
 }
 
-type response struct {
-	Errors []GraphQLError `json:"errors,omitempty"`
-	Data   interface{}    `json:"data,omitempty"`
+// withExtension returns a copy of extensions with key set to value, extensions should be encoded as a JSON object
+func withExtension(extensions interface{}, key string, value interface{}) (map[string]interface{}, error) {
+	res := make(map[string]interface{})
+	switch ext := extensions.(type) {
+	case nil:
+	case map[string]interface{}:
+		for k, v := range ext {
+			res[k] = v
+		}
+	default:
+		j, err := json.Marshal(ext)
+		if err != nil {
+			return nil, errors.Wrap(err, "json encode extensions")
+		}
+		if err := json.Unmarshal(j, &res); err != nil {
+			return nil, errors.Wrap(err, "extensions should be a JSON object")
+		}
+		if res == nil {
+			res = make(map[string]interface{})
+		}
+	}
+	res[key] = value
+	return res, nil
 }
 
 type rawResponse struct {
-	Errors []GraphQLError  `json:"errors,omitempty"`
-	Data   json.RawMessage `json:"data,omitempty"`
+	Errors     []GraphQLError         `json:"errors,omitempty"`
+	Data       json.RawMessage        `json:"data,omitempty"`
+	Extensions map[string]interface{} `json:"extensions,omitempty"`
+}
+
+// setResult decodes resp into res, which is *Response or the target of data
+func setResult(res interface{}, resp *rawResponse, httpResp *http.Response) error {
+	if r, ok := res.(*Response); ok {
+		r.HasData = len(resp.Data) > 0 && string(resp.Data) != "null"
+		r.Errors = resp.Errors
+		r.Extensions = resp.Extensions
+		r.StatusCode = httpResp.StatusCode
+		r.Header = httpResp.Header
+		res = r.Data
+	}
+	if res == nil || len(resp.Data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(resp.Data, res)
+}
+
+// setErrorResult fills Response of non 200 response, with the errors and extensions if body is a GraphQL response
+func setErrorResult(res interface{}, body []byte, httpResp *http.Response) {
+	r, ok := res.(*Response)
+	if !ok {
+		return
+	}
+	resp := rawResponse{}
+	_ = json.Unmarshal(body, &resp)
+	_ = setResult(r, &resp, httpResp)
+}
+
+// setErrorResults fills Responses of batch like setErrorResult
+func setErrorResults(resList []interface{}, body []byte, httpResp *http.Response) {
+	var respList []rawResponse
+	_ = json.Unmarshal(body, &respList)
+	for k, res := range resList {
+		r, ok := res.(*Response)
+		if !ok {
+			continue
+		}
+		resp := rawResponse{}
+		if k < len(respList) {
+			resp = respList[k]
+		}
+		_ = setResult(r, &resp, httpResp)
+	}
 }
 
 type graphQLFileWithPath struct {
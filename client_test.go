@@ -1,9 +1,18 @@
 package gqlgo
 
 import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 
+	"github.com/pkg/errors"
+	"github.com/poohvpn/gqlgo/ast"
+	"github.com/poohvpn/gqlgo/introspection"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestGetPath(t *testing.T) {
@@ -14,3 +23,263 @@ func TestGetPath(t *testing.T) {
 	as.Equal("0.variables.var1", getPath(false, 0, "var1"))
 	as.Equal("1.variables.var1.1", getPath(false, 1, "var1", 1))
 }
+
+func TestOperationType(t *testing.T) {
+	as := assert.New(t)
+	as.Equal("query", operationType(Request{Query: `{a}`}))
+	as.Equal("query", operationType(Request{Query: `# mutation
+query Q($s: String = "mutation {") { a(s: """ mutation """) }`}))
+	as.Equal("mutation", operationType(Request{Query: `fragment F on Query { a } mutation M { b } query Q { ...F }`}))
+	as.Equal("query", operationType(Request{Query: `mutation M { b } query Q { ...F }`, OperationName: "Q"}))
+	as.Equal("subscription", operationType(Request{Query: `subscription S @live { a }`, OperationName: "S"}))
+	as.Equal("", operationType(Request{Query: `query Q { a }`, OperationName: "M"}))
+}
+
+func TestClientGET(t *testing.T) {
+	as := assert.New(t)
+	var methods []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		methods = append(methods, r.Method)
+		if r.Method == http.MethodGet {
+			as.Equal("", r.Header.Get("Content-Type"))
+			as.Equal("{a}", r.URL.Query().Get("query"))
+			as.JSONEq(`{"v":1}`, r.URL.Query().Get("variables"))
+		}
+		_, _ = w.Write([]byte(`{"data":{"a":1}}`))
+	}))
+	defer server.Close()
+	client := NewClient(server.URL, Option{UseGETForQueries: true})
+
+	ctx := context.Background()
+	as.NoError(client.Do(ctx, nil, Request{Query: "{a}", Variables: map[string]interface{}{"v": 1}}))
+	as.NoError(client.Do(ctx, nil, Request{Query: "mutation{a}"}))
+	as.NoError(client.Do(ctx, nil, Request{Query: "query{a}" + strings.Repeat(" ", 2048)}))
+	as.Equal([]string{http.MethodGet, http.MethodPost, http.MethodPost}, methods)
+}
+
+func TestClientMiddlewares(t *testing.T) {
+	as := assert.New(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		as.Equal("token", r.Header.Get("X-Auth"))
+		_, _ = w.Write([]byte(`{"data":{"a":1}}`))
+	}))
+	defer server.Close()
+	var calls []string
+	record := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return func(ctx context.Context, res interface{}, requests []Request) error {
+				calls = append(calls, name)
+				err := next(ctx, res, requests)
+				calls = append(calls, name+" done")
+				return err
+			}
+		}
+	}
+	auth := func(next Handler) Handler {
+		return func(ctx context.Context, res interface{}, requests []Request) error {
+			for i := range requests {
+				requests[i].Headers = map[string]string{"X-Auth": "token"}
+			}
+			return next(ctx, res, requests)
+		}
+	}
+	client := NewClient(server.URL, Option{
+		Middlewares: []Middleware{record("log"), auth, record("metrics")},
+	})
+
+	data := struct{ A int }{}
+	as.NoError(client.Do(context.Background(), &data, Request{Query: "{a}"}))
+	as.Equal(1, data.A)
+	as.Equal([]string{"log", "metrics", "metrics done", "log done"}, calls)
+}
+
+func TestClientResponse(t *testing.T) {
+	as := assert.New(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Trace", "1")
+		_, _ = w.Write([]byte(`{"data":{"a":1,"b":null},"errors":[{"message":"b failed","path":["b"]}],"extensions":{"cost":3}}`))
+	}))
+	defer server.Close()
+	client := NewClient(server.URL)
+
+	data := struct{ A int }{}
+	resp := &Response{Data: &data}
+	err := client.Do(context.Background(), resp, Request{Query: "{a b}"})
+	as.Equal(GraphQLErrors(resp.Errors), err)
+	as.True(resp.HasData)
+	as.Equal(1, data.A)
+	as.Equal("b failed", resp.Errors[0].Message)
+	as.Equal(float64(3), resp.Extensions["cost"])
+	as.Equal(http.StatusOK, resp.StatusCode)
+	as.Equal("1", resp.Header.Get("X-Trace"))
+}
+
+func TestClientResponseStatusError(t *testing.T) {
+	as := assert.New(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "5")
+		w.WriteHeader(http.StatusTooManyRequests)
+		_, _ = w.Write([]byte(`{"errors":[{"message":"rate limited"}],"extensions":{"cost":3}}`))
+	}))
+	defer server.Close()
+	client := NewClient(server.URL)
+
+	resp := &Response{}
+	err := client.Do(context.Background(), resp, Request{Query: "{a}"})
+	detailErr := &DetailError{}
+	require.True(t, errors.As(err, &detailErr))
+	as.False(resp.HasData)
+	as.Equal(GraphQLErrors{{Message: "rate limited"}}, resp.Errors)
+	as.Equal(float64(3), resp.Extensions["cost"])
+	as.Equal(http.StatusTooManyRequests, resp.StatusCode)
+	as.Equal("5", resp.Header.Get("Retry-After"))
+}
+
+func TestClientBatchError(t *testing.T) {
+	as := assert.New(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`[{"data":{"a":1}},{"data":null,"errors":[{"message":"b failed"}]}]`))
+	}))
+	defer server.Close()
+	client := NewClient(server.URL)
+
+	data1 := struct{ A int }{}
+	data2 := struct{ B int }{}
+	err := client.Do(context.Background(), []interface{}{&data1, &data2}, Request{Query: "{a}"}, Request{Query: "{b}"})
+	batchErr := &BatchError{}
+	require.True(t, errors.As(err, &batchErr))
+	as.NoError(batchErr.Err(0))
+	as.Equal(GraphQLErrors{{Message: "b failed"}}, batchErr.Err(1))
+	as.Equal(1, data1.A)
+
+	gqlErrs := GraphQLErrors{}
+	require.True(t, errors.As(err, &gqlErrs))
+	as.Equal(GraphQLErrors{{Message: "b failed"}}, gqlErrs)
+}
+
+func TestClientIntrospect(t *testing.T) {
+	as := assert.New(t)
+	var queries []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := Request{}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		queries = append(queries, req.Query)
+		as.Equal(introspection.OperationName, req.OperationName)
+		if r.URL.Path == "/old" && strings.Contains(req.Query, "isRepeatable") {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"errors":[{"message":"Cannot query field \"isRepeatable\" on type \"__Directive\"."}]}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"data":{"__schema":{"queryType":{"name":"Query"},"types":[
+			{"kind":"OBJECT","name":"Query","fields":[{"name":"a","args":[],"type":{"kind":"SCALAR","name":"Int"},"isDeprecated":false}]}
+		],"directives":[]}}}`))
+	}))
+	defer server.Close()
+
+	schema, err := NewClient(server.URL).Introspect(context.Background())
+	require.NoError(t, err)
+	as.Equal("Query", schema.QueryType.Name)
+	as.Equal("type Query {\n  a: Int\n}\n", schema.SDL())
+	as.Equal([]string{introspection.FullQuery}, queries)
+
+	// older server
+	queries = nil
+	schema, err = NewClient(server.URL + "/old").Introspect(context.Background())
+	require.NoError(t, err)
+	as.Equal("type Query {\n  a: Int\n}\n", schema.SDL())
+	as.Equal([]string{introspection.FullQuery, introspection.Query}, queries)
+}
+
+type validatorFunc func(req Request) error
+
+func (f validatorFunc) Validate(req Request) error {
+	return f(req)
+}
+
+func TestClientValidator(t *testing.T) {
+	as := assert.New(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"data":{"a":1}}`))
+	}))
+	defer server.Close()
+	invalid := GraphQLErrors{{Message: `Cannot query field "x" on type "Query".`, Locations: []GraphQLErrorLocation{{Line: 1, Column: 3}}}}
+	client := NewClient(server.URL, Option{
+		Validator: validatorFunc(func(req Request) error {
+			if strings.Contains(req.Query, "x") {
+				return invalid
+			}
+			return nil
+		}),
+	})
+
+	data := struct{ A int }{}
+	as.NoError(client.Do(context.Background(), &data, Request{Query: "{ a }"}))
+	as.Equal(1, data.A)
+	as.Equal(invalid, client.Do(context.Background(), &data, Request{Query: "{ x }"}))
+
+	err := client.Do(context.Background(), []interface{}{&data, &data}, Request{Query: "{ a }"}, Request{Query: "{ x }"})
+	batchErr := &BatchError{}
+	require.True(t, errors.As(err, &batchErr))
+	as.NoError(batchErr.Err(0))
+	as.Equal(invalid, batchErr.Err(1))
+
+	_, err = client.Subscribe(Request{Query: "subscription { x }"}, nil)
+	as.Equal(invalid, err)
+	_, err = client.SubscribeChan(Request{Query: "subscription { x }"})
+	as.Equal(invalid, err)
+}
+
+func TestClientParseOnce(t *testing.T) {
+	as := assert.New(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"data":{"a":1}}`))
+	}))
+	defer server.Close()
+	var docs []*ast.Document
+	document := func(req Request) {
+		doc, err := req.Document()
+		as.NoError(err)
+		docs = append(docs, doc)
+	}
+	client := NewClient(server.URL, Option{
+		Validator: validatorFunc(func(req Request) error {
+			document(req)
+			return nil
+		}),
+		Middlewares: []Middleware{func(next Handler) Handler {
+			return func(ctx context.Context, res interface{}, requests []Request) error {
+				document(requests[0])
+				if requests[0].OperationName == "B" {
+					requests[0].Query = "query B { b }"
+				}
+				document(requests[0])
+				return next(ctx, res, requests)
+			}
+		}},
+	})
+
+	req := Request{Query: "query A { a }", OperationName: "A"}
+	as.NoError(client.Do(context.Background(), nil, req))
+	as.Len(docs, 3)
+	as.True(docs[0] == docs[1] && docs[1] == docs[2])
+	as.Nil(req.parsed)
+
+	// changed query is parsed again
+	docs = nil
+	as.NoError(client.Do(context.Background(), nil, Request{Query: "query A { a }", OperationName: "B"}))
+	as.Len(docs, 3)
+	as.True(docs[0] == docs[1])
+	as.False(docs[1] == docs[2])
+	as.Equal("b", docs[2].Operations[0].SelectionSet[0].(*ast.Field).Name)
+
+	// not parsed if no one needs the document
+	var sent Request
+	client = NewClient(server.URL, Option{Middlewares: []Middleware{func(next Handler) Handler {
+		return func(ctx context.Context, res interface{}, requests []Request) error {
+			sent = requests[0]
+			return next(ctx, res, requests)
+		}
+	}}})
+	as.NoError(client.Do(context.Background(), nil, Request{Query: "query A { a }"}))
+	as.Nil(sent.parsed.doc)
+}
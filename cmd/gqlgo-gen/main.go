@@ -0,0 +1,134 @@
+// Command gqlgo-gen generates typed Go code calling gqlgo.Client from .graphql operation files.
+//
+// Usage:
+//
+//	gqlgo-gen -schema schema.graphql -queries ./queries -out ./graphql/gqlgo_gen.go -scalar DateTime=time.Time
+//
+// Schema is SDL, introspection JSON if it ends with .json, or the endpoint to introspect if it starts with http:// or https://.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/poohvpn/gqlgo"
+	"github.com/poohvpn/gqlgo/codegen"
+	"github.com/poohvpn/gqlgo/introspection"
+	"github.com/poohvpn/gqlgo/validator"
+)
+
+// scalarFlag collects -scalar Name=GoType
+type scalarFlag map[string]string
+
+func (f scalarFlag) String() string {
+	var pairs []string
+	for name, typ := range f {
+		pairs = append(pairs, name+"="+typ)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (f scalarFlag) Set(s string) error {
+	i := strings.Index(s, "=")
+	if i <= 0 || i == len(s)-1 {
+		return errors.Errorf("scalar mapping %q should be like DateTime=time.Time", s)
+	}
+	f[s[:i]] = s[i+1:]
+	return nil
+}
+
+func main() {
+	scalars := scalarFlag{}
+	schemaPath := flag.String("schema", "", "schema file of SDL or introspection JSON, or GraphQL endpoint to introspect")
+	queriesDir := flag.String("queries", ".", "directory of .graphql files containing operations and fragments")
+	out := flag.String("out", "gqlgo_gen.go", "output Go file")
+	pkg := flag.String("package", "", "package name of output, default is the name of output directory")
+	flag.Var(scalars, "scalar", "map custom scalar to Go type like DateTime=time.Time, can be repeated")
+	flag.Parse()
+
+	if err := run(*schemaPath, *queriesDir, *out, *pkg, scalars); err != nil {
+		fmt.Fprintln(os.Stderr, "gqlgo-gen:", err)
+		os.Exit(1)
+	}
+}
+
+func run(schemaPath, queriesDir, out, pkg string, scalars map[string]string) error {
+	if schemaPath == "" {
+		return errors.New("-schema is required")
+	}
+	schema, err := loadSchema(schemaPath)
+	if err != nil {
+		return err
+	}
+	sources, err := loadSources(queriesDir, schemaPath)
+	if err != nil {
+		return err
+	}
+	if pkg == "" {
+		dir, err := filepath.Abs(filepath.Dir(out))
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		pkg = strings.NewReplacer("-", "", ".", "").Replace(filepath.Base(dir))
+	}
+	code, err := codegen.Generate(schema, sources, codegen.Config{
+		Package: pkg,
+		Scalars: scalars,
+	})
+	if err != nil {
+		return err
+	}
+	return errors.Wrap(ioutil.WriteFile(out, code, 0644), "write output")
+}
+
+func loadSchema(path string) (*introspection.Schema, error) {
+	if strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://") {
+		schema, err := gqlgo.NewClient(path).Introspect(context.Background())
+		return schema, errors.Wrap(err, "introspect schema")
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "read schema")
+	}
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		return validator.LoadIntrospection(data)
+	}
+	return validator.LoadSDL(string(data))
+}
+
+// loadSources reads .graphql and .gql files in dir recursively, except the schema file
+func loadSources(dir, schemaPath string) ([]codegen.Source, error) {
+	schemaAbs, _ := filepath.Abs(schemaPath)
+	var sources []codegen.Source
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		ext := strings.ToLower(filepath.Ext(path))
+		if info.IsDir() || ext != ".graphql" && ext != ".gql" {
+			return nil
+		}
+		if abs, _ := filepath.Abs(path); abs == schemaAbs {
+			return nil
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		sources = append(sources, codegen.Source{Name: path, Query: string(data)})
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "read queries")
+	}
+	if len(sources) == 0 {
+		return nil, errors.Errorf("no .graphql file in %s", dir)
+	}
+	return sources, nil
+}
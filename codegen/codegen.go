@@ -0,0 +1,571 @@
+// Package codegen generates typed Go code calling gqlgo.Client from GraphQL operations, it's used by cmd/gqlgo-gen
+package codegen
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/poohvpn/gqlgo/ast"
+	"github.com/poohvpn/gqlgo/introspection"
+	"github.com/poohvpn/gqlgo/validator"
+)
+
+const gqlgoPackage = "github.com/poohvpn/gqlgo"
+
+// Source is a file of GraphQL operations and fragments, fragments can be used by operations of other sources
+type Source struct {
+	Name  string
+	Query string
+}
+
+type Config struct {
+	// Package is the package name of generated code
+	Package string
+
+	// Scalars maps custom scalar to Go type like "time.Time" or "github.com/google/uuid.UUID".
+	// Upload is mapped to gqlgo.File by default, other scalars not mapped are json.RawMessage
+	Scalars map[string]string
+}
+
+var builtinScalars = map[string]string{
+	"Int":     "int",
+	"Float":   "float64",
+	"String":  "string",
+	"Boolean": "bool",
+	"ID":      "string",
+}
+
+type generator struct {
+	Config
+	schema  *introspection.Schema
+	types   map[string]*introspection.Type
+	doc     *ast.Document
+	imports map[string]bool
+	// names is the Go names of operations, results, enums and input objects, which are declared already
+	names map[string]bool
+	// locate formats the location in sources, op is the operation being generated,
+	// err is the first name collision of enums and input objects used by op
+	locate func(loc ast.Location) string
+	op     *ast.OperationDefinition
+	err    error
+
+	operations bytes.Buffer
+
+	// code of enums and input objects used by operations, by type name
+	enums  map[string]string
+	inputs map[string]string
+}
+
+// Generate validates operations of sources against schema, and returns the formatted Go code of them.
+// For every named operation, it generates result type, variables type and a function calling Client.Do or Client.SubscribeContext.
+func Generate(schema *introspection.Schema, sources []Source, cfg Config) ([]byte, error) {
+	if cfg.Package == "" {
+		return nil, errors.New("package name is required")
+	}
+	doc, locate, err := parseSources(schema, sources)
+	if err != nil {
+		return nil, err
+	}
+	g := &generator{
+		Config:  cfg,
+		schema:  schema,
+		types:   make(map[string]*introspection.Type),
+		doc:     doc,
+		locate:  locate,
+		imports: make(map[string]bool),
+		names:   make(map[string]bool),
+		enums:   make(map[string]string),
+		inputs:  make(map[string]string),
+	}
+	for i := range schema.Types {
+		g.types[schema.Types[i].Name] = &schema.Types[i]
+	}
+	for _, op := range doc.Operations {
+		g.op = op
+		if err := g.operation(op); err != nil {
+			return nil, err
+		}
+		if g.err != nil {
+			return nil, g.err
+		}
+	}
+	return g.file()
+}
+
+// parseSources parses and validates sources as a single document, errors are located in the source files
+func parseSources(schema *introspection.Schema, sources []Source) (*ast.Document, func(ast.Location) string, error) {
+	var starts []int
+	line := 1
+	queries := make([]string, len(sources))
+	for i, src := range sources {
+		starts = append(starts, line)
+		queries[i] = src.Query
+		line += strings.Count(src.Query, "\n") + 1
+	}
+	locate := func(loc ast.Location) string {
+		i := sort.Search(len(starts), func(i int) bool { return starts[i] > loc.Line }) - 1
+		if i < 0 {
+			return fmt.Sprintf("%d:%d", loc.Line, loc.Column)
+		}
+		return fmt.Sprintf("%s:%d:%d", sources[i].Name, loc.Line-starts[i]+1, loc.Column)
+	}
+
+	doc, err := ast.Parse(strings.Join(queries, "\n"))
+	if err != nil {
+		syntaxErr := &ast.SyntaxError{}
+		if errors.As(err, &syntaxErr) {
+			return nil, nil, errors.Errorf("%s: Syntax Error: %s", locate(syntaxErr.Loc), syntaxErr.Message)
+		}
+		return nil, nil, err
+	}
+	var msgs []string
+	for _, gqlErr := range validator.New(schema).ValidateDocument(doc) {
+		if len(gqlErr.Locations) == 0 {
+			msgs = append(msgs, gqlErr.Message)
+			continue
+		}
+		loc := gqlErr.Locations[0]
+		msgs = append(msgs, locate(ast.Location{Line: loc.Line, Column: loc.Column})+": "+gqlErr.Message)
+	}
+	for _, op := range doc.Operations {
+		if op.Name == "" {
+			msgs = append(msgs, locate(op.Loc)+": operation without name can't be generated")
+		}
+	}
+	if len(msgs) > 0 {
+		return nil, nil, errors.New(strings.Join(msgs, "\n"))
+	}
+	return doc, locate, nil
+}
+
+func (g *generator) operation(op *ast.OperationDefinition) error {
+	var root *introspection.TypeName
+	switch op.Operation {
+	case ast.Query:
+		root = g.schema.QueryType
+	case ast.Mutation:
+		root = g.schema.MutationType
+	case ast.Subscription:
+		root = g.schema.SubscriptionType
+	}
+	if root == nil || g.types[root.Name] == nil {
+		return errors.Errorf("schema doesn't support %s of operation %s", op.Operation, op.Name)
+	}
+
+	name := goName(op.Name)
+	for _, suffix := range []string{"", "Result", "Variables", "Handler"} {
+		if g.names[name+suffix] {
+			return errors.Errorf("%s of operation %s is declared already", name+suffix, op.Name)
+		}
+		g.names[name+suffix] = true
+	}
+	queryName := lowerName(op.Name) + "Query"
+	g.imports["context"] = true
+	g.imports[gqlgoPackage] = true
+	g.printf("const %s = %s\n\n", queryName, goString(printOperation(g.doc, op)))
+
+	resultName := name + "Result"
+	g.result(resultName, fmt.Sprintf("%s is the data of %s %s", resultName, op.Operation, op.Name),
+		[]selection{{set: op.SelectionSet, parent: g.types[root.Name]}})
+
+	params := "ctx context.Context, client *gqlgo.Client"
+	request := fmt.Sprintf("gqlgo.Request{\n\t\tQuery: %s,\n\t\tOperationName: %q,\n", queryName, op.Name)
+	if len(op.VariableDefinitions) > 0 {
+		varsName := name + "Variables"
+		if err := g.variables(varsName, op); err != nil {
+			return err
+		}
+		params += ", vars " + varsName
+		request += "\t\tVariables: vars.variables(),\n"
+	}
+	request += "\t}"
+
+	if op.Operation == ast.Subscription {
+		g.imports["encoding/json"] = true
+		handlerName := name + "Handler"
+		g.printf("// %s is called with every result of subscription %s, data is nil if completed\n", handlerName, op.Name)
+		g.printf("type %s func(data *%s, gqlErrs gqlgo.GraphQLErrors, completed bool) error\n\n", handlerName, resultName)
+		g.printf("// %s subscribes %s by Client.SubscribeContext\n", name, op.Name)
+		g.printf("func %s(%s, handler %s) (id string, err error) {\n", name, params, handlerName)
+		g.printf("\treturn client.SubscribeContext(ctx, %s, func(rawMsg json.RawMessage, gqlErrs gqlgo.GraphQLErrors, completed bool) error {\n", request)
+		g.printf("\t\tif completed || len(rawMsg) == 0 {\n\t\t\treturn handler(nil, gqlErrs, completed)\n\t\t}\n")
+		g.printf("\t\tdata := &%s{}\n", resultName)
+		g.printf("\t\tif err := json.Unmarshal(rawMsg, data); err != nil {\n\t\t\treturn err\n\t\t}\n")
+		g.printf("\t\treturn handler(data, gqlErrs, completed)\n\t})\n}\n\n")
+		return nil
+	}
+	g.printf("// %s sends %s %s by Client.Do, result is returned with error for partial data\n", name, op.Operation, op.Name)
+	g.printf("func %s(%s) (*%s, error) {\n", name, params, resultName)
+	g.printf("\tres := &%s{}\n", resultName)
+	g.printf("\terr := client.Do(ctx, res, %s)\n", request)
+	g.printf("\treturn res, err\n}\n\n")
+	return nil
+}
+
+// selection is a selection set on parent type
+type selection struct {
+	set    ast.SelectionSet
+	parent *introspection.Type
+}
+
+// resultField merges the fields of the same response key, including the ones in fragments
+type resultField struct {
+	key        string
+	def        *introspection.Field
+	selections []selection
+}
+
+// result writes the struct of merged selections, and the structs of its composite fields named after it
+func (g *generator) result(name, comment string, selections []selection) {
+	fields := g.collectFields(selections)
+	type nested struct {
+		name, path string
+		selections []selection
+	}
+	var nestedTypes []nested
+	g.printf("// %s\ntype %s struct {\n", comment, name)
+	for _, field := range fields {
+		t := g.types[field.def.Type.NamedType()]
+		object := ""
+		if t != nil && (t.Kind == introspection.KindObject || t.Kind == introspection.KindInterface || t.Kind == introspection.KindUnion) {
+			object = g.uniqueName(name + goName(field.key))
+			nestedTypes = append(nestedTypes, nested{name: object, path: field.key, selections: field.selections})
+		}
+		g.printf("\t%s %s `json:%q`\n", goName(field.key), g.goType(&field.def.Type, object), field.key)
+	}
+	g.printf("}\n\n")
+	for _, n := range nestedTypes {
+		g.result(n.name, fmt.Sprintf("%s is the type of field %s of %s", n.name, n.path, name), n.selections)
+	}
+}
+
+// uniqueName returns name, or name with number suffix if it's declared already, like UserPosts2 for user.posts and userPosts
+func (g *generator) uniqueName(name string) string {
+	unique := name
+	for i := 2; g.names[unique]; i++ {
+		unique = fmt.Sprint(name, i)
+	}
+	g.names[unique] = true
+	return unique
+}
+
+// collectFields merges fields of selections by response key in order of appearance, fragments are expanded
+func (g *generator) collectFields(selections []selection) []*resultField {
+	var fields []*resultField
+	byKey := make(map[string]*resultField)
+	var collect func(set ast.SelectionSet, parent *introspection.Type)
+	collect = func(set ast.SelectionSet, parent *introspection.Type) {
+		for _, s := range set {
+			switch s := s.(type) {
+			case *ast.Field:
+				key := s.ResponseKey()
+				field := byKey[key]
+				if field == nil {
+					field = &resultField{key: key, def: g.fieldDef(parent, s.Name)}
+					byKey[key] = field
+					fields = append(fields, field)
+				}
+				if len(s.SelectionSet) > 0 {
+					field.selections = append(field.selections, selection{
+						set:    s.SelectionSet,
+						parent: g.types[g.fieldDef(parent, s.Name).Type.NamedType()],
+					})
+				}
+			case *ast.InlineFragment:
+				t := parent
+				if s.TypeCondition != "" {
+					t = g.types[s.TypeCondition]
+				}
+				collect(s.SelectionSet, t)
+			case *ast.FragmentSpread:
+				fragment := g.doc.Fragment(s.Name)
+				collect(fragment.SelectionSet, g.types[fragment.TypeCondition])
+			}
+		}
+	}
+	for _, s := range selections {
+		collect(s.set, s.parent)
+	}
+	return fields
+}
+
+// fieldDef returns the field of parent including meta fields, document is validated so it's always found
+func (g *generator) fieldDef(parent *introspection.Type, name string) *introspection.Field {
+	switch name {
+	case "__typename":
+		return &introspection.Field{Name: name, Type: introspection.TypeRef{
+			Kind: introspection.KindNonNull, OfType: &introspection.TypeRef{Kind: introspection.KindScalar, Name: "String"},
+		}}
+	case "__schema":
+		return &introspection.Field{Name: name, Type: introspection.TypeRef{
+			Kind: introspection.KindNonNull, OfType: &introspection.TypeRef{Kind: introspection.KindObject, Name: "__Schema"},
+		}}
+	case "__type":
+		return &introspection.Field{Name: name, Type: introspection.TypeRef{Kind: introspection.KindObject, Name: "__Type"}}
+	}
+	return parent.Field(name)
+}
+
+// variables writes the struct of variables of op, and its method building Request.Variables
+func (g *generator) variables(name string, op *ast.OperationDefinition) error {
+	type variable struct {
+		name, goName, goType string
+		optional             bool
+	}
+	var vars []variable
+	for _, def := range op.VariableDefinitions {
+		ref, ok := introspection.ParseTypeRef(def.Type.String())
+		if !ok {
+			return errors.Errorf("invalid type %s of variable $%s", def.Type, def.Variable)
+		}
+		optional := ref.Kind != introspection.KindNonNull || def.DefaultValue != nil
+		vars = append(vars, variable{
+			name:     def.Variable,
+			goName:   goName(def.Variable),
+			goType:   optionalType(g.goType(ref, ""), optional),
+			optional: optional,
+		})
+	}
+
+	g.printf("// %s are the variables of %s %s, nil of optional variable is not sent\n", name, op.Operation, op.Name)
+	g.printf("type %s struct {\n", name)
+	for _, v := range vars {
+		tag := v.name
+		if v.optional {
+			tag += ",omitempty"
+		}
+		g.printf("\t%s %s `json:%q`\n", v.goName, v.goType, tag)
+	}
+	g.printf("}\n\n")
+	g.printf("func (v %s) variables() map[string]interface{} {\n", name)
+	g.printf("\tvariables := map[string]interface{}{\n")
+	for _, v := range vars {
+		if !v.optional {
+			g.printf("\t\t%q: v.%s,\n", v.name, v.goName)
+		}
+	}
+	g.printf("\t}\n")
+	for _, v := range vars {
+		if v.optional {
+			g.printf("\tif v.%s != nil {\n\t\tvariables[%q] = v.%s\n\t}\n", v.goName, v.name, v.goName)
+		}
+	}
+	g.printf("\treturn variables\n}\n\n")
+	return nil
+}
+
+// goType returns Go type of ref, nullable type is pointer or slice, object is the name of struct for composite type
+func (g *generator) goType(ref *introspection.TypeRef, object string) string {
+	nonNull := ref.Kind == introspection.KindNonNull
+	if nonNull {
+		ref = ref.OfType
+	}
+	if ref.Kind == introspection.KindList {
+		return "[]" + g.goType(ref.OfType, object)
+	}
+	typ := object
+	if t := g.types[ref.Name]; t != nil {
+		switch t.Kind {
+		case introspection.KindScalar:
+			typ = g.scalar(t.Name)
+		case introspection.KindEnum:
+			typ = g.enum(t)
+		case introspection.KindInputObject:
+			typ = g.input(t)
+		}
+	}
+	return optionalType(typ, !nonNull)
+}
+
+func optionalType(typ string, optional bool) string {
+	if !optional || typ == "json.RawMessage" || strings.HasPrefix(typ, "*") || strings.HasPrefix(typ, "[]") {
+		return typ
+	}
+	return "*" + typ
+}
+
+// scalar returns the Go type of scalar, the package of mapped type is imported
+func (g *generator) scalar(name string) string {
+	mapped, ok := g.Scalars[name]
+	switch {
+	case ok:
+	case builtinScalars[name] != "":
+		return builtinScalars[name]
+	case name == "Upload":
+		mapped = gqlgoPackage + ".File"
+	default:
+		g.imports["encoding/json"] = true
+		return "json.RawMessage"
+	}
+	prefix := ""
+	for strings.HasPrefix(mapped, "*") || strings.HasPrefix(mapped, "[]") {
+		if mapped[0] == '*' {
+			prefix, mapped = prefix+"*", mapped[1:]
+		} else {
+			prefix, mapped = prefix+"[]", mapped[2:]
+		}
+	}
+	dot := strings.LastIndex(mapped, ".")
+	if dot < 0 {
+		return prefix + mapped
+	}
+	path := mapped[:dot]
+	g.imports[path] = true
+	return prefix + path[strings.LastIndex(path, "/")+1:] + mapped[dot:]
+}
+
+// enum writes the enum type once, and returns its Go name
+func (g *generator) enum(t *introspection.Type) string {
+	name := goName(t.Name)
+	if _, ok := g.enums[t.Name]; ok {
+		return name
+	}
+	names := []string{name}
+	for _, value := range t.EnumValues {
+		names = append(names, name+goName(value.Name))
+	}
+	g.reserve("enum", t.Name, names...)
+	b := &bytes.Buffer{}
+	writeDescription(b, name, "enum", t)
+	fmt.Fprintf(b, "type %s string\n\nconst (\n", name)
+	for _, value := range t.EnumValues {
+		writeComment(b, "\t", value.Description)
+		if value.IsDeprecated {
+			fmt.Fprintf(b, "\t// Deprecated: %s\n", value.DeprecationReason)
+		}
+		fmt.Fprintf(b, "\t%s %s = %q\n", name+goName(value.Name), name, value.Name)
+	}
+	b.WriteString(")\n\n")
+	g.enums[t.Name] = b.String()
+	return name
+}
+
+// reserve declares names of enum or input object typeName, the first collision is kept in err
+func (g *generator) reserve(kind, typeName string, names ...string) {
+	for _, name := range names {
+		if g.names[name] && g.err == nil {
+			g.err = errors.Errorf("%s: %s of %s %s is declared already", g.locate(g.op.Loc), name, kind, typeName)
+		}
+		g.names[name] = true
+	}
+}
+
+// input writes the struct of input object once, and returns its Go name
+func (g *generator) input(t *introspection.Type) string {
+	name := goName(t.Name)
+	if _, ok := g.inputs[t.Name]; ok {
+		return name
+	}
+	// set before writing fields, input object can refer itself
+	g.inputs[t.Name] = ""
+	g.reserve("input object", t.Name, name)
+	b := &bytes.Buffer{}
+	writeDescription(b, name, "input object", t)
+	fmt.Fprintf(b, "type %s struct {\n", name)
+	for _, field := range t.InputFields {
+		optional := field.Type.Kind != introspection.KindNonNull || field.DefaultValue != nil
+		tag := field.Name
+		if optional {
+			tag += ",omitempty"
+		}
+		writeComment(b, "\t", field.Description)
+		if field.IsDeprecated {
+			fmt.Fprintf(b, "\t// Deprecated: %s\n", field.DeprecationReason)
+		}
+		fmt.Fprintf(b, "\t%s %s `json:%q`\n", goName(field.Name), optionalType(g.goType(&field.Type, ""), optional), tag)
+	}
+	b.WriteString("}\n\n")
+	g.inputs[t.Name] = b.String()
+	return name
+}
+
+// file puts imports, enums, input objects and operations together, and formats it
+func (g *generator) file() ([]byte, error) {
+	b := &bytes.Buffer{}
+	fmt.Fprintf(b, "// Code generated by gqlgo-gen, DO NOT EDIT.\n\npackage %s\n\n", g.Package)
+	if len(g.imports) > 0 {
+		// standard packages are grouped before others
+		var std, others []string
+		for _, path := range sortedKeys(g.imports) {
+			if strings.Contains(strings.Split(path, "/")[0], ".") {
+				others = append(others, path)
+			} else {
+				std = append(std, path)
+			}
+		}
+		b.WriteString("import (\n")
+		for _, path := range std {
+			fmt.Fprintf(b, "\t%q\n", path)
+		}
+		if len(std) > 0 && len(others) > 0 {
+			b.WriteString("\n")
+		}
+		for _, path := range others {
+			fmt.Fprintf(b, "\t%q\n", path)
+		}
+		b.WriteString(")\n\n")
+	}
+	for _, name := range sortedKeys(g.enums) {
+		b.WriteString(g.enums[name])
+	}
+	for _, name := range sortedKeys(g.inputs) {
+		b.WriteString(g.inputs[name])
+	}
+	b.Write(g.operations.Bytes())
+	res, err := format.Source(b.Bytes())
+	if err != nil {
+		return nil, errors.Wrap(err, "format generated code")
+	}
+	return res, nil
+}
+
+func (g *generator) printf(format string, a ...interface{}) {
+	fmt.Fprintf(&g.operations, format, a...)
+}
+
+// writeDescription writes the doc comment of type t generated as name
+func writeDescription(b *bytes.Buffer, name, kind string, t *introspection.Type) {
+	fmt.Fprintf(b, "// %s is the %s %s of schema\n", name, kind, t.Name)
+	if t.Description != "" {
+		b.WriteString("//\n")
+		writeComment(b, "", t.Description)
+	}
+}
+
+func writeComment(b *bytes.Buffer, indent, comment string) {
+	if comment == "" {
+		return
+	}
+	for _, line := range strings.Split(comment, "\n") {
+		fmt.Fprintf(b, "%s// %s\n", indent, line)
+	}
+}
+
+// goString returns raw string literal of s if possible, it's more readable for query
+func goString(s string) string {
+	if strings.Contains(s, "`") {
+		return strconv.Quote(s)
+	}
+	return "`\n" + s + "\n`"
+}
+
+func sortedKeys(m interface{}) []string {
+	var keys []string
+	switch m := m.(type) {
+	case map[string]bool:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	case map[string]string:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
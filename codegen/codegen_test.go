@@ -0,0 +1,125 @@
+package codegen
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/poohvpn/gqlgo/introspection"
+	"github.com/poohvpn/gqlgo/validator"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var update = flag.Bool("update", false, "update golden files of testdata")
+
+func testSchema(t *testing.T) *introspection.Schema {
+	sdl, err := ioutil.ReadFile("testdata/schema.graphql")
+	require.NoError(t, err)
+	schema, err := validator.LoadSDL(string(sdl))
+	require.NoError(t, err)
+	return schema
+}
+
+func TestGenerate(t *testing.T) {
+	var sources []Source
+	for _, name := range []string{"fragments.graphql", "names.graphql", "user.graphql"} {
+		query, err := ioutil.ReadFile(filepath.Join("testdata/queries", name))
+		require.NoError(t, err)
+		sources = append(sources, Source{Name: name, Query: string(query)})
+	}
+	code, err := Generate(testSchema(t), sources, Config{
+		Package: "graphql",
+		Scalars: map[string]string{"DateTime": "time.Time"},
+	})
+	require.NoError(t, err)
+
+	golden := "testdata/gqlgo_gen.go.golden"
+	if *update {
+		require.NoError(t, ioutil.WriteFile(golden, code, 0644))
+	}
+	expected, err := ioutil.ReadFile(golden)
+	require.NoError(t, err)
+	assert.Equal(t, string(expected), string(code))
+	testBuild(t, code)
+}
+
+// testBuild builds the generated code in a temporary module outside the source tree,
+// which requires this module replaced by its root directory
+func testBuild(t *testing.T, code []byte) {
+	goCmd, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go command not found")
+	}
+	root, err := filepath.Abs("..")
+	require.NoError(t, err)
+	goSum, err := ioutil.ReadFile(filepath.Join(root, "go.sum"))
+	require.NoError(t, err)
+	goMod := fmt.Sprintf("module build\n\ngo 1.14\n\nrequire github.com/poohvpn/gqlgo v0.0.0\n\nreplace github.com/poohvpn/gqlgo => %s\n", strconv.Quote(root))
+
+	dir, err := ioutil.TempDir("", "gqlgo-gen")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "go.mod"), []byte(goMod), 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "go.sum"), goSum, 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "gqlgo_gen.go"), code, 0644))
+	cmd := exec.Command(goCmd, "build", "-mod=mod", "-o", os.DevNull, ".")
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	require.NoError(t, err, string(out))
+}
+
+func TestGenerateErrors(t *testing.T) {
+	schema := testSchema(t)
+	for expected, sources := range map[string][]Source{
+		`b.graphql:2:22: Cannot query field "x" on type "User".`: {
+			{Name: "a.graphql", Query: "fragment F on User {\n  id\n}"},
+			{Name: "b.graphql", Query: "query Q {\n  user(id: 1) { ...F x }\n}"},
+		},
+		`a.graphql:1:1: operation without name can't be generated`: {
+			{Name: "a.graphql", Query: "{ user(id: 1) { id } }"},
+		},
+		`QResult of operation QResult_ is declared already`: {
+			{Name: "a.graphql", Query: "query Q { user(id: 1) { id } }\nquery QResult_ { user(id: 1) { id } }"},
+		},
+		`a.graphql:1:1: Role of enum Role is declared already`: {
+			{Name: "a.graphql", Query: "query Role($r: Role!) { users(filter: {role: $r}) { id } }"},
+		},
+		`a.graphql:2:1: RoleAdmin of enum Role is declared already`: {
+			{Name: "a.graphql", Query: "query RoleAdmin { user(id: 1) { id } }\nquery Users { user(id: 1) { role } }"},
+		},
+		`a.graphql:1:1: UserFilter of input object UserFilter is declared already`: {
+			{Name: "a.graphql", Query: "query UserFilter($f: UserFilter) { users(filter: $f) { id } }"},
+		},
+		`b.graphql:1:8: Syntax Error: Expected Name, found {`: {
+			{Name: "a.graphql", Query: "query A { user(id: 1) { id } }\n"},
+			{Name: "b.graphql", Query: "query {{ }"},
+		},
+	} {
+		_, err := Generate(schema, sources, Config{Package: "graphql"})
+		assert.EqualError(t, err, expected)
+	}
+}
+
+func TestGoName(t *testing.T) {
+	for name, expected := range map[string]string{
+		"id":          "ID",
+		"userId":      "UserID",
+		"user_id":     "UserID",
+		"GUEST_USER":  "GuestUser",
+		"__typename":  "Typename",
+		"HTTPServer":  "HTTPServer",
+		"createdAt":   "CreatedAt",
+		"upload_file": "UploadFile",
+		"v2":          "V2",
+	} {
+		assert.Equal(t, expected, goName(name), name)
+	}
+	assert.Equal(t, "getUser", lowerName("GetUser"))
+	assert.Equal(t, "idCard", lowerName("IDCard"))
+}
@@ -0,0 +1,80 @@
+package codegen
+
+import (
+	"strings"
+	"unicode"
+)
+
+// initialisms are kept upper case in Go names, like userId to UserID
+var initialisms = map[string]bool{
+	"API":   true,
+	"CPU":   true,
+	"CSS":   true,
+	"DNS":   true,
+	"HTML":  true,
+	"HTTP":  true,
+	"HTTPS": true,
+	"ID":    true,
+	"IP":    true,
+	"JSON":  true,
+	"SQL":   true,
+	"TCP":   true,
+	"TTL":   true,
+	"UDP":   true,
+	"URI":   true,
+	"URL":   true,
+	"UUID":  true,
+	"XML":   true,
+}
+
+// goName converts GraphQL name to exported Go name, like user_id or userId to UserID and ADMIN_USER to AdminUser
+func goName(name string) string {
+	b := &strings.Builder{}
+	for _, word := range splitWords(name) {
+		upper := strings.ToUpper(word)
+		if initialisms[upper] {
+			b.WriteString(upper)
+			continue
+		}
+		runes := []rune(strings.ToLower(word))
+		runes[0] = unicode.ToUpper(runes[0])
+		b.WriteString(string(runes))
+	}
+	res := b.String()
+	if res == "" || unicode.IsDigit([]rune(res)[0]) {
+		res = "X" + res
+	}
+	return res
+}
+
+// lowerName is goName with the first word in lower case, for unexported Go name
+func lowerName(name string) string {
+	res := goName(name)
+	words := splitWords(res)
+	first := words[0]
+	return strings.ToLower(first) + res[len(first):]
+}
+
+// splitWords splits name by underscores and case changes, HTTPServer is split to HTTP and Server
+func splitWords(name string) []string {
+	var words []string
+	runes := []rune(name)
+	start := 0
+	for i := 0; i <= len(runes); i++ {
+		switch {
+		case i == len(runes) || runes[i] == '_':
+		case i > start && unicode.IsUpper(runes[i]) &&
+			(!unicode.IsUpper(runes[i-1]) || i+1 < len(runes) && unicode.IsLower(runes[i+1])):
+		default:
+			continue
+		}
+		if i > start {
+			words = append(words, string(runes[start:i]))
+		}
+		start = i
+		if i < len(runes) && runes[i] == '_' {
+			start = i + 1
+		}
+	}
+	return words
+}
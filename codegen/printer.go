@@ -0,0 +1,125 @@
+package codegen
+
+import (
+	"strings"
+
+	"github.com/poohvpn/gqlgo/ast"
+)
+
+// printer writes definitions of executable document in GraphQL syntax, indented by two spaces
+type printer struct {
+	strings.Builder
+	indent int
+}
+
+// printOperation returns the query of op with the fragments it uses, which are looked up in doc
+func printOperation(doc *ast.Document, op *ast.OperationDefinition) string {
+	p := &printer{}
+	p.WriteString(string(op.Operation))
+	if op.Name != "" {
+		p.WriteString(" " + op.Name)
+	}
+	if len(op.VariableDefinitions) > 0 {
+		p.WriteString("(")
+		for i, v := range op.VariableDefinitions {
+			if i > 0 {
+				p.WriteString(", ")
+			}
+			p.WriteString("$" + v.Variable + ": " + v.Type.String())
+			if v.DefaultValue != nil {
+				p.WriteString(" = " + v.DefaultValue.String())
+			}
+			p.directives(v.Directives)
+		}
+		p.WriteString(")")
+	}
+	p.directives(op.Directives)
+	p.selectionSet(op.SelectionSet)
+	for _, fragment := range usedFragments(doc, op.SelectionSet) {
+		p.WriteString("\n\nfragment " + fragment.Name + " on " + fragment.TypeCondition)
+		p.directives(fragment.Directives)
+		p.selectionSet(fragment.SelectionSet)
+	}
+	return p.String()
+}
+
+func (p *printer) selectionSet(set ast.SelectionSet) {
+	if len(set) == 0 {
+		return
+	}
+	p.WriteString(" {")
+	p.indent++
+	for _, selection := range set {
+		p.WriteString("\n" + strings.Repeat("  ", p.indent))
+		switch s := selection.(type) {
+		case *ast.Field:
+			if s.Alias != "" {
+				p.WriteString(s.Alias + ": ")
+			}
+			p.WriteString(s.Name)
+			p.arguments(s.Arguments)
+			p.directives(s.Directives)
+			p.selectionSet(s.SelectionSet)
+		case *ast.FragmentSpread:
+			p.WriteString("..." + s.Name)
+			p.directives(s.Directives)
+		case *ast.InlineFragment:
+			p.WriteString("...")
+			if s.TypeCondition != "" {
+				p.WriteString(" on " + s.TypeCondition)
+			}
+			p.directives(s.Directives)
+			p.selectionSet(s.SelectionSet)
+		}
+	}
+	p.indent--
+	p.WriteString("\n" + strings.Repeat("  ", p.indent) + "}")
+}
+
+func (p *printer) arguments(args []*ast.Argument) {
+	if len(args) == 0 {
+		return
+	}
+	p.WriteString("(")
+	for i, arg := range args {
+		if i > 0 {
+			p.WriteString(", ")
+		}
+		p.WriteString(arg.Name + ": " + arg.Value.String())
+	}
+	p.WriteString(")")
+}
+
+func (p *printer) directives(directives []*ast.Directive) {
+	for _, directive := range directives {
+		p.WriteString(" @" + directive.Name)
+		p.arguments(directive.Arguments)
+	}
+}
+
+// usedFragments returns the fragments spread in set directly or indirectly, in order of first spread
+func usedFragments(doc *ast.Document, set ast.SelectionSet) []*ast.FragmentDefinition {
+	var res []*ast.FragmentDefinition
+	visited := map[string]bool{}
+	var walk func(set ast.SelectionSet)
+	walk = func(set ast.SelectionSet) {
+		for _, selection := range set {
+			switch s := selection.(type) {
+			case *ast.Field:
+				walk(s.SelectionSet)
+			case *ast.InlineFragment:
+				walk(s.SelectionSet)
+			case *ast.FragmentSpread:
+				fragment := doc.Fragment(s.Name)
+				if fragment == nil || visited[s.Name] {
+					continue
+				}
+				visited[s.Name] = true
+				res = append(res, fragment)
+				walk(fragment.SelectionSet)
+			}
+		}
+	}
+	walk(set)
+	return res
+}
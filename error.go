@@ -7,6 +7,29 @@ import (
 	"github.com/pkg/errors"
 )
 
+var (
+	// ErrSubscriptionCompleted is returned by Subscription.Err when server completed the subscription
+	ErrSubscriptionCompleted = errors.New("subscription completed")
+
+	// ErrSubscriptionClosed is returned by Subscription.Err when Subscription.Close called
+	ErrSubscriptionClosed = errors.New("subscription closed")
+
+	// ErrSubscriptionOverflow is returned by Subscription.Err when too many events are waiting to be received
+	ErrSubscriptionOverflow = errors.New("subscription events overflow")
+
+	// ErrConnectionAckTimeout means connection_ack is not received in WSOption.AckTimeout
+	ErrConnectionAckTimeout = errors.New("graphql websocket connection_ack timeout")
+
+	// ErrKeepAliveTimeout means no keepalive message received in WSOption.KeepAliveTimeout
+	ErrKeepAliveTimeout = errors.New("graphql websocket keepalive timeout")
+
+	errWSClientClosed = errors.New("graphql websocket client is already closed")
+
+	errSSEClientClosed = errors.New("graphql sse client is already closed")
+
+	errMultipartClientClosed = errors.New("graphql multipart client is already closed")
+)
+
 type GraphQLErrors []GraphQLError
 
 // Path element's type should be either string or int, according to the samples of http://spec.graphql.org/draft/#sec-Errors
@@ -22,12 +45,45 @@ type GraphQLErrorLocation struct {
 	Column int `json:"column"`
 }
 
+// BatchError keeps GraphQL errors of batch requests by request index,
+// errors.As(err, &GraphQLErrors{}) gets all errors of the batch.
+type BatchError struct {
+	// Errors has the same size of requests, it's nil for succeeded requests
+	Errors []GraphQLErrors
+}
+
+// ConnectionError is the payload of connection_error message
+type ConnectionError struct {
+	Payload json.RawMessage
+}
+
 type DetailError struct {
 	OriginError error
 	Content     string
 	Response    *http.Response
 }
 
+// graphQLErrorsOf gets GraphQL errors of err, including the ones in content of DetailError like responses of HTTP 400
+func graphQLErrorsOf(err error) GraphQLErrors {
+	var gqlErrs GraphQLErrors
+	detailErr := &DetailError{}
+	switch {
+	case errors.As(err, &gqlErrs):
+	case errors.As(err, &detailErr):
+		resp := rawResponse{}
+		if json.Unmarshal([]byte(detailErr.Content), &resp) == nil {
+			gqlErrs = resp.Errors
+		} else {
+			var respList []rawResponse
+			_ = json.Unmarshal([]byte(detailErr.Content), &respList)
+			for _, resp := range respList {
+				gqlErrs = append(gqlErrs, resp.Errors...)
+			}
+		}
+	}
+	return gqlErrs
+}
+
 func jsonifyError(e interface{}) string {
 	if e == nil {
 		return "null"
@@ -47,6 +103,39 @@ func (e *GraphQLError) Error() string {
 	return jsonifyError(e)
 }
 
+func (e *BatchError) Error() string {
+	return jsonifyError(e.all())
+}
+
+// Err returns GraphQLErrors of the i-th request, or nil if it succeeded
+func (e *BatchError) Err(i int) error {
+	if i < 0 || i >= len(e.Errors) || len(e.Errors[i]) == 0 {
+		return nil
+	}
+	return e.Errors[i]
+}
+
+// As flattens errors into *GraphQLErrors target
+func (e *BatchError) As(target interface{}) bool {
+	gqlErrs, ok := target.(*GraphQLErrors)
+	if ok {
+		*gqlErrs = e.all()
+	}
+	return ok
+}
+
+func (e *BatchError) all() GraphQLErrors {
+	errs := make(GraphQLErrors, 0)
+	for _, v := range e.Errors {
+		errs = append(errs, v...)
+	}
+	return errs
+}
+
+func (e *ConnectionError) Error() string {
+	return "graphql websocket connection error: " + string(e.Payload)
+}
+
 func (e *DetailError) Error() string {
 	if e == nil || e.OriginError == nil {
 		return "<nil>"
@@ -15,3 +15,18 @@ type ResponseMessage struct {
 	ID      string          `json:"id,omitempty"`
 	Payload json.RawMessage `json:"payload,omitempty"`
 }
+
+// SubscribePayload is the payload of start and subscribe message
+type SubscribePayload struct {
+	Query         string                 `json:"query,omitempty"`
+	Variables     map[string]interface{} `json:"variables"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Extensions    interface{}            `json:"extensions,omitempty"`
+}
+
+// ExecutionResult is the payload of data and next message
+type ExecutionResult struct {
+	Data       json.RawMessage `json:"data,omitempty"`
+	Errors     json.RawMessage `json:"errors,omitempty"`
+	Extensions json.RawMessage `json:"extensions,omitempty"`
+}
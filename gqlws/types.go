@@ -1,5 +1,16 @@
 package gqlws
 
+// WebSocket subprotocols
+const (
+	// ProtocolGraphQLWS is the subprotocol of apollographql/subscriptions-transport-ws
+	ProtocolGraphQLWS = "graphql-ws"
+
+	// ProtocolGraphQLTransportWS is the subprotocol of enisdenjo/graphql-ws
+	ProtocolGraphQLTransportWS = "graphql-transport-ws"
+)
+
+// subscriptions-transport-ws message types
+// https://github.com/apollographql/subscriptions-transport-ws/blob/master/PROTOCOL.md
 const (
 	// Client -> Server
 	MsgTypeConnectionInit      = "connection_init"
@@ -15,3 +26,17 @@ const (
 	MsgTypeError               = "error"
 	MsgTypeComplete            = "complete"
 )
+
+// graphql-transport-ws message types, connection_init, connection_ack, error and complete are shared with above
+// https://github.com/enisdenjo/graphql-ws/blob/master/PROTOCOL.md
+const (
+	// Client -> Server
+	MsgTypeSubscribe = "subscribe"
+
+	// Server -> Client
+	MsgTypeNext = "next"
+
+	// Bidirectional
+	MsgTypePing = "ping"
+	MsgTypePong = "pong"
+)
@@ -0,0 +1,223 @@
+package gqlgo
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// incrementalAccept asks for incremental delivery of @defer and @stream, https://github.com/graphql/graphql-over-http/blob/main/rfcs/IncrementalDelivery.md
+const incrementalAccept = "multipart/mixed;deferSpec=20220824, application/json"
+
+// incrementalChunk is the body of a part, the first one is like a normal response.
+// Subsequent ones carry patches in incremental, or a single patch with path in early implementations.
+type incrementalChunk struct {
+	Data        json.RawMessage        `json:"data"`
+	Errors      []GraphQLError         `json:"errors"`
+	Path        []interface{}          `json:"path"`
+	Items       json.RawMessage        `json:"items"`
+	Incremental []incrementalPatch     `json:"incremental"`
+	HasNext     bool                   `json:"hasNext"`
+	Extensions  map[string]interface{} `json:"extensions"`
+}
+
+type incrementalPatch struct {
+	Data   json.RawMessage `json:"data"`
+	Items  json.RawMessage `json:"items"`
+	Path   []interface{}   `json:"path"`
+	Errors []GraphQLError  `json:"errors"`
+}
+
+// incrementalResult merges chunks into data
+type incrementalResult struct {
+	data       interface{}
+	errors     GraphQLErrors
+	extensions map[string]interface{}
+	chunks     int
+}
+
+// apply merges chunk and returns its errors
+func (r *incrementalResult) apply(chunk *incrementalChunk) (GraphQLErrors, error) {
+	errs := GraphQLErrors(chunk.Errors)
+	for k, v := range chunk.Extensions {
+		if r.extensions == nil {
+			r.extensions = make(map[string]interface{})
+		}
+		r.extensions[k] = v
+	}
+	r.chunks++
+	if r.chunks == 1 {
+		if err := decodeJSON(chunk.Data, &r.data); err != nil {
+			return nil, err
+		}
+	} else if chunk.Path != nil {
+		chunk.Incremental = append(chunk.Incremental, incrementalPatch{
+			Data:  chunk.Data,
+			Items: chunk.Items,
+			Path:  chunk.Path,
+		})
+	}
+	for _, patch := range chunk.Incremental {
+		errs = append(errs, patch.Errors...)
+		if err := r.patch(&patch); err != nil {
+			return nil, err
+		}
+	}
+	r.errors = append(r.errors, errs...)
+	return errs, nil
+}
+
+// patch deep merges data into the object at path, or inserts items into the list at the last index of path,
+// which should be the length of the list, because items are streamed in order
+func (r *incrementalResult) patch(patch *incrementalPatch) (err error) {
+	switch {
+	case len(patch.Data) > 0 && string(patch.Data) != "null":
+		var data interface{}
+		if err := decodeJSON(patch.Data, &data); err != nil {
+			return err
+		}
+		r.data, err = patchPath(r.data, patch.Path, func(node interface{}) (interface{}, error) {
+			return mergeJSON(node, data), nil
+		})
+	case len(patch.Items) > 0 && len(patch.Path) > 0:
+		var items []interface{}
+		if err := decodeJSON(patch.Items, &items); err != nil {
+			return err
+		}
+		index, indexErr := strconv.Atoi(fmt.Sprint(patch.Path[len(patch.Path)-1]))
+		if indexErr != nil {
+			return errors.Errorf("incremental items path %v should end with a list index", patch.Path)
+		}
+		r.data, err = patchPath(r.data, patch.Path[:len(patch.Path)-1], func(node interface{}) (interface{}, error) {
+			list, ok := node.([]interface{})
+			if !ok && node != nil {
+				return nil, errors.Errorf("incremental items path %v is not a list", patch.Path)
+			}
+			if index != len(list) {
+				return nil, errors.Errorf("incremental items path %v should be at the end of list of length %d", patch.Path, len(list))
+			}
+			return append(list, items...), nil
+		})
+	}
+	return err
+}
+
+// readIncremental reads the parts of multipart response, then decodes the merged data into res
+func (c *Client) readIncremental(httpResp *http.Response, res interface{}, onChunk IncrementalHandler) error {
+	result := &incrementalResult{}
+	var (
+		rawData json.RawMessage
+		err     error
+	)
+	readErr := readParts(httpResp, func(body []byte) bool {
+		if c.Log != nil {
+			c.Log(fmt.Sprintf("<Response %s> part: %s", httpResp.Status, string(body)))
+		}
+		chunk := &incrementalChunk{}
+		if err = decodeJSON(body, chunk); err != nil {
+			err = &DetailError{
+				OriginError: err,
+				Content:     string(body),
+				Response:    httpResp,
+			}
+			return true
+		}
+		var errs GraphQLErrors
+		if errs, err = result.apply(chunk); err != nil {
+			return true
+		}
+		if rawData, err = json.Marshal(result.data); err != nil {
+			return true
+		}
+		if onChunk != nil {
+			if err = onChunk(rawData, errs, chunk.HasNext); err != nil {
+				return true
+			}
+		}
+		return !chunk.HasNext
+	})
+	if err != nil {
+		return err
+	}
+	if readErr != nil {
+		return errors.Wrap(readErr, "read incremental response")
+	}
+	resp := &rawResponse{
+		Errors:     result.errors,
+		Data:       rawData,
+		Extensions: result.extensions,
+	}
+	if err := setResult(res, resp, httpResp); err != nil {
+		return &DetailError{
+			OriginError: err,
+			Content:     string(rawData),
+			Response:    httpResp,
+		}
+	}
+	if len(result.errors) > 0 {
+		return result.errors
+	}
+	return nil
+}
+
+// decodeJSON keeps numbers as json.Number, so they are not changed when merged data encoded again
+func decodeJSON(data []byte, v interface{}) error {
+	if len(data) == 0 {
+		return nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+// patchPath replaces the value at path of node with the result of f
+func patchPath(node interface{}, path []interface{}, f func(node interface{}) (interface{}, error)) (interface{}, error) {
+	if len(path) == 0 {
+		return f(node)
+	}
+	switch n := node.(type) {
+	case map[string]interface{}:
+		key, ok := path[0].(string)
+		if !ok {
+			return nil, errors.Errorf("incremental path element %v should be a field name", path[0])
+		}
+		v, err := patchPath(n[key], path[1:], f)
+		if err != nil {
+			return nil, err
+		}
+		n[key] = v
+		return n, nil
+	case []interface{}:
+		i, err := strconv.Atoi(fmt.Sprint(path[0]))
+		if err != nil || i < 0 || i >= len(n) {
+			return nil, errors.Errorf("incremental path element %v should be a list index", path[0])
+		}
+		v, err := patchPath(n[i], path[1:], f)
+		if err != nil {
+			return nil, err
+		}
+		n[i] = v
+		return n, nil
+	}
+	return nil, errors.Errorf("incremental path %v not found", path)
+}
+
+// mergeJSON deep merges objects, other values of src replace dst
+func mergeJSON(dst, src interface{}) interface{} {
+	d, ok := dst.(map[string]interface{})
+	if !ok {
+		return src
+	}
+	s, ok := src.(map[string]interface{})
+	if !ok {
+		return src
+	}
+	for k, v := range s {
+		d[k] = mergeJSON(d[k], v)
+	}
+	return d
+}
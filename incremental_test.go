@@ -0,0 +1,93 @@
+package gqlgo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientDoIncremental(t *testing.T) {
+	as := assert.New(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		as.Equal(incrementalAccept, r.Header.Get("Accept"))
+		w.Header().Set("Content-Type", `multipart/mixed; boundary="-"; deferSpec=20220824`)
+		for _, part := range []string{
+			`{"data":{"user":{"id":"1","posts":[]}},"hasNext":true}`,
+			`{"incremental":[{"data":{"name":"pooh"},"path":["user"]},{"items":[{"n":1}],"path":["user","posts",0]}],"hasNext":true}`,
+			`{"incremental":[{"items":[{"n":2}],"path":["user","posts",1],"errors":[{"message":"slow"}]}],"hasNext":false}`,
+		} {
+			_, _ = fmt.Fprintf(w, "\r\n---\r\nContent-Type: application/json; charset=utf-8\r\n\r\n%s", part)
+			w.(http.Flusher).Flush()
+		}
+		_, _ = fmt.Fprint(w, "\r\n-----\r\n")
+	}))
+	defer server.Close()
+	client := NewClient(server.URL)
+	req := Request{Query: "{user{id ...@defer{name} posts@stream{n}}}"}
+
+	var chunks []string
+	data := struct {
+		User struct {
+			ID    string
+			Name  string
+			Posts []struct{ N int }
+		}
+	}{}
+	err := client.DoIncremental(context.Background(), &data, req, func(rawMsg json.RawMessage, gqlErrs GraphQLErrors, hasNext bool) error {
+		chunks = append(chunks, fmt.Sprint(string(rawMsg), " ", len(gqlErrs), " ", hasNext))
+		return nil
+	})
+	as.Equal(GraphQLErrors{{Message: "slow"}}, err)
+	as.Equal([]string{
+		`{"user":{"id":"1","posts":[]}} 0 true`,
+		`{"user":{"id":"1","name":"pooh","posts":[{"n":1}]}} 0 true`,
+		`{"user":{"id":"1","name":"pooh","posts":[{"n":1},{"n":2}]}} 1 false`,
+	}, chunks)
+	as.Equal("pooh", data.User.Name)
+	as.Len(data.User.Posts, 2)
+
+	data.User.Posts = nil
+	err = client.Do(context.Background(), &data, req)
+	gqlErrs := GraphQLErrors{}
+	require.True(t, errors.As(err, &gqlErrs))
+	as.Equal(2, data.User.Posts[1].N)
+}
+
+func TestHasIncrementalDirective(t *testing.T) {
+	as := assert.New(t)
+	as.True(hasIncrementalDirective(Request{Query: `{ a { ... @defer { b } } }`}))
+	as.True(hasIncrementalDirective(Request{Query: `query { ...F } fragment F on Query { list @stream(initialCount: 1) }`}))
+	as.False(hasIncrementalDirective(Request{Query: `{ a(s: "@defer") # @stream
+}`}))
+	as.False(hasIncrementalDirective(Request{Query: `{ a @defer`}))
+}
+
+func TestIncrementalItems(t *testing.T) {
+	as := assert.New(t)
+	r := &incrementalResult{}
+	_, err := r.apply(&incrementalChunk{Data: json.RawMessage(`{"posts":[{"n":0}]}`)})
+	require.NoError(t, err)
+	_, err = r.apply(&incrementalChunk{Incremental: []incrementalPatch{
+		{Items: json.RawMessage(`[{"n":1},{"n":2}]`), Path: []interface{}{"posts", json.Number("1")}},
+		{Items: json.RawMessage(`[{"n":3}]`), Path: []interface{}{"posts", 3.0}},
+	}})
+	require.NoError(t, err)
+	data, _ := json.Marshal(r.data)
+	as.JSONEq(`{"posts":[{"n":0},{"n":1},{"n":2},{"n":3}]}`, string(data))
+
+	_, err = r.apply(&incrementalChunk{Incremental: []incrementalPatch{
+		{Items: json.RawMessage(`[{"n":5}]`), Path: []interface{}{"posts", 5.0}},
+	}})
+	as.EqualError(err, "incremental items path [posts 5] should be at the end of list of length 4")
+	_, err = r.apply(&incrementalChunk{Incremental: []incrementalPatch{
+		{Items: json.RawMessage(`[{"n":5}]`), Path: []interface{}{"posts"}},
+	}})
+	as.EqualError(err, "incremental items path [posts] should end with a list index")
+}
@@ -1,6 +1,7 @@
 package gqlgo
 
 import (
+	"context"
 	"encoding/json"
 	"io"
 	"net/http"
@@ -38,16 +39,75 @@ type Option struct {
 
 	// WebSocketOption specify websocket client option
 	WebSocketOption WSOption
+
+	// SubscriptionTransport specify the transport of Client.Subscribe, default is Client.WebSocketClient
+	SubscriptionTransport SubscriptionTransport
+
+	// PersistedQueries enables Automatic Persisted Queries, only the sha256 hash of query is sent,
+	// and the query is sent again with its hash when server replies PersistedQueryNotFound
+	PersistedQueries bool
+
+	// UseGETForQueries sends queries by HTTP GET with URL parameters, so they can be cached by CDN.
+	// Mutations, batch requests, file uploads and URLs longer than MaxGETURLLength are sent by POST.
+	UseGETForQueries bool
+
+	// MaxGETURLLength is the maximum URL length of GET request, default is 2048
+	MaxGETURLLength int
+
+	// Middlewares wrap Client.Do in order, the first one is the outermost
+	Middlewares []Middleware
+
+	// RetryPolicy retries transient failures of Client.Do inside Middlewares, nil disables retrying
+	RetryPolicy *RetryPolicy
+
+	// Validator checks every request of Client.Do and Client.Subscribe before sending, nil disables validating
+	Validator Validator
+}
+
+// Validator is implemented by validator.Validator, GraphQLErrors should be returned for invalid request
+type Validator interface {
+	Validate(req Request) error
+}
+
+// Handler sends requests and decodes results into res like Client.Do
+type Handler func(ctx context.Context, res interface{}, requests []Request) error
+
+// Middleware returns a Handler calling next, it can change requests, res and the returned error, or not call next at all
+type Middleware func(next Handler) Handler
+
+// SubscriptionTransport is implemented by WSClient, SSEClient and MultipartClient
+type SubscriptionTransport interface {
+	SubscribeContext(ctx context.Context, req Request, handler SubscriptionHandler) (id string, err error)
+	SubscribeChanContext(ctx context.Context, req Request) (*Subscription, error)
+	Unsubscribe(id string) error
+	Close() error
 }
 
 type Request struct {
-	Query         string                 `json:"query"`
+	Query         string                 `json:"query,omitempty"`
 	Variables     map[string]interface{} `json:"variables"`
 	OperationName string                 `json:"operationName,omitempty"`
 	Extensions    interface{}            `json:"extensions,omitempty"`
 
 	// Headers apply to http request at last phase of assembling http request.
 	Headers map[string]string `json:"-"`
+
+	parsed *parsedQuery
+}
+
+// Response can be the result of Client.Do to read the whole GraphQL response, including partial data with errors.
+// Data is the target of data like the result of Client.Do, Client.Do still returns GraphQLErrors if Errors is not empty.
+type Response struct {
+	Data interface{}
+
+	// HasData is true if data is not null
+	HasData    bool
+	Errors     GraphQLErrors
+	Extensions map[string]interface{}
+
+	// StatusCode and Header of http response
+	StatusCode int
+	Header     http.Header
 }
 
 type File struct {
@@ -55,7 +115,7 @@ type File struct {
 	Name   string
 }
 
-// Option be changed at anytime after NewWSClient
+// WSOption be changed at anytime after NewWSClient
 type WSOption struct {
 	// Dialer specify websocket Dialer, default is using websocket.DefaultDialer
 	Dialer *websocket.Dialer
@@ -63,22 +123,69 @@ type WSOption struct {
 	// Headers apply to http request
 	Headers map[string]string
 
+	// Protocol specify websocket subprotocol, gqlws.ProtocolGraphQLWS or gqlws.ProtocolGraphQLTransportWS.
+	// Default is empty, which offers both and follows the one selected by server in handshake.
+	Protocol string
+
 	// disable automatic reconnecting
 	NotReconnect bool
 
 	// ReconnectAttempts is the maximum attempts of reconnection after connected, default is math.MaxUint32
 	ReconnectAttempts uint32
 
-	// KeepAliveTimeout is the timeout of server keepalive since last keepalive message.
+	// KeepAliveTimeout is the timeout since the last message received. With graphql-transport-ws, client pings
+	// at half of it and it's checked since connection_ack. With subscriptions-transport-ws, it's checked once
+	// server sent ka or websocket ping, servers never sending them are not checked.
 	// Default is 30 seconds, less or equal than 10 second will disable checking keepalive timeout.
 	KeepAliveTimeout time.Duration
 
+	// ConnectionParams returns the payload of connection_init, it's called before every connecting,
+	// so refreshed auth tokens are sent after reconnecting. ctx is cancelled when WSClient is closed,
+	// but not by the contexts of subscriptions, because the connection is shared by them. Returned error fails the connecting like connection_error.
+	// Default payload is {"headers":{"content-type":"application/json"}}.
+	ConnectionParams func(ctx context.Context) (interface{}, error)
+
+	// AckTimeout is the timeout of waiting connection_ack after connection_init, default is 10 seconds
+	AckTimeout time.Duration
+
+	// PersistedQueries enables Automatic Persisted Queries in start messages,
+	// only the hash is sent, and the query is sent again with its hash when server replies PersistedQueryNotFound
+	PersistedQueries bool
+
+	// Connection lifecycle callbacks are called in order by a goroutine other than WSClient's,
+	// so it's fine to call WSClient methods inside them.
+
+	// OnConnectionError is called when connection failed before connection_ack,
+	// err is *ConnectionError if server sent connection_error
+	OnConnectionError func(err error)
+
+	// OnConnected is called when websocket connection established, before connection_ack
+	OnConnected func()
+
+	// OnAck is called when connection_ack received, subscriptions are started after it
+	OnAck func()
+
+	// OnDisconnected is called when an established websocket connection closed for err
+	OnDisconnected func(err error)
+
+	// OnReconnecting is called before every reconnection, attempt starts from 1
+	OnReconnecting func(attempt uint32)
+
+	// OnGiveUp is called when ReconnectAttempts exhausted, all subscriptions are dropped then
+	OnGiveUp func()
+
 	// Custom WebSocket GraphQL Log func like func(s string) { fmt.Println(s) }
 	Log func(msg string)
 }
 
 // GQL_ERROR will be appended to errors, then errors will be a list that contains only one error.
+// rawMsg is nil only when GQL_ERROR received, which ends the subscription.
 // completed is true only happens to GraphQL server send completed, if completed is true, data and errors must be nil.
 // when returned error is not nil, Subscription will be unsubscribed.
 // SubscriptionHandler is executed synchronized, return as soon as possible
 type SubscriptionHandler func(rawMsg json.RawMessage, gqlErrs GraphQLErrors, completed bool) error
+
+// IncrementalHandler is called when a chunk of incremental delivery arrived, rawMsg is the data merged from all chunks so far.
+// gqlErrs are the errors of this chunk, hasNext is false at the last chunk.
+// when returned error is not nil, Client.DoIncremental stops reading and returns it.
+type IncrementalHandler func(rawMsg json.RawMessage, gqlErrs GraphQLErrors, hasNext bool) error
@@ -0,0 +1,174 @@
+// Package introspection models the result of GraphQL introspection, http://spec.graphql.org/draft/#sec-Introspection
+package introspection
+
+import (
+	"strings"
+)
+
+type TypeKind string
+
+const (
+	KindScalar      TypeKind = "SCALAR"
+	KindObject      TypeKind = "OBJECT"
+	KindInterface   TypeKind = "INTERFACE"
+	KindUnion       TypeKind = "UNION"
+	KindEnum        TypeKind = "ENUM"
+	KindInputObject TypeKind = "INPUT_OBJECT"
+	KindList        TypeKind = "LIST"
+	KindNonNull     TypeKind = "NON_NULL"
+)
+
+// Response is the data of Query
+type Response struct {
+	Schema Schema `json:"__schema"`
+}
+
+type Schema struct {
+	QueryType        *TypeName   `json:"queryType"`
+	MutationType     *TypeName   `json:"mutationType"`
+	SubscriptionType *TypeName   `json:"subscriptionType"`
+	Types            []Type      `json:"types"`
+	Directives       []Directive `json:"directives"`
+}
+
+type TypeName struct {
+	Name string `json:"name"`
+}
+
+// Type is a named type, fields are set according to Kind
+type Type struct {
+	Kind          TypeKind     `json:"kind"`
+	Name          string       `json:"name"`
+	Description   string       `json:"description,omitempty"`
+	Fields        []Field      `json:"fields,omitempty"`
+	InputFields   []InputValue `json:"inputFields,omitempty"`
+	Interfaces    []TypeRef    `json:"interfaces,omitempty"`
+	EnumValues    []EnumValue  `json:"enumValues,omitempty"`
+	PossibleTypes []TypeRef    `json:"possibleTypes,omitempty"`
+}
+
+// TypeRef refers a named type, or wraps OfType in LIST or NON_NULL
+type TypeRef struct {
+	Kind   TypeKind `json:"kind"`
+	Name   string   `json:"name,omitempty"`
+	OfType *TypeRef `json:"ofType,omitempty"`
+}
+
+type Field struct {
+	Name              string       `json:"name"`
+	Description       string       `json:"description,omitempty"`
+	Args              []InputValue `json:"args"`
+	Type              TypeRef      `json:"type"`
+	IsDeprecated      bool         `json:"isDeprecated"`
+	DeprecationReason string       `json:"deprecationReason,omitempty"`
+}
+
+// InputValue is an argument or a field of input object, DefaultValue is in GraphQL syntax
+type InputValue struct {
+	Name              string  `json:"name"`
+	Description       string  `json:"description,omitempty"`
+	Type              TypeRef `json:"type"`
+	DefaultValue      *string `json:"defaultValue"`
+	IsDeprecated      bool    `json:"isDeprecated,omitempty"`
+	DeprecationReason string  `json:"deprecationReason,omitempty"`
+}
+
+type EnumValue struct {
+	Name              string `json:"name"`
+	Description       string `json:"description,omitempty"`
+	IsDeprecated      bool   `json:"isDeprecated"`
+	DeprecationReason string `json:"deprecationReason,omitempty"`
+}
+
+type Directive struct {
+	Name         string       `json:"name"`
+	Description  string       `json:"description,omitempty"`
+	Locations    []string     `json:"locations"`
+	Args         []InputValue `json:"args"`
+	IsRepeatable bool         `json:"isRepeatable,omitempty"`
+}
+
+// Type returns the named type, or nil if not found
+func (s *Schema) Type(name string) *Type {
+	for i := range s.Types {
+		if s.Types[i].Name == name {
+			return &s.Types[i]
+		}
+	}
+	return nil
+}
+
+// Directive returns the directive, or nil if not found
+func (s *Schema) Directive(name string) *Directive {
+	for i := range s.Directives {
+		if s.Directives[i].Name == name {
+			return &s.Directives[i]
+		}
+	}
+	return nil
+}
+
+// Field returns the field of object or interface, or nil if not found
+func (t *Type) Field(name string) *Field {
+	for i := range t.Fields {
+		if t.Fields[i].Name == name {
+			return &t.Fields[i]
+		}
+	}
+	return nil
+}
+
+// InputField returns the field of input object, or nil if not found
+func (t *Type) InputField(name string) *InputValue {
+	for i := range t.InputFields {
+		if t.InputFields[i].Name == name {
+			return &t.InputFields[i]
+		}
+	}
+	return nil
+}
+
+// NamedType returns the name of the innermost named type
+func (r *TypeRef) NamedType() string {
+	for r.OfType != nil {
+		r = r.OfType
+	}
+	return r.Name
+}
+
+// String returns type reference in GraphQL syntax like [String!]!
+func (r TypeRef) String() string {
+	switch r.Kind {
+	case KindNonNull:
+		if r.OfType != nil {
+			return r.OfType.String() + "!"
+		}
+	case KindList:
+		if r.OfType != nil {
+			return "[" + r.OfType.String() + "]"
+		}
+	}
+	return r.Name
+}
+
+// ParseTypeRef parses type reference in GraphQL syntax like [String!]!, kind of named type is empty
+func ParseTypeRef(s string) (*TypeRef, bool) {
+	s = strings.TrimSpace(s)
+	switch {
+	case strings.HasSuffix(s, "!"):
+		ofType, ok := ParseTypeRef(s[:len(s)-1])
+		if !ok || ofType.Kind == KindNonNull {
+			return nil, false
+		}
+		return &TypeRef{Kind: KindNonNull, OfType: ofType}, true
+	case strings.HasPrefix(s, "[") && strings.HasSuffix(s, "]"):
+		ofType, ok := ParseTypeRef(s[1 : len(s)-1])
+		if !ok {
+			return nil, false
+		}
+		return &TypeRef{Kind: KindList, OfType: ofType}, true
+	case s == "" || strings.ContainsAny(s, "[]! \t\n"):
+		return nil, false
+	}
+	return &TypeRef{Name: s}, true
+}
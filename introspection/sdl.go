@@ -0,0 +1,220 @@
+package introspection
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+// defaultDeprecationReason is omitted from @deprecated when printed
+const defaultDeprecationReason = "No longer supported"
+
+var builtinScalars = map[string]bool{
+	"String":  true,
+	"Int":     true,
+	"Float":   true,
+	"Boolean": true,
+	"ID":      true,
+}
+
+var builtinDirectives = map[string]bool{
+	"skip":        true,
+	"include":     true,
+	"deprecated":  true,
+	"specifiedBy": true,
+}
+
+// SDL prints schema in GraphQL schema definition language like graphql-js printSchema,
+// built-in scalars, directives and introspection types are omitted
+func (s *Schema) SDL() string {
+	var defs []string
+	if def := s.printSchemaDefinition(); def != "" {
+		defs = append(defs, def)
+	}
+	for _, d := range s.Directives {
+		if !builtinDirectives[d.Name] {
+			defs = append(defs, printDirective(&d))
+		}
+	}
+	for _, t := range s.Types {
+		if !builtinScalars[t.Name] && !strings.HasPrefix(t.Name, "__") {
+			defs = append(defs, printType(&t))
+		}
+	}
+	if len(defs) == 0 {
+		return ""
+	}
+	return strings.Join(defs, "\n\n") + "\n"
+}
+
+// printSchemaDefinition returns empty if root types use the conventional names
+func (s *Schema) printSchemaDefinition() string {
+	roots := []struct {
+		operation string
+		typeName  *TypeName
+		name      string
+	}{
+		{"query", s.QueryType, "Query"},
+		{"mutation", s.MutationType, "Mutation"},
+		{"subscription", s.SubscriptionType, "Subscription"},
+	}
+	conventional := true
+	var fields []string
+	for _, root := range roots {
+		if root.typeName == nil {
+			continue
+		}
+		if root.typeName.Name != root.name {
+			conventional = false
+		}
+		fields = append(fields, "  "+root.operation+": "+root.typeName.Name)
+	}
+	if conventional {
+		return ""
+	}
+	return "schema" + printBlock(fields)
+}
+
+func printType(t *Type) string {
+	desc := printDescription(t.Description, "", true)
+	switch t.Kind {
+	case KindObject:
+		return desc + "type " + t.Name + printImplements(t.Interfaces) + printBlock(printFields(t.Fields))
+	case KindInterface:
+		return desc + "interface " + t.Name + printImplements(t.Interfaces) + printBlock(printFields(t.Fields))
+	case KindUnion:
+		names := make([]string, len(t.PossibleTypes))
+		for i, possibleType := range t.PossibleTypes {
+			names[i] = possibleType.Name
+		}
+		if len(names) == 0 {
+			return desc + "union " + t.Name
+		}
+		return desc + "union " + t.Name + " = " + strings.Join(names, " | ")
+	case KindEnum:
+		values := make([]string, len(t.EnumValues))
+		for i, v := range t.EnumValues {
+			values[i] = printDescription(v.Description, "  ", i == 0) + "  " + v.Name + printDeprecated(v.IsDeprecated, v.DeprecationReason)
+		}
+		return desc + "enum " + t.Name + printBlock(values)
+	case KindInputObject:
+		fields := make([]string, len(t.InputFields))
+		for i, f := range t.InputFields {
+			fields[i] = printDescription(f.Description, "  ", i == 0) + "  " + printInputValue(&f)
+		}
+		return desc + "input " + t.Name + printBlock(fields)
+	}
+	return desc + "scalar " + t.Name
+}
+
+func printDirective(d *Directive) string {
+	repeatable := ""
+	if d.IsRepeatable {
+		repeatable = " repeatable"
+	}
+	return printDescription(d.Description, "", true) + "directive @" + d.Name + printArgs(d.Args, "") + repeatable + " on " + strings.Join(d.Locations, " | ")
+}
+
+func printImplements(interfaces []TypeRef) string {
+	if len(interfaces) == 0 {
+		return ""
+	}
+	names := make([]string, len(interfaces))
+	for i, iface := range interfaces {
+		names[i] = iface.Name
+	}
+	return " implements " + strings.Join(names, " & ")
+}
+
+func printFields(fields []Field) []string {
+	lines := make([]string, len(fields))
+	for i, f := range fields {
+		lines[i] = printDescription(f.Description, "  ", i == 0) + "  " + f.Name + printArgs(f.Args, "  ") + ": " + f.Type.String() + printDeprecated(f.IsDeprecated, f.DeprecationReason)
+	}
+	return lines
+}
+
+func printBlock(lines []string) string {
+	if len(lines) == 0 {
+		return ""
+	}
+	return " {\n" + strings.Join(lines, "\n") + "\n}"
+}
+
+// printArgs prints args in a line, or a line per arg if any of them has description
+func printArgs(args []InputValue, indentation string) string {
+	if len(args) == 0 {
+		return ""
+	}
+	hasDescription := false
+	for _, arg := range args {
+		if arg.Description != "" {
+			hasDescription = true
+		}
+	}
+	lines := make([]string, len(args))
+	for i, arg := range args {
+		if hasDescription {
+			lines[i] = printDescription(arg.Description, "  "+indentation, i == 0) + "  " + indentation + printInputValue(&arg)
+		} else {
+			lines[i] = printInputValue(&arg)
+		}
+	}
+	if !hasDescription {
+		return "(" + strings.Join(lines, ", ") + ")"
+	}
+	return "(\n" + strings.Join(lines, "\n") + "\n" + indentation + ")"
+}
+
+func printInputValue(v *InputValue) string {
+	s := v.Name + ": " + v.Type.String()
+	if v.DefaultValue != nil {
+		s += " = " + *v.DefaultValue
+	}
+	return s + printDeprecated(v.IsDeprecated, v.DeprecationReason)
+}
+
+func printDeprecated(isDeprecated bool, reason string) string {
+	if !isDeprecated {
+		return ""
+	}
+	if reason == "" || reason == defaultDeprecationReason {
+		return " @deprecated"
+	}
+	return " @deprecated(reason: " + printString(reason) + ")"
+}
+
+// printDescription prints description as block string followed by a newline,
+// descriptions not first in block are separated by an empty line
+func printDescription(description, indentation string, firstInBlock bool) string {
+	if description == "" {
+		return ""
+	}
+	isSingleLine := !strings.Contains(description, "\n")
+	hasLeadingSpace := description[0] == ' ' || description[0] == '\t'
+	last := description[len(description)-1]
+	multipleLines := !isSingleLine || last == '"' || last == '\\' || len(description) > 70
+	s := ""
+	if multipleLines && !(isSingleLine && hasLeadingSpace) {
+		s += "\n"
+	}
+	s += description
+	if multipleLines {
+		s += "\n"
+	}
+	s = `"""` + strings.Replace(s, `"""`, `\"""`, -1) + `"""`
+	prefix := indentation
+	if indentation != "" && !firstInBlock {
+		prefix = "\n" + indentation
+	}
+	return prefix + strings.Replace(s, "\n", "\n"+indentation, -1) + "\n"
+}
+
+// printString prints s as GraphQL string value, which escapes like JSON
+func printString(s string) string {
+	buf := &bytes.Buffer{}
+	encoder := json.NewEncoder(buf)
+	encoder.SetEscapeHTML(false)
+	_ = encoder.Encode(s)
+	return strings.TrimSuffix(buf.String(), "\n")
+}
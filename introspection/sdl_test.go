@@ -0,0 +1,135 @@
+package introspection
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testIntrospection = `{"__schema":{
+"queryType":{"name":"Root"},"mutationType":null,"subscriptionType":null,
+"types":[
+{"kind":"SCALAR","name":"String"},
+{"kind":"SCALAR","name":"Int"},
+{"kind":"OBJECT","name":"__Schema","fields":[]},
+{"kind":"SCALAR","name":"Date","description":"RFC 3339 date"},
+{"kind":"INTERFACE","name":"Node","fields":[
+	{"name":"id","args":[],"type":{"kind":"NON_NULL","ofType":{"kind":"SCALAR","name":"String"}},"isDeprecated":false}
+]},
+{"kind":"OBJECT","name":"User","description":"A user\nof the service","interfaces":[{"kind":"INTERFACE","name":"Node"}],"fields":[
+	{"name":"id","args":[],"type":{"kind":"NON_NULL","ofType":{"kind":"SCALAR","name":"String"}},"isDeprecated":false},
+	{"name":"name","description":"Display name","args":[],"type":{"kind":"SCALAR","name":"String"},"isDeprecated":true,"deprecationReason":"Use nick"},
+	{"name":"friends","args":[
+		{"name":"first","description":"Page size","type":{"kind":"SCALAR","name":"Int"},"defaultValue":"10"},
+		{"name":"role","type":{"kind":"ENUM","name":"Role"},"defaultValue":null,"isDeprecated":true,"deprecationReason":"Use filter"}
+	],"type":{"kind":"NON_NULL","ofType":{"kind":"LIST","ofType":{"kind":"NON_NULL","ofType":{"kind":"OBJECT","name":"User"}}}},"isDeprecated":false},
+	{"name":"born","args":[],"type":{"kind":"SCALAR","name":"Date"},"isDeprecated":true,"deprecationReason":"No longer supported"}
+]},
+{"kind":"ENUM","name":"Role","enumValues":[
+	{"name":"ADMIN","isDeprecated":false},
+	{"name":"GUEST","description":"Not signed in","isDeprecated":true,"deprecationReason":"Use \"ANONYMOUS\""}
+]},
+{"kind":"UNION","name":"Result","possibleTypes":[{"kind":"OBJECT","name":"User"},{"kind":"OBJECT","name":"Root"}]},
+{"kind":"INPUT_OBJECT","name":"UserFilter","inputFields":[
+	{"name":"role","type":{"kind":"LIST","ofType":{"kind":"ENUM","name":"Role"}},"defaultValue":"[ADMIN]"},
+	{"name":"admin","type":{"kind":"SCALAR","name":"Boolean"},"defaultValue":null,"isDeprecated":true,"deprecationReason":"No longer supported"}
+]},
+{"kind":"OBJECT","name":"Root","fields":[
+	{"name":"users","args":[{"name":"filter","type":{"kind":"INPUT_OBJECT","name":"UserFilter"},"defaultValue":null}],"type":{"kind":"LIST","ofType":{"kind":"OBJECT","name":"User"}},"isDeprecated":false}
+]}
+],
+"directives":[
+	{"name":"include","locations":["FIELD"],"args":[]},
+	{"name":"cached","description":"Cache the field","locations":["FIELD_DEFINITION","OBJECT"],"args":[{"name":"ttl","type":{"kind":"SCALAR","name":"Int"},"defaultValue":"60"}]},
+	{"name":"tag","locations":["FIELD_DEFINITION"],"args":[{"name":"name","type":{"kind":"SCALAR","name":"String"},"defaultValue":null}],"isRepeatable":true}
+]}}`
+
+const testSDL = `schema {
+  query: Root
+}
+
+"""Cache the field"""
+directive @cached(ttl: Int = 60) on FIELD_DEFINITION | OBJECT
+
+directive @tag(name: String) repeatable on FIELD_DEFINITION
+
+"""RFC 3339 date"""
+scalar Date
+
+interface Node {
+  id: String!
+}
+
+"""
+A user
+of the service
+"""
+type User implements Node {
+  id: String!
+
+  """Display name"""
+  name: String @deprecated(reason: "Use nick")
+  friends(
+    """Page size"""
+    first: Int = 10
+    role: Role @deprecated(reason: "Use filter")
+  ): [User!]!
+  born: Date @deprecated
+}
+
+enum Role {
+  ADMIN
+
+  """Not signed in"""
+  GUEST @deprecated(reason: "Use \"ANONYMOUS\"")
+}
+
+union Result = User | Root
+
+input UserFilter {
+  role: [Role] = [ADMIN]
+  admin: Boolean @deprecated
+}
+
+type Root {
+  users(filter: UserFilter): [User]
+}
+`
+
+func TestSchemaSDL(t *testing.T) {
+	res := &Response{}
+	require.NoError(t, json.Unmarshal([]byte(testIntrospection), res))
+	assert.Equal(t, testSDL, res.Schema.SDL())
+}
+
+func TestSchemaLookup(t *testing.T) {
+	as := assert.New(t)
+	res := &Response{}
+	require.NoError(t, json.Unmarshal([]byte(testIntrospection), res))
+	schema := &res.Schema
+
+	user := schema.Type("User")
+	as.Equal(KindObject, user.Kind)
+	friends := user.Field("friends")
+	as.Equal("[User!]!", friends.Type.String())
+	as.Equal("User", friends.Type.NamedType())
+	as.Nil(user.Field("missing"))
+	as.Nil(schema.Type("Missing"))
+	as.Equal("60", *schema.Directive("cached").Args[0].DefaultValue)
+	as.Equal(KindList, schema.Type("UserFilter").InputField("role").Type.Kind)
+}
+
+func TestParseTypeRef(t *testing.T) {
+	as := assert.New(t)
+	for _, s := range []string{"Int", "Int!", "[Int]", "[[Int!]]!"} {
+		ref, ok := ParseTypeRef(s)
+		as.True(ok, s)
+		as.Equal(s, ref.String())
+	}
+	for _, s := range []string{"", "Int!!", "[Int", "[]", "In t"} {
+		_, ok := ParseTypeRef(s)
+		as.False(ok, s)
+	}
+}
@@ -0,0 +1,271 @@
+package gqlgo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+)
+
+// multipartSubscriptionAccept prefers multipart subscription, JSON response is taken as a single result
+const multipartSubscriptionAccept = `multipart/mixed;subscriptionSpec="1.0", application/json`
+
+// MultipartOption be changed at anytime after NewMultipartClient
+type MultipartOption struct {
+	// Endpoint specify subscription endpoint, default is Option.Endpoint
+	Endpoint string
+}
+
+// MultipartClient implements multipart HTTP subscriptions of Apollo Router,
+// https://www.apollographql.com/docs/router/executing-operations/subscription-multipart-protocol
+// Every subscription is a streaming http request, HTTPClient, Headers, BearerAuth, CloseBody and Log of Option apply to it.
+type MultipartClient struct {
+	*MultipartOption
+	option *Option
+
+	id int64
+
+	mutex  sync.Mutex
+	closed bool
+	subs   map[string]*httpSubscription
+}
+
+// NewMultipartClient only take the first MultipartOption if given, opt is shared with Client to reuse its http settings
+func NewMultipartClient(opt *Option, multipartOpt ...MultipartOption) *MultipartClient {
+	client := &MultipartClient{
+		MultipartOption: &MultipartOption{},
+		option:          opt,
+		subs:            make(map[string]*httpSubscription),
+	}
+	if len(multipartOpt) > 0 {
+		client.MultipartOption = &multipartOpt[0]
+	}
+	return client
+}
+
+// multipartMessage is the body of part, heartbeat is an empty object
+type multipartMessage struct {
+	Payload json.RawMessage `json:"payload"`
+	// Errors is transport error, which ends the subscription
+	Errors json.RawMessage `json:"errors"`
+}
+
+// readParts calls fn with the body of every part of multipart response until fn reports stop,
+// it returns nil when the final boundary reached.
+func readParts(resp *http.Response, fn func(body []byte) (stop bool)) error {
+	_, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil {
+		return errors.Wrap(err, "parse multipart content type")
+	}
+	if params["boundary"] == "" {
+		return errors.New("multipart boundary required")
+	}
+	r := multipart.NewReader(resp.Body, params["boundary"])
+	for {
+		part, err := r.NextPart()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		body, err := ioutil.ReadAll(part)
+		if err != nil {
+			return err
+		}
+		if fn(body) {
+			return nil
+		}
+	}
+}
+
+func (c *MultipartClient) Subscribe(req Request, handler SubscriptionHandler) (id string, err error) {
+	return c.SubscribeContext(context.Background(), req, handler)
+}
+
+// SubscribeContext returns after response header received.
+// ctx applies to sending request, cancelling ctx after subscribed will unsubscribe.
+func (c *MultipartClient) SubscribeContext(ctx context.Context, req Request, handler SubscriptionHandler) (id string, err error) {
+	return subscribeContext(ctx, req, handler, c.subscribe, c.Unsubscribe)
+}
+
+func (c *MultipartClient) subscribe(ctx context.Context, req Request, handler SubscriptionHandler, onRelease func(err error)) (id string, err error) {
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	default:
+	}
+	id = fmt.Sprint(atomic.AddInt64(&c.id, 1))
+	subCtx, cancel := context.WithCancel(context.Background())
+	sub := &httpSubscription{
+		req:       req,
+		handler:   handler,
+		ctx:       subCtx,
+		cancel:    cancel,
+		onRelease: onRelease,
+	}
+	c.mutex.Lock()
+	if c.closed {
+		c.mutex.Unlock()
+		cancel()
+		return "", errMultipartClientClosed
+	}
+	c.subs[id] = sub
+	c.mutex.Unlock()
+
+	resp, err := c.connect(ctx, sub)
+	if err != nil {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		c.deleteSub(id, err)
+		return "", err
+	}
+	go c.run(id, sub, resp)
+	return id, nil
+}
+
+func (c *MultipartClient) SubscribeChan(req Request) (*Subscription, error) {
+	return c.SubscribeChanContext(context.Background(), req)
+}
+
+// SubscribeChanContext is like SubscribeContext, Subscription.Err returns ctx.Err() when ctx cancelled
+func (c *MultipartClient) SubscribeChanContext(ctx context.Context, req Request) (*Subscription, error) {
+	return subscribeChan(ctx, req, c.subscribe, c.Unsubscribe)
+}
+
+// Unsubscribe closes the response of subscription
+func (c *MultipartClient) Unsubscribe(id string) error {
+	c.deleteSub(id, nil)
+	return nil
+}
+
+// Close unsubscribes all subscriptions, MultipartClient can't be used after closed
+func (c *MultipartClient) Close() error {
+	c.mutex.Lock()
+	c.closed = true
+	ids := make([]string, 0, len(c.subs))
+	for id := range c.subs {
+		ids = append(ids, id)
+	}
+	c.mutex.Unlock()
+	for _, id := range ids {
+		c.deleteSub(id, errMultipartClientClosed)
+	}
+	return nil
+}
+
+// deleteSub reports whether the subscription existed
+func (c *MultipartClient) deleteSub(id string, err error) bool {
+	c.mutex.Lock()
+	sub, ok := c.subs[id]
+	if ok {
+		delete(c.subs, id)
+	}
+	c.mutex.Unlock()
+	if ok {
+		sub.release(err)
+	}
+	return ok
+}
+
+func (c *MultipartClient) connect(ctx context.Context, sub *httpSubscription) (*http.Response, error) {
+	body, err := json.Marshal(sub.req)
+	if err != nil {
+		return nil, errors.Wrap(err, "json encode graphql request")
+	}
+	endpoint := c.Endpoint
+	if endpoint == "" {
+		endpoint = c.option.Endpoint
+	}
+	httpReq, err := c.option.newRequest(sub.ctx, http.MethodPost, endpoint, body, multipartSubscriptionAccept, sub.req)
+	if err != nil {
+		return nil, err
+	}
+	stop := cancelOnDone(ctx, sub.cancel)
+	defer stop()
+	return c.option.do(httpReq, http.StatusOK)
+}
+
+// run reads parts of response until subscription ended, the final boundary means server completed the subscription
+func (c *MultipartClient) run(id string, sub *httpSubscription, resp *http.Response) {
+	defer resp.Body.Close()
+	var err error
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType == "application/json" {
+		var body []byte
+		if body, err = ioutil.ReadAll(resp.Body); err == nil {
+			c.dispatch(id, sub, body, false)
+		}
+	} else {
+		err = readParts(resp, func(body []byte) bool {
+			return c.dispatch(id, sub, body, true)
+		})
+	}
+	if sub.ctx.Err() != nil {
+		return
+	}
+	if err != nil {
+		if c.option.Log != nil {
+			c.option.Log("multipart read: " + err.Error())
+		}
+		c.deleteSub(id, err)
+		return
+	}
+	if sub.handler != nil {
+		_ = sub.handler(nil, nil, true)
+	}
+	c.deleteSub(id, ErrSubscriptionCompleted)
+}
+
+// dispatch reports whether the subscription ended, body is an execution result if it's not wrapped in a part
+func (c *MultipartClient) dispatch(id string, sub *httpSubscription, body []byte, wrapped bool) bool {
+	if c.option.Log != nil {
+		c.option.Log("multipart recv: " + string(body))
+	}
+	payload := json.RawMessage(body)
+	if wrapped {
+		msg := multipartMessage{}
+		if err := json.Unmarshal(body, &msg); err != nil {
+			if c.option.Log != nil {
+				c.option.Log("multipart: " + err.Error())
+			}
+			return false
+		}
+		if len(msg.Errors) > 0 {
+			errs := graphQLTransportWS{}.errors(msg.Errors)
+			if sub.handler != nil {
+				_ = sub.handler(nil, errs, false)
+			}
+			c.deleteSub(id, errs)
+			return true
+		}
+		// heartbeat
+		if len(msg.Payload) == 0 || string(msg.Payload) == "null" {
+			return false
+		}
+		payload = msg.Payload
+	}
+	data, errs, err := executionResult(payload)
+	if err != nil {
+		if c.option.Log != nil {
+			c.option.Log("multipart: " + err.Error())
+		}
+		return false
+	}
+	if sub.handler != nil {
+		if err := sub.handler(data, errs, false); err != nil {
+			_ = c.Unsubscribe(id)
+			return true
+		}
+	}
+	return false
+}
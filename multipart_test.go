@@ -0,0 +1,52 @@
+package gqlgo
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMultipartClient(t *testing.T) {
+	as := assert.New(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		as.Equal(multipartSubscriptionAccept, r.Header.Get("Accept"))
+		w.Header().Set("Content-Type", `multipart/mixed;boundary="graphql";subscriptionSpec="1.0"`)
+		parts := []string{`{}`, `{"payload":{"data":{"n":1}}}`, `{}`, `{"payload":{"data":null,"errors":[{"message":"resolver"}]}}`}
+		if r.URL.Path == "/error" {
+			parts = append(parts, `{"payload":null,"errors":[{"message":"router"}]}`)
+		}
+		for _, part := range parts {
+			_, _ = fmt.Fprintf(w, "\r\n--graphql\r\ncontent-type: application/json\r\n\r\n%s", part)
+			w.(http.Flusher).Flush()
+		}
+		_, _ = fmt.Fprint(w, "\r\n--graphql--\r\n")
+	}))
+	defer server.Close()
+	client := NewClient(server.URL)
+	client.SubscriptionTransport = NewMultipartClient(client.Option)
+	defer client.SubscriptionTransport.Close()
+
+	sub, err := client.SubscribeChan(Request{Query: "subscription{n}"})
+	require.NoError(t, err)
+	as.JSONEq(`{"n":1}`, string(recvEvent(t, sub).Data))
+	ev := recvEvent(t, sub)
+	as.JSONEq(`null`, string(ev.Data))
+	as.Equal("resolver", ev.Errors[0].Message)
+	as.True(recvEvent(t, sub).Completed)
+	<-sub.Done()
+	as.Equal(ErrSubscriptionCompleted, sub.Err())
+
+	client.Endpoint = server.URL + "/error"
+	sub, err = client.SubscribeChan(Request{Query: "subscription{n}"})
+	require.NoError(t, err)
+	recvEvent(t, sub)
+	recvEvent(t, sub)
+	ev = recvEvent(t, sub)
+	as.Nil(ev.Data)
+	<-sub.Done()
+	as.Equal(GraphQLErrors{{Message: "router"}}, sub.Err())
+}
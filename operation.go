@@ -0,0 +1,112 @@
+package gqlgo
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/poohvpn/gqlgo/ast"
+)
+
+// parsedQuery is the document of Request.Query shared by copies of a request sent by Client.Do,
+// it's parsed on first use, so a request is parsed at most once, and not at all if no one needs the document
+type parsedQuery struct {
+	query string
+	once  sync.Once
+	doc   *ast.Document
+	err   error
+}
+
+// Document returns the parsed Query. For requests sent by Client.Do, it's parsed once on first use
+// and shared by Validator and Client, Query is parsed again only if it's changed after that, like by Middlewares.
+func (r Request) Document() (*ast.Document, error) {
+	if r.parsed != nil && r.parsed.query == r.Query {
+		r.parsed.once.Do(func() {
+			r.parsed.doc, r.parsed.err = ast.Parse(r.Query)
+		})
+		return r.parsed.doc, r.parsed.err
+	}
+	return ast.Parse(r.Query)
+}
+
+// parseRequests returns the copies of requests sharing their documents, which are parsed lazily by Request.Document
+func parseRequests(requests []Request) []Request {
+	parsed := make([]Request, len(requests))
+	for i, req := range requests {
+		req.parsed = &parsedQuery{query: req.Query}
+		parsed[i] = req
+	}
+	return parsed
+}
+
+// operationType returns "query", "mutation" or "subscription" of the operation named OperationName in req.
+// When OperationName is empty and document has multiple operations, "mutation" is returned if any of them is a mutation.
+// Empty string is returned if the operation is not found or document has syntax error.
+func operationType(req Request) string {
+	doc, err := req.Document()
+	if err != nil {
+		return ""
+	}
+	typ := ""
+	for _, op := range doc.Operations {
+		switch {
+		case req.OperationName != "":
+			if op.Name == req.OperationName {
+				return string(op.Operation)
+			}
+		case op.Operation == ast.Mutation || typ == "":
+			typ = string(op.Operation)
+		}
+	}
+	return typ
+}
+
+// hasIncrementalDirective reports whether req may be delivered incrementally
+func hasIncrementalDirective(req Request) bool {
+	if !strings.Contains(req.Query, "@defer") && !strings.Contains(req.Query, "@stream") {
+		return false
+	}
+	doc, err := req.Document()
+	if err != nil {
+		return false
+	}
+	for _, op := range doc.Operations {
+		if selectionsHaveDirective(op.SelectionSet, "defer", "stream") {
+			return true
+		}
+	}
+	for _, fragment := range doc.Fragments {
+		if selectionsHaveDirective(fragment.SelectionSet, "defer", "stream") {
+			return true
+		}
+	}
+	return false
+}
+
+// selectionsHaveDirective reports whether any of names is used in set recursively
+func selectionsHaveDirective(set ast.SelectionSet, names ...string) bool {
+	for _, selection := range set {
+		var (
+			directives []*ast.Directive
+			subSet     ast.SelectionSet
+		)
+		switch s := selection.(type) {
+		case *ast.Field:
+			directives, subSet = s.Directives, s.SelectionSet
+		case *ast.FragmentSpread:
+			directives = s.Directives
+		case *ast.InlineFragment:
+			directives, subSet = s.Directives, s.SelectionSet
+		}
+		for _, directive := range directives {
+			for _, name := range names {
+				if directive.Name == name {
+					return true
+				}
+			}
+		}
+		if selectionsHaveDirective(subSet, names...) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,181 @@
+package gqlgo
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+)
+
+// Automatic Persisted Queries, https://www.apollographql.com/docs/apollo-server/performance/apq/
+const (
+	persistedQueryNotFound     = "PersistedQueryNotFound"
+	persistedQueryNotSupported = "PersistedQueryNotSupported"
+)
+
+// persistedQueryState is shared by Client and its WSClient, hashes are always sent without queries first
+type persistedQueryState struct {
+	// unsupported is set when server replied PersistedQueryNotSupported
+	unsupported int32
+}
+
+func (p *persistedQueryState) isUnsupported() bool {
+	return atomic.LoadInt32(&p.unsupported) == 1
+}
+
+func (p *persistedQueryState) setUnsupported() {
+	atomic.StoreInt32(&p.unsupported, 1)
+}
+
+func sha256Hash(query string) string {
+	sum := sha256.Sum256([]byte(query))
+	return hex.EncodeToString(sum[:])
+}
+
+// persistedRequest returns a copy of req with extensions.persistedQuery, query is removed unless withQuery is true
+func persistedRequest(req Request, withQuery bool) (Request, error) {
+	extensions, err := withExtension(req.Extensions, "persistedQuery", map[string]interface{}{
+		"version":    1,
+		"sha256Hash": sha256Hash(req.Query),
+	})
+	if err != nil {
+		return req, err
+	}
+	req.Extensions = extensions
+	if !withQuery {
+		req.Query = ""
+	}
+	return req, nil
+}
+
+// persistedQueryErrors reports the persisted query errors in err,
+// which is GraphQLErrors or DetailError of non 200 response carrying errors.
+func persistedQueryErrors(err error) (notFound, notSupported bool) {
+	for _, e := range graphQLErrorsOf(err) {
+		code, _ := e.Extensions["code"].(string)
+		switch {
+		case e.Message == persistedQueryNotFound || code == "PERSISTED_QUERY_NOT_FOUND":
+			notFound = true
+		case e.Message == persistedQueryNotSupported || code == "PERSISTED_QUERY_NOT_SUPPORTED":
+			notSupported = true
+		}
+	}
+	return notFound, notSupported
+}
+
+// doPersistedQuery sends hashes of queries first, and sends queries again with hashes for the hashes unknown by server.
+// Only the requests of batch failed by unknown hashes are sent again.
+// If server doesn't support persisted queries, queries are sent as usual from then on.
+func (c *Client) doPersistedQuery(ctx context.Context, res interface{}, onChunk IncrementalHandler, requests []Request) error {
+	opt := c.sendOption(requests)
+	if !c.PersistedQueries || c.persistedQueries.isUnsupported() {
+		return c.doRequests(ctx, res, onChunk, opt, requests...)
+	}
+	hashed := make([]Request, len(requests))
+	for i, req := range requests {
+		var err error
+		if hashed[i], err = persistedRequest(req, false); err != nil {
+			return err
+		}
+	}
+	firstOnChunk := onChunk
+	if onChunk != nil {
+		// the response of unknown hash is not a result, the request is sent again
+		firstOnChunk = func(rawMsg json.RawMessage, gqlErrs GraphQLErrors, hasNext bool) error {
+			if notFound, notSupported := persistedQueryErrors(gqlErrs); notFound || notSupported {
+				return nil
+			}
+			return onChunk(rawMsg, gqlErrs, hasNext)
+		}
+	}
+	err := c.doRequests(ctx, res, firstOnChunk, opt, hashed...)
+	notFound, notSupported := persistedQueryErrors(err)
+	if notSupported {
+		c.persistedQueries.setUnsupported()
+	}
+	if notFound || notSupported {
+		if len(requests) == 1 {
+			if notFound {
+				if hashed[0], err = persistedRequest(requests[0], true); err != nil {
+					return err
+				}
+			} else {
+				hashed[0] = requests[0]
+			}
+			err = c.doRequests(ctx, res, onChunk, opt, hashed...)
+		} else {
+			err = c.resendPersistedQueries(ctx, res.([]interface{}), opt, requests, err, notSupported)
+		}
+	}
+	return err
+}
+
+// resendPersistedQueries sends the requests of batch failed by persisted query errors again,
+// queries are sent with hashes, or without hashes if notSupported. Errors of all requests are merged into BatchError.
+func (c *Client) resendPersistedQueries(ctx context.Context, resList []interface{}, opt sendOption, requests []Request, err error, notSupported bool) error {
+	batchErr := &BatchError{}
+	if !errors.As(err, &batchErr) {
+		// the whole batch failed without results, like non 200 response
+		batchErr = &BatchError{Errors: make([]GraphQLErrors, len(requests))}
+		for i := range batchErr.Errors {
+			batchErr.Errors[i] = GraphQLErrors{{Message: persistedQueryNotFound}}
+		}
+	}
+	errs := append([]GraphQLErrors(nil), batchErr.Errors...)
+	var (
+		indexes    []int
+		resendReqs []Request
+		resendRes  []interface{}
+	)
+	for i, req := range requests {
+		if len(errs[i]) == 0 {
+			continue
+		}
+		if notFound, notSupported := persistedQueryErrors(errs[i]); !notFound && !notSupported {
+			continue
+		}
+		if !notSupported {
+			var err error
+			if req, err = persistedRequest(req, true); err != nil {
+				return err
+			}
+		}
+		indexes = append(indexes, i)
+		resendReqs = append(resendReqs, req)
+		resendRes = append(resendRes, resList[i])
+	}
+	if len(resendReqs) == 0 {
+		return err
+	}
+	var resendErr error
+	if len(resendReqs) == 1 {
+		resendErr = c.doRequests(ctx, resendRes[0], nil, sendOption{}, resendReqs...)
+	} else {
+		resendErr = c.doRequests(ctx, resendRes, nil, sendOption{}, resendReqs...)
+	}
+	resendBatchErr := &BatchError{}
+	var gqlErrs GraphQLErrors
+	switch {
+	case resendErr == nil:
+		for _, i := range indexes {
+			errs[i] = nil
+		}
+	case errors.As(resendErr, &resendBatchErr):
+		for k, i := range indexes {
+			errs[i] = resendBatchErr.Errors[k]
+		}
+	case len(indexes) == 1 && errors.As(resendErr, &gqlErrs):
+		errs[indexes[0]] = gqlErrs
+	default:
+		return resendErr
+	}
+	for _, e := range errs {
+		if len(e) > 0 {
+			return &BatchError{Errors: errs}
+		}
+	}
+	return nil
+}
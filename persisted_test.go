@@ -0,0 +1,270 @@
+package gqlgo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/poohvpn/gqlgo/gqlws"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testAPQServer replies {"query":<query>} for every request
+type testAPQServer struct {
+	*httptest.Server
+	mutex    sync.Mutex
+	queries  map[string]string
+	requests int
+	// executed is the queries executed, sent is the queries of requests including empty ones of hashes
+	executed []string
+	sent     []string
+	accept   string
+}
+
+type testAPQRequest struct {
+	Query      string `json:"query"`
+	Extensions struct {
+		PersistedQuery struct {
+			Version    int    `json:"version"`
+			Sha256Hash string `json:"sha256Hash"`
+		} `json:"persistedQuery"`
+	} `json:"extensions"`
+}
+
+func newTestAPQServer() *testAPQServer {
+	s := &testAPQServer{queries: make(map[string]string)}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqs []testAPQRequest
+		var req testAPQRequest
+		body, _ := ioutil.ReadAll(r.Body)
+		batch := bytes.HasPrefix(bytes.TrimSpace(body), []byte("["))
+		if batch {
+			_ = json.Unmarshal(body, &reqs)
+		} else {
+			_ = json.Unmarshal(body, &req)
+			reqs = append(reqs, req)
+		}
+		s.mutex.Lock()
+		s.requests++
+		s.accept = r.Header.Get("Accept")
+		var resps []interface{}
+		for _, req := range reqs {
+			hash := req.Extensions.PersistedQuery.Sha256Hash
+			s.sent = append(s.sent, req.Query)
+			if req.Query != "" {
+				s.queries[hash] = req.Query
+			}
+			if query, ok := s.queries[hash]; ok {
+				s.executed = append(s.executed, query)
+				resps = append(resps, map[string]interface{}{"data": map[string]string{"query": query}})
+			} else {
+				resps = append(resps, map[string]interface{}{"errors": []GraphQLError{{
+					Message:    persistedQueryNotFound,
+					Extensions: map[string]interface{}{"code": "PERSISTED_QUERY_NOT_FOUND"},
+				}}})
+			}
+		}
+		s.mutex.Unlock()
+		if batch {
+			_ = json.NewEncoder(w).Encode(resps)
+		} else {
+			_ = json.NewEncoder(w).Encode(resps[0])
+		}
+	}))
+	return s
+}
+
+func (s *testAPQServer) takeRequests() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	n := s.requests
+	s.requests = 0
+	s.executed = nil
+	return n
+}
+
+func TestClientPersistedQueries(t *testing.T) {
+	as := assert.New(t)
+	server := newTestAPQServer()
+	defer server.Close()
+	client := NewClient(server.URL, Option{PersistedQueries: true})
+
+	// hash only first, query is sent again when server doesn't know the hash
+	data := struct{ Query string }{}
+	require.NoError(t, client.Do(context.Background(), &data, Request{Query: "{a}"}))
+	as.Equal("{a}", data.Query)
+	as.Equal(2, server.takeRequests())
+	require.NoError(t, client.Do(context.Background(), &data, Request{Query: "{a}"}))
+	as.Equal(1, server.takeRequests())
+
+	data2 := struct{ Query string }{}
+	require.NoError(t, client.Do(context.Background(), []interface{}{&data, &data2},
+		Request{Query: "{a}"},
+		Request{Query: "{b}"},
+	))
+	as.Equal("{b}", data2.Query)
+	as.Equal(2, server.takeRequests())
+	require.NoError(t, client.Do(context.Background(), []interface{}{&data, &data2},
+		Request{Query: "{a}"},
+		Request{Query: "{b}"},
+	))
+	as.Equal(1, server.takeRequests())
+
+	// server lost the hash
+	server.mutex.Lock()
+	delete(server.queries, sha256Hash("{a}"))
+	server.mutex.Unlock()
+	require.NoError(t, client.Do(context.Background(), &data, Request{Query: "{a}"}))
+	as.Equal("{a}", data.Query)
+	as.Equal(2, server.takeRequests())
+}
+
+func TestClientPersistedQueriesHashOnly(t *testing.T) {
+	as := assert.New(t)
+	server := newTestAPQServer()
+	defer server.Close()
+	server.queries[sha256Hash("{a}")] = "{a}"
+	client := NewClient(server.URL, Option{PersistedQueries: true})
+
+	// the first call of process sends only the hash known by server
+	data := struct{ Query string }{}
+	require.NoError(t, client.Do(context.Background(), &data, Request{Query: "{a}"}))
+	as.Equal("{a}", data.Query)
+	server.mutex.Lock()
+	as.Equal([]string{""}, server.sent)
+	server.mutex.Unlock()
+}
+
+func TestClientPersistedQueriesBatchNotFound(t *testing.T) {
+	as := assert.New(t)
+	server := newTestAPQServer()
+	defer server.Close()
+	client := NewClient(server.URL, Option{PersistedQueries: true})
+	server.queries[sha256Hash("{b}")] = "{b}"
+
+	data := [3]struct{ Query string }{}
+	require.NoError(t, client.Do(context.Background(), []interface{}{&data[0], &data[1], &data[2]},
+		Request{Query: "{a}"},
+		Request{Query: "mutation{m}"},
+		Request{Query: "{b}"},
+	))
+	as.Equal("{a}", data[0].Query)
+	as.Equal("mutation{m}", data[1].Query)
+	as.Equal("{b}", data[2].Query)
+	server.mutex.Lock()
+	as.Equal([]string{"{b}", "{a}", "mutation{m}"}, server.executed)
+	server.mutex.Unlock()
+	as.Equal(2, server.takeRequests())
+}
+
+func TestClientPersistedQueriesIncremental(t *testing.T) {
+	as := assert.New(t)
+	server := newTestAPQServer()
+	defer server.Close()
+	client := NewClient(server.URL, Option{PersistedQueries: true})
+
+	query := "{ a ... @defer { b } }"
+	require.NoError(t, client.Do(context.Background(), nil, Request{Query: query}))
+	as.Equal(incrementalAccept, server.accept)
+	require.NoError(t, client.Do(context.Background(), nil, Request{Query: query}))
+	as.Equal(incrementalAccept, server.accept)
+	as.Equal(3, server.takeRequests())
+
+	// the response of unknown hash is not passed to handler
+	var chunks []string
+	require.NoError(t, client.DoIncremental(context.Background(), nil, Request{Query: "{c}"},
+		func(rawMsg json.RawMessage, gqlErrs GraphQLErrors, hasNext bool) error {
+			as.Empty(gqlErrs)
+			chunks = append(chunks, string(rawMsg))
+			return nil
+		}))
+	as.Equal([]string{`{"query":"{c}"}`}, chunks)
+	as.Equal(2, server.takeRequests())
+}
+
+func TestWSClientPersistedQueries(t *testing.T) {
+	as := assert.New(t)
+	server := newTestWSServer(gqlws.ProtocolGraphQLWS)
+	defer server.Close()
+	client := NewWSClient(server.endpoint(), WSOption{PersistedQueries: true})
+	defer client.Close()
+
+	for _, query := range []string{"subscription{a}", "subscription{b}"} {
+		_, err := client.Subscribe(Request{Query: query}, nil)
+		require.NoError(t, err)
+	}
+	start := testAPQRequest{}
+	as.NoError(json.Unmarshal(server.expect(t, gqlws.MsgTypeStart).Payload, &start))
+	as.Equal("", start.Query)
+	as.Equal(sha256Hash("subscription{a}"), start.Extensions.PersistedQuery.Sha256Hash)
+	as.NoError(json.Unmarshal(server.expect(t, gqlws.MsgTypeStart).Payload, &start))
+	as.Equal("", start.Query)
+	as.Equal(sha256Hash("subscription{b}"), start.Extensions.PersistedQuery.Sha256Hash)
+	as.Equal(1, start.Extensions.PersistedQuery.Version)
+}
+
+func TestWSClientPersistedQueryNotFound(t *testing.T) {
+	as := assert.New(t)
+	server := newTestWSServer(gqlws.ProtocolGraphQLWS)
+	server.persistedQueries = true
+	defer server.Close()
+	client := NewWSClient(server.endpoint(), WSOption{PersistedQueries: true})
+	defer client.Close()
+	hash := sha256Hash("subscription{a}")
+
+	data := make(chan json.RawMessage, 1)
+	var gotErrs GraphQLErrors
+	_, err := client.Subscribe(Request{Query: "subscription{a}"},
+		func(rawMsg json.RawMessage, gqlErrs GraphQLErrors, completed bool) error {
+			gotErrs = append(gotErrs, gqlErrs...)
+			if rawMsg != nil {
+				data <- rawMsg
+			}
+			return nil
+		})
+	require.NoError(t, err)
+
+	first := server.expect(t, gqlws.MsgTypeStart)
+	start := testAPQRequest{}
+	as.NoError(json.Unmarshal(first.Payload, &start))
+	as.Equal("", start.Query)
+	second := server.expect(t, gqlws.MsgTypeStart)
+	as.Equal(first.ID, second.ID)
+	as.NoError(json.Unmarshal(second.Payload, &start))
+	as.Equal("subscription{a}", start.Query)
+	as.Equal(hash, start.Extensions.PersistedQuery.Sha256Hash)
+	as.JSONEq(`{"n":1}`, string(recvData(t, data)))
+	as.Empty(gotErrs)
+}
+
+func TestWSClientPersistedQueryStartError(t *testing.T) {
+	as := assert.New(t)
+	server := newTestWSServer(gqlws.ProtocolGraphQLWS)
+	defer server.Close()
+	client := NewWSClient(server.endpoint(), WSOption{PersistedQueries: true})
+	defer client.Close()
+	invalid := Request{Query: "subscription{a}", Extensions: 1}
+
+	// waiting for connection_ack
+	_, err := client.Subscribe(invalid, nil)
+	as.EqualError(err, "extensions should be a JSON object: json: cannot unmarshal number into Go value of type map[string]interface {}")
+	// after connection_ack
+	_, err = client.Subscribe(invalid, nil)
+	as.Error(err)
+	id, err := client.Subscribe(Request{Query: "subscription{b}"}, nil)
+	require.NoError(t, err)
+	as.Equal(id, server.expect(t, gqlws.MsgTypeStart).ID)
+
+	var ids []string
+	client.subs.Range(func(id, _ interface{}) bool {
+		ids = append(ids, id.(string))
+		return true
+	})
+	as.Equal([]string{id}, ids)
+}
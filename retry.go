@@ -0,0 +1,192 @@
+package gqlgo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/jpillora/backoff"
+	"github.com/pkg/errors"
+)
+
+// RetryPolicy retries Client.Do failed by timeout, refused or reset connection, response broken unexpectedly,
+// or retryable HTTP status codes. GraphQL errors are never retried,
+// nor Client.DoIncremental once any chunk was passed to its handler.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum attempts including the first one, default is 3
+	MaxAttempts int
+
+	// MinBackoff is the first backoff, default is 100 milliseconds
+	MinBackoff time.Duration
+
+	// MaxBackoff is the maximum backoff, default is 10 seconds
+	MaxBackoff time.Duration
+
+	// Factor multiplies backoff after each attempt, default is 2
+	Factor float64
+
+	// StatusCodes are retryable HTTP status codes, default is 429, 502, 503 and 504.
+	// Retry-After header of response is honored.
+	StatusCodes []int
+
+	// RetryMutations allows retrying mutations, which may not be idempotent
+	RetryMutations bool
+}
+
+var defaultRetryStatusCodes = []int{
+	http.StatusTooManyRequests,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// retryable reports whether err is retryable, wait is the duration required by Retry-After header
+func (p *RetryPolicy) retryable(err error) (wait time.Duration, ok bool) {
+	detailErr := &DetailError{}
+	if errors.As(err, &detailErr) {
+		if detailErr.Response == nil {
+			return 0, false
+		}
+		if retryableNetworkError(detailErr.OriginError) {
+			return 0, true
+		}
+		statusCodes := p.StatusCodes
+		if statusCodes == nil {
+			statusCodes = defaultRetryStatusCodes
+		}
+		for _, code := range statusCodes {
+			if detailErr.Response.StatusCode == code {
+				return retryAfter(detailErr.Response.Header.Get("Retry-After")), true
+			}
+		}
+		return 0, false
+	}
+	return 0, retryableNetworkError(err)
+}
+
+// retryableNetworkError reports whether err is a timeout, refused or reset connection, or a response broken unexpectedly
+func retryableNetworkError(err error) bool {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// retryAfter parses Retry-After header in seconds or HTTP date
+func retryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if wait := time.Until(date); wait > 0 {
+			return wait
+		}
+	}
+	return 0
+}
+
+// rewindableFiles returns the current offsets of uploading files, ok is false if any of them is not an io.Seeker
+func rewindableFiles(requests []Request) (offsets map[io.Seeker]int64, ok bool) {
+	files, err := checkFileUpload(len(requests) == 1, requests)
+	if err != nil {
+		return nil, false
+	}
+	offsets = make(map[io.Seeker]int64)
+	for reader := range files {
+		seeker, ok := reader.(io.Seeker)
+		if !ok {
+			return nil, false
+		}
+		offset, err := seeker.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, false
+		}
+		offsets[seeker] = offset
+	}
+	return offsets, true
+}
+
+// doRetry retries requests by RetryPolicy, mutations and uploads of files which can't be rewound are sent once
+func (c *Client) doRetry(ctx context.Context, res interface{}, onChunk IncrementalHandler, requests []Request) error {
+	policy := c.RetryPolicy
+	if policy == nil {
+		return c.doPersistedQuery(ctx, res, onChunk, requests)
+	}
+	if !policy.RetryMutations {
+		for _, req := range requests {
+			if operationType(req) == "mutation" {
+				return c.doPersistedQuery(ctx, res, onChunk, requests)
+			}
+		}
+	}
+	offsets, ok := rewindableFiles(requests)
+	if !ok {
+		return c.doPersistedQuery(ctx, res, onChunk, requests)
+	}
+	maxAttempts := policy.MaxAttempts
+	if maxAttempts == 0 {
+		maxAttempts = 3
+	}
+	b := &backoff.Backoff{
+		Factor: policy.Factor,
+		Jitter: true,
+		Min:    policy.MinBackoff,
+		Max:    policy.MaxBackoff,
+	}
+	if b.Factor == 0 {
+		b.Factor = 2
+	}
+	if b.Min == 0 {
+		b.Min = 100 * time.Millisecond
+	}
+	if b.Max == 0 {
+		b.Max = 10 * time.Second
+	}
+	// chunks delivered to onChunk can't be taken back, so never retry after that
+	delivered := false
+	if onChunk != nil {
+		handler := onChunk
+		onChunk = func(rawMsg json.RawMessage, gqlErrs GraphQLErrors, hasNext bool) error {
+			delivered = true
+			return handler(rawMsg, gqlErrs, hasNext)
+		}
+	}
+	for attempt := 1; ; attempt++ {
+		err := c.doPersistedQuery(ctx, res, onChunk, requests)
+		if err == nil || delivered || attempt >= maxAttempts || ctx.Err() != nil {
+			return err
+		}
+		wait, ok := policy.retryable(err)
+		if !ok {
+			return err
+		}
+		if backoffWait := b.Duration(); wait < backoffWait {
+			wait = backoffWait
+		}
+		if c.Log != nil {
+			c.Log(fmt.Sprintf("retry in %s, attempt %d: %s", wait, attempt+1, err))
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+		for seeker, offset := range offsets {
+			if _, err := seeker.Seek(offset, io.SeekStart); err != nil {
+				return errors.Wrap(err, "rewind file for retry")
+			}
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package gqlgo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientRetryPolicy(t *testing.T) {
+	as := assert.New(t)
+	attempts := 0
+	var uploads []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if file, _, err := r.FormFile("0"); err == nil {
+			content, _ := ioutil.ReadAll(file)
+			uploads = append(uploads, string(content))
+		}
+		if attempts%3 != 0 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(`{"data":{"a":1}}`))
+	}))
+	defer server.Close()
+	client := NewClient(server.URL, Option{RetryPolicy: &RetryPolicy{MinBackoff: time.Millisecond}})
+	ctx := context.Background()
+
+	as.NoError(client.Do(ctx, nil, Request{Query: "{a}"}))
+	as.Equal(3, attempts)
+
+	attempts = 0
+	as.Error(client.Do(ctx, nil, Request{Query: "mutation{a}"}))
+	as.Equal(1, attempts)
+
+	attempts = 0
+	as.NoError(client.Do(ctx, nil, Request{Query: "query($f:Upload){a}", Variables: map[string]interface{}{
+		"f": File{Reader: strings.NewReader("file"), Name: "f"},
+	}}))
+	as.Equal(3, attempts)
+	as.Equal([]string{"file", "file", "file"}, uploads)
+
+	attempts = 0
+	as.Error(client.Do(ctx, nil, Request{Query: "query($f:Upload){a}", Variables: map[string]interface{}{
+		"f": File{Reader: io.MultiReader(strings.NewReader("file")), Name: "f"},
+	}}))
+	as.Equal(1, attempts)
+}
+
+func TestRetryAfter(t *testing.T) {
+	as := assert.New(t)
+	as.Equal(2*time.Second, retryAfter("2"))
+	as.Equal(time.Duration(0), retryAfter("Wed, 21 Oct 2015 07:28:00 GMT"))
+	as.InDelta(float64(time.Minute), float64(retryAfter(time.Now().Add(time.Minute).UTC().Format(http.TimeFormat))), float64(2*time.Second))
+}
+
+func TestRetryNetworkErrors(t *testing.T) {
+	as := assert.New(t)
+	var retries int32
+	policy := &RetryPolicy{MinBackoff: time.Millisecond}
+	newClient := func(endpoint string) *Client {
+		return NewClient(endpoint, Option{RetryPolicy: policy, Log: func(s string) {
+			if strings.HasPrefix(s, "retry in") {
+				atomic.AddInt32(&retries, 1)
+			}
+		}})
+	}
+	ctx := context.Background()
+
+	// response shorter than Content-Length
+	attempts := int32(0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) < 3 {
+			w.Header().Set("Content-Length", "100")
+			_, _ = w.Write([]byte(`{"data"`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"data":{"a":1}}`))
+	}))
+	defer server.Close()
+	as.NoError(newClient(server.URL).Do(ctx, nil, Request{Query: "{a}"}))
+	as.Equal(int32(3), atomic.LoadInt32(&attempts))
+	as.Equal(int32(2), atomic.SwapInt32(&retries, 0))
+
+	// connection refused
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	refused := "http://" + listener.Addr().String()
+	_ = listener.Close()
+	as.Error(newClient(refused).Do(ctx, nil, Request{Query: "{a}"}))
+	as.Equal(int32(2), atomic.SwapInt32(&retries, 0))
+
+	// other errors of url.Error are not retried
+	as.Error(newClient("ftp://127.0.0.1").Do(ctx, nil, Request{Query: "{a}"}))
+	as.Equal(int32(0), atomic.SwapInt32(&retries, 0))
+}
+
+func TestRetryIncrementalDelivered(t *testing.T) {
+	as := assert.New(t)
+	attempts := int32(0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", `multipart/mixed; boundary="-"; deferSpec=20220824`)
+		_, _ = fmt.Fprint(w, "\r\n---\r\nContent-Type: application/json\r\n\r\n{\"data\":{\"a\":1},\"hasNext\":true}\r\n---\r\n")
+		w.(http.Flusher).Flush()
+		// break connection before the last part
+		panic(http.ErrAbortHandler)
+	}))
+	defer server.Close()
+	client := NewClient(server.URL, Option{RetryPolicy: &RetryPolicy{MinBackoff: time.Millisecond}})
+
+	var chunks []string
+	err := client.DoIncremental(context.Background(), nil, Request{Query: "{a ...@defer{b}}"},
+		func(rawMsg json.RawMessage, gqlErrs GraphQLErrors, hasNext bool) error {
+			chunks = append(chunks, string(rawMsg))
+			return nil
+		})
+	as.Error(err)
+	as.Equal([]string{`{"a":1}`}, chunks)
+	as.Equal(int32(2), atomic.LoadInt32(&attempts))
+}
@@ -0,0 +1,651 @@
+package gqlgo
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"mime"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jpillora/backoff"
+	"github.com/pkg/errors"
+)
+
+// sseTokenHeader carries the reservation token of single connection mode
+const sseTokenHeader = "X-GraphQL-Event-Stream-Token"
+
+// SSEOption be changed at anytime after NewSSEClient, except SingleConnection
+type SSEOption struct {
+	// Endpoint specify graphql-sse endpoint, default is Option.Endpoint
+	Endpoint string
+
+	// SingleConnection makes all subscriptions share one event stream reserved from server,
+	// otherwise every subscription opens its own event stream.
+	SingleConnection bool
+
+	// disable automatic reconnecting
+	NotReconnect bool
+
+	// ReconnectAttempts is the maximum attempts of reconnection after event stream dropped, default is math.MaxUint32
+	ReconnectAttempts uint32
+}
+
+// SSEClient implements GraphQL over Server-Sent Events Protocol, https://github.com/enisdenjo/graphql-sse/blob/master/PROTOCOL.md
+// HTTPClient, Headers, BearerAuth, CloseBody and Log of Option apply to every http request.
+// Dropped event streams are reopened with Last-Event-ID header.
+type SSEClient struct {
+	*SSEOption
+	option *Option
+
+	id int64
+
+	// streamMutex serializes the opening of stream
+	streamMutex sync.Mutex
+
+	mutex  sync.Mutex
+	closed bool
+	subs   map[string]*httpSubscription
+	// stream is the shared event stream of single connection mode
+	stream *sseStream
+}
+
+// NewSSEClient only take the first SSEOption if given, opt is shared with Client to reuse its http settings
+func NewSSEClient(opt *Option, sseOpt ...SSEOption) *SSEClient {
+	client := &SSEClient{
+		SSEOption: &SSEOption{},
+		option:    opt,
+		subs:      make(map[string]*httpSubscription),
+	}
+	if len(sseOpt) > 0 {
+		client.SSEOption = &sseOpt[0]
+	}
+	if client.ReconnectAttempts == 0 {
+		client.ReconnectAttempts = math.MaxUint32
+	}
+	return client
+}
+
+type sseStream struct {
+	// token is guarded by SSEClient.mutex, it changes when reservation is made again
+	token  string
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// sseEvent is an event of text/event-stream, https://html.spec.whatwg.org/multipage/server-sent-events.html
+type sseEvent struct {
+	id    string
+	event string
+	data  string
+}
+
+type sseReader struct {
+	*bufio.Reader
+}
+
+func newSSEReader(r io.Reader) *sseReader {
+	return &sseReader{Reader: bufio.NewReader(r)}
+}
+
+// next returns the next event, comments and incomplete event at the end of stream are ignored
+func (r *sseReader) next() (*sseEvent, error) {
+	ev := &sseEvent{}
+	var (
+		data     []string
+		dispatch bool
+	)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+		if line == "" {
+			if dispatch {
+				ev.data = strings.Join(data, "\n")
+				return ev, nil
+			}
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+		field, value := line, ""
+		if i := strings.IndexByte(line, ':'); i >= 0 {
+			field, value = line[:i], strings.TrimPrefix(line[i+1:], " ")
+		}
+		switch field {
+		case "event":
+			ev.event = value
+		case "data":
+			data = append(data, value)
+		case "id":
+			ev.id = value
+		default:
+			continue
+		}
+		dispatch = true
+	}
+}
+
+func (c *SSEClient) Subscribe(req Request, handler SubscriptionHandler) (id string, err error) {
+	return c.SubscribeContext(context.Background(), req, handler)
+}
+
+// SubscribeContext returns after the event stream opened and the operation accepted by server.
+// ctx applies to the http requests of subscribing, cancelling ctx after subscribed will unsubscribe.
+func (c *SSEClient) SubscribeContext(ctx context.Context, req Request, handler SubscriptionHandler) (id string, err error) {
+	return subscribeContext(ctx, req, handler, c.subscribe, c.Unsubscribe)
+}
+
+func (c *SSEClient) subscribe(ctx context.Context, req Request, handler SubscriptionHandler, onRelease func(err error)) (id string, err error) {
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	default:
+	}
+	id = fmt.Sprint(atomic.AddInt64(&c.id, 1))
+	subCtx, cancel := context.WithCancel(context.Background())
+	sub := &httpSubscription{
+		req:       req,
+		handler:   handler,
+		ctx:       subCtx,
+		cancel:    cancel,
+		onRelease: onRelease,
+	}
+	c.mutex.Lock()
+	if c.closed {
+		c.mutex.Unlock()
+		cancel()
+		return "", errSSEClientClosed
+	}
+	c.subs[id] = sub
+	c.mutex.Unlock()
+
+	if c.SingleConnection {
+		err = c.execute(ctx, id, req)
+	} else {
+		var resp *http.Response
+		stop := cancelOnDone(ctx, cancel)
+		resp, err = c.connect(subCtx, req, "")
+		stop()
+		if err == nil {
+			go c.run(id, sub, resp)
+		}
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		c.deleteSub(id, err)
+		return "", err
+	}
+	return id, nil
+}
+
+func (c *SSEClient) SubscribeChan(req Request) (*Subscription, error) {
+	return c.SubscribeChanContext(context.Background(), req)
+}
+
+// SubscribeChanContext is like SubscribeContext, Subscription.Err returns ctx.Err() when ctx cancelled
+func (c *SSEClient) SubscribeChanContext(ctx context.Context, req Request) (*Subscription, error) {
+	return subscribeChan(ctx, req, c.subscribe, c.Unsubscribe)
+}
+
+func (c *SSEClient) Unsubscribe(id string) error {
+	return c.unsubscribe(id, nil)
+}
+
+// Close unsubscribes all subscriptions, SSEClient can't be used after closed
+func (c *SSEClient) Close() error {
+	c.mutex.Lock()
+	c.closed = true
+	ids := make([]string, 0, len(c.subs))
+	for id := range c.subs {
+		ids = append(ids, id)
+	}
+	c.mutex.Unlock()
+	var errs []error
+	for _, id := range ids {
+		if err := c.unsubscribe(id, errSSEClientClosed); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return errs[0]
+	}
+	return nil
+}
+
+// unsubscribe stops the operation in single connection mode, distinct event stream is closed by releasing subscription
+func (c *SSEClient) unsubscribe(id string, reason error) error {
+	c.mutex.Lock()
+	_, ok := c.subs[id]
+	stream := c.stream
+	token := ""
+	if stream != nil {
+		token = stream.token
+	}
+	c.mutex.Unlock()
+	if !ok {
+		return nil
+	}
+	var err error
+	if c.SingleConnection && stream != nil {
+		err = c.stop(token, id)
+	}
+	c.deleteSub(id, reason)
+	return err
+}
+
+// deleteSub reports whether the subscription existed, shared event stream is closed with the last subscription
+func (c *SSEClient) deleteSub(id string, err error) bool {
+	c.mutex.Lock()
+	sub, ok := c.subs[id]
+	if !ok {
+		c.mutex.Unlock()
+		return false
+	}
+	delete(c.subs, id)
+	stream := c.stream
+	if len(c.subs) > 0 {
+		stream = nil
+	}
+	if stream != nil {
+		c.stream = nil
+	}
+	c.mutex.Unlock()
+	sub.release(err)
+	if stream != nil {
+		stream.cancel()
+	}
+	return true
+}
+
+// dispatch reports whether the subscription ended
+func (c *SSEClient) dispatch(id string, sub *httpSubscription, event string, payload json.RawMessage) bool {
+	switch event {
+	case "next":
+		data, errs, err := executionResult(payload)
+		if err != nil {
+			if c.option.Log != nil {
+				c.option.Log("sse: " + err.Error())
+			}
+			return false
+		}
+		if sub.handler != nil {
+			if err := sub.handler(data, errs, false); err != nil {
+				_ = c.Unsubscribe(id)
+				return true
+			}
+		}
+	case "complete":
+		if sub.handler != nil {
+			_ = sub.handler(nil, nil, true)
+		}
+		c.deleteSub(id, ErrSubscriptionCompleted)
+		return true
+	}
+	return false
+}
+
+// run reads the distinct event stream of subscription until it ended
+func (c *SSEClient) run(id string, sub *httpSubscription, resp *http.Response) {
+	lastEventID := ""
+	for {
+		err := c.read(resp, &lastEventID, func(ev *sseEvent) bool {
+			return c.dispatch(id, sub, ev.event, json.RawMessage(ev.data))
+		})
+		if err == nil || sub.ctx.Err() != nil {
+			return
+		}
+		resp, err = c.reconnect(sub.ctx, err, func() (*http.Response, error) {
+			return c.connect(sub.ctx, sub.req, lastEventID)
+		})
+		if err != nil {
+			c.deleteSub(id, err)
+			return
+		}
+	}
+}
+
+// readStream reads the shared event stream until it closed
+func (c *SSEClient) readStream(stream *sseStream, resp *http.Response) {
+	lastEventID := ""
+	for {
+		err := c.read(resp, &lastEventID, func(ev *sseEvent) bool {
+			msg := struct {
+				ID      string          `json:"id"`
+				Payload json.RawMessage `json:"payload"`
+			}{}
+			if err := json.Unmarshal([]byte(ev.data), &msg); err != nil {
+				return false
+			}
+			c.mutex.Lock()
+			sub, ok := c.subs[msg.ID]
+			c.mutex.Unlock()
+			if ok {
+				c.dispatch(msg.ID, sub, ev.event, msg.Payload)
+			}
+			return false
+		})
+		if stream.ctx.Err() != nil {
+			return
+		}
+		resp, err = c.reconnect(stream.ctx, err, func() (*http.Response, error) {
+			return c.relisten(stream, &lastEventID)
+		})
+		if err != nil {
+			c.dropStream(stream, err)
+			return
+		}
+	}
+}
+
+// read dispatches events of resp until dispatch reports ended, a JSON response is taken as a single result
+func (c *SSEClient) read(resp *http.Response, lastEventID *string, dispatch func(ev *sseEvent) bool) error {
+	defer resp.Body.Close()
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType == "application/json" {
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		if !dispatch(&sseEvent{event: "next", data: string(body)}) {
+			dispatch(&sseEvent{event: "complete"})
+		}
+		return nil
+	}
+	r := newSSEReader(resp.Body)
+	for {
+		ev, err := r.next()
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			if c.option.Log != nil {
+				c.option.Log("sse read: " + err.Error())
+			}
+			return err
+		}
+		if ev.id != "" {
+			*lastEventID = ev.id
+		}
+		if c.option.Log != nil {
+			c.option.Log(fmt.Sprintf("sse recv event: %s, data: %s", ev.event, ev.data))
+		}
+		if dispatch(ev) {
+			return nil
+		}
+	}
+}
+
+// reconnect calls connect immediately, then retries with backoff until ReconnectAttempts exhausted
+func (c *SSEClient) reconnect(ctx context.Context, err error, connect func() (*http.Response, error)) (*http.Response, error) {
+	b := &backoff.Backoff{
+		Factor: 1.5,
+		Min:    time.Second,
+		Max:    30 * time.Second,
+	}
+	for attempt := uint32(0); ; attempt++ {
+		if c.NotReconnect || attempt >= c.ReconnectAttempts {
+			return nil, err
+		}
+		if attempt > 0 {
+			timer := time.NewTimer(b.Duration())
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return nil, ctx.Err()
+			}
+		}
+		if c.option.Log != nil {
+			c.option.Log(fmt.Sprintf("sse reconnecting, attempt %d", attempt+1))
+		}
+		var resp *http.Response
+		resp, err = connect()
+		if err == nil {
+			return resp, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// execute runs operation on the shared event stream
+func (c *SSEClient) execute(ctx context.Context, id string, req Request) error {
+	stream, err := c.getStream(ctx)
+	if err != nil {
+		return err
+	}
+	c.mutex.Lock()
+	token := stream.token
+	c.mutex.Unlock()
+	return c.operation(ctx, token, id, req)
+}
+
+// getStream reserves and opens the shared event stream if it's not opened
+func (c *SSEClient) getStream(ctx context.Context) (*sseStream, error) {
+	c.streamMutex.Lock()
+	defer c.streamMutex.Unlock()
+	c.mutex.Lock()
+	stream := c.stream
+	c.mutex.Unlock()
+	if stream != nil {
+		return stream, nil
+	}
+	token, err := c.reserve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	streamCtx, cancel := context.WithCancel(context.Background())
+	stream = &sseStream{
+		token:  token,
+		ctx:    streamCtx,
+		cancel: cancel,
+	}
+	stop := cancelOnDone(ctx, cancel)
+	resp, err := c.listen(streamCtx, token, "")
+	stop()
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	c.mutex.Lock()
+	if len(c.subs) == 0 {
+		c.mutex.Unlock()
+		cancel()
+		_ = resp.Body.Close()
+		return nil, ErrSubscriptionClosed
+	}
+	c.stream = stream
+	c.mutex.Unlock()
+	go c.readStream(stream, resp)
+	return stream, nil
+}
+
+// relisten reopens the shared event stream, when reservation is gone, reserves again and executes all operations
+func (c *SSEClient) relisten(stream *sseStream, lastEventID *string) (*http.Response, error) {
+	c.mutex.Lock()
+	token := stream.token
+	c.mutex.Unlock()
+	resp, err := c.listen(stream.ctx, token, *lastEventID)
+	detailErr := &DetailError{}
+	if err == nil || !errors.As(err, &detailErr) {
+		return resp, err
+	}
+	if token, err = c.reserve(stream.ctx); err != nil {
+		return nil, err
+	}
+	if resp, err = c.listen(stream.ctx, token, ""); err != nil {
+		return nil, err
+	}
+	*lastEventID = ""
+	c.mutex.Lock()
+	stream.token = token
+	ids := make([]string, 0, len(c.subs))
+	subs := make(map[string]*httpSubscription, len(c.subs))
+	for id, sub := range c.subs {
+		ids = append(ids, id)
+		subs[id] = sub
+	}
+	c.mutex.Unlock()
+	sort.Slice(ids, func(i, j int) bool {
+		a, _ := strconv.ParseInt(ids[i], 10, 64)
+		b, _ := strconv.ParseInt(ids[j], 10, 64)
+		return a < b
+	})
+	for _, id := range ids {
+		if err := c.operation(stream.ctx, token, id, subs[id].req); err != nil {
+			_ = resp.Body.Close()
+			return nil, err
+		}
+	}
+	return resp, nil
+}
+
+// dropStream drops all subscriptions of the shared event stream
+func (c *SSEClient) dropStream(stream *sseStream, err error) {
+	c.mutex.Lock()
+	if c.stream != stream {
+		c.mutex.Unlock()
+		return
+	}
+	c.stream = nil
+	subs := c.subs
+	c.subs = make(map[string]*httpSubscription)
+	c.mutex.Unlock()
+	stream.cancel()
+	for _, sub := range subs {
+		sub.release(err)
+	}
+}
+
+// connect opens the distinct event stream of req
+func (c *SSEClient) connect(ctx context.Context, req Request, lastEventID string) (*http.Response, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "json encode graphql request")
+	}
+	httpReq, err := c.option.newRequest(ctx, http.MethodPost, c.endpoint(), body, "text/event-stream", req)
+	if err != nil {
+		return nil, err
+	}
+	if lastEventID != "" {
+		httpReq.Header.Set("Last-Event-ID", lastEventID)
+	}
+	return c.option.do(httpReq, http.StatusOK)
+}
+
+// reserve makes a reservation of shared event stream, returns the token
+func (c *SSEClient) reserve(ctx context.Context) (string, error) {
+	httpReq, err := c.option.newRequest(ctx, http.MethodPut, c.endpoint(), nil, "text/plain")
+	if err != nil {
+		return "", err
+	}
+	resp, err := c.option.do(httpReq, http.StatusCreated, http.StatusOK)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	token, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", errors.Wrap(err, "read event stream token")
+	}
+	return strings.TrimSpace(string(token)), nil
+}
+
+// listen opens the shared event stream of token
+func (c *SSEClient) listen(ctx context.Context, token, lastEventID string) (*http.Response, error) {
+	httpReq, err := c.option.newRequest(ctx, http.MethodGet, c.endpoint(), nil, "text/event-stream")
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set(sseTokenHeader, token)
+	if lastEventID != "" {
+		httpReq.Header.Set("Last-Event-ID", lastEventID)
+	}
+	return c.option.do(httpReq, http.StatusOK)
+}
+
+// operation executes req on the shared event stream of token, id is sent as extensions.operationId
+func (c *SSEClient) operation(ctx context.Context, token, id string, req Request) error {
+	extensions, err := withExtension(req.Extensions, "operationId", id)
+	if err != nil {
+		return err
+	}
+	req.Extensions = extensions
+	body, err := json.Marshal(req)
+	if err != nil {
+		return errors.Wrap(err, "json encode graphql request")
+	}
+	httpReq, err := c.option.newRequest(ctx, http.MethodPost, c.endpoint(), body, "application/json; charset=utf-8", req)
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set(sseTokenHeader, token)
+	resp, err := c.option.do(httpReq, http.StatusAccepted, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// stop completes the operation of id on the shared event stream of token
+func (c *SSEClient) stop(token, id string) error {
+	u, err := url.Parse(c.endpoint())
+	if err != nil {
+		return err
+	}
+	query := u.Query()
+	query.Set("operationId", id)
+	u.RawQuery = query.Encode()
+	httpReq, err := c.option.newRequest(context.Background(), http.MethodDelete, u.String(), nil, "application/json; charset=utf-8")
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set(sseTokenHeader, token)
+	resp, err := c.option.do(httpReq, http.StatusOK, http.StatusNoContent)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (c *SSEClient) endpoint() string {
+	if c.Endpoint != "" {
+		return c.Endpoint
+	}
+	return c.option.Endpoint
+}
+
+// cancelOnDone calls cancel if ctx done before stop called
+func cancelOnDone(ctx context.Context, cancel context.CancelFunc) (stop func()) {
+	if ctx.Done() == nil {
+		return func() {}
+	}
+	stopped := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			cancel()
+		case <-stopped:
+		}
+	}()
+	return func() {
+		close(stopped)
+	}
+}
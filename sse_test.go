@@ -0,0 +1,138 @@
+package gqlgo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func recvEvent(t *testing.T, sub *Subscription) SubscriptionEvent {
+	t.Helper()
+	select {
+	case ev := <-sub.Events():
+		return ev
+	case <-time.After(5 * time.Second):
+		t.Fatal("subscription event timeout")
+		return SubscriptionEvent{}
+	}
+}
+
+func TestSSEReader(t *testing.T) {
+	as := assert.New(t)
+	r := newSSEReader(strings.NewReader(": comment\r\n\r\nid: 1\r\nevent: next\r\ndata: {\"a\":\r\ndata:1}\r\n\r\nevent: complete\ndata\n\nevent: incomplete"))
+	ev, err := r.next()
+	require.NoError(t, err)
+	as.Equal(&sseEvent{id: "1", event: "next", data: "{\"a\":\n1}"}, ev)
+	ev, err = r.next()
+	require.NoError(t, err)
+	as.Equal(&sseEvent{event: "complete"}, ev)
+	_, err = r.next()
+	as.Error(err)
+}
+
+func TestSSEClientDistinctConnection(t *testing.T) {
+	as := assert.New(t)
+	lastEventIDs := make(chan string, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		as.Equal(http.MethodPost, r.Method)
+		as.Equal("Bearer token", r.Header.Get("Authorization"))
+		as.Equal("text/event-stream", r.Header.Get("Accept"))
+		lastEventIDs <- r.Header.Get("Last-Event-ID")
+		w.Header().Set("Content-Type", "text/event-stream")
+		if r.Header.Get("Last-Event-ID") == "" {
+			// drop the stream after the first event
+			_, _ = fmt.Fprint(w, "id: 1\nevent: next\ndata: {\"data\":{\"n\":1}}\n\n")
+			return
+		}
+		_, _ = fmt.Fprint(w, ": keepalive\n\nid: 2\nevent: next\ndata: {\"data\":{\"n\":2}}\n\nevent: complete\ndata:\n\n")
+	}))
+	defer server.Close()
+	client := NewClient(server.URL, Option{BearerAuth: "token"})
+	client.SubscriptionTransport = NewSSEClient(client.Option)
+	defer client.SubscriptionTransport.Close()
+
+	sub, err := client.SubscribeChan(Request{Query: "subscription{n}"})
+	require.NoError(t, err)
+	as.JSONEq(`{"n":1}`, string(recvEvent(t, sub).Data))
+	as.JSONEq(`{"n":2}`, string(recvEvent(t, sub).Data))
+	as.True(recvEvent(t, sub).Completed)
+	<-sub.Done()
+	as.Equal(ErrSubscriptionCompleted, sub.Err())
+	as.Equal("", <-lastEventIDs)
+	as.Equal("1", <-lastEventIDs)
+}
+
+func TestSSEClientSingleConnection(t *testing.T) {
+	as := assert.New(t)
+	events := make(chan string, 16)
+	deleted := make(chan string, 16)
+	streamClosed := make(chan struct{}, 1)
+	reservations := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPut:
+			reservations++
+			w.WriteHeader(http.StatusCreated)
+			_, _ = fmt.Fprint(w, "token")
+		case http.MethodGet:
+			as.Equal("token", r.Header.Get(sseTokenHeader))
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.WriteHeader(http.StatusOK)
+			w.(http.Flusher).Flush()
+			for {
+				select {
+				case ev := <-events:
+					_, _ = fmt.Fprint(w, ev)
+					w.(http.Flusher).Flush()
+				case <-r.Context().Done():
+					streamClosed <- struct{}{}
+					return
+				}
+			}
+		case http.MethodPost:
+			as.Equal("token", r.Header.Get(sseTokenHeader))
+			req := struct {
+				Extensions struct {
+					OperationID string `json:"operationId"`
+				} `json:"extensions"`
+			}{}
+			as.NoError(json.NewDecoder(r.Body).Decode(&req))
+			w.WriteHeader(http.StatusAccepted)
+			events <- fmt.Sprintf("event: next\ndata: {\"id\":%q,\"payload\":{\"data\":{\"n\":1}}}\n\n", req.Extensions.OperationID)
+		case http.MethodDelete:
+			deleted <- r.URL.Query().Get("operationId")
+		}
+	}))
+	defer server.Close()
+	client := NewSSEClient(&Option{Endpoint: server.URL}, SSEOption{SingleConnection: true})
+	defer client.Close()
+
+	sub1, err := client.SubscribeChan(Request{Query: "subscription{n}"})
+	require.NoError(t, err)
+	as.JSONEq(`{"n":1}`, string(recvEvent(t, sub1).Data))
+	sub2, err := client.SubscribeChanContext(context.Background(), Request{Query: "subscription{n}", Extensions: map[string]interface{}{"k": "v"}})
+	require.NoError(t, err)
+	as.JSONEq(`{"n":1}`, string(recvEvent(t, sub2).Data))
+	as.Equal(1, reservations)
+
+	as.NoError(sub1.Close())
+	as.Equal(sub1.ID(), <-deleted)
+
+	events <- fmt.Sprintf("event: complete\ndata: {\"id\":%q}\n\n", sub2.ID())
+	as.True(recvEvent(t, sub2).Completed)
+	<-sub2.Done()
+	as.Equal(ErrSubscriptionCompleted, sub2.Err())
+	select {
+	case <-streamClosed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("event stream is not closed after the last subscription")
+	}
+}
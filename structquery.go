@@ -0,0 +1,384 @@
+package gqlgo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+)
+
+// GraphQLTyper declares the GraphQL type of variable for BuildQuery, like "ID!" or "[String!]"
+type GraphQLTyper interface {
+	GraphQLType() string
+}
+
+var (
+	unmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	typerType       = reflect.TypeOf((*GraphQLTyper)(nil)).Elem()
+	fileType        = reflect.TypeOf(File{})
+)
+
+// BuildQuery builds the query of v by struct tags, operation is "query", "mutation" or "subscription".
+// Field is selected by tag like `graphql:"user(id: $id)"` or `graphql:"u: user @include(if: $x)"`, or by the lower camel case of its name without tag.
+// Field tagged like `graphql:"... on User"` and embedded struct are selected in place, `graphql:"-"` is ignored.
+// Pointer field of inline fragment is set only if __typename of the object is its type condition,
+// or if any of its fields is in the response when __typename isn't selected, so fragment on interface should not be pointer.
+// Types of variables are inferred from Go types: string is String!, int is Int!, pointer is nullable, slice is a list,
+// named type like `type ID string` is ID!, File is Upload!, or declared by GraphQLTyper.
+func BuildQuery(operation string, v interface{}, variables map[string]interface{}) (string, error) {
+	t := reflect.TypeOf(v)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return "", errors.Errorf("%s should be a struct, got %T", operation, v)
+	}
+	b := &strings.Builder{}
+	b.WriteString(operation)
+	if len(variables) > 0 {
+		names := make([]string, 0, len(variables))
+		for name := range variables {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		b.WriteString("(")
+		for i, name := range names {
+			typ, err := variableType(variables[name])
+			if err != nil {
+				return "", errors.WithMessagef(err, "variable $%s", name)
+			}
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			b.WriteString("$" + name + ": " + typ)
+		}
+		b.WriteString(")")
+	}
+	if err := writeSelectionSet(b, t, map[reflect.Type]bool{}); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// Query builds query from the struct tags of q by BuildQuery, sends it by Do and decodes data into q
+func (c *Client) Query(ctx context.Context, q interface{}, variables map[string]interface{}) error {
+	return c.doStruct(ctx, "query", q, variables)
+}
+
+// Mutate is like Query but builds mutation
+func (c *Client) Mutate(ctx context.Context, m interface{}, variables map[string]interface{}) error {
+	return c.doStruct(ctx, "mutation", m, variables)
+}
+
+func (c *Client) doStruct(ctx context.Context, operation string, v interface{}, variables map[string]interface{}) error {
+	if rv := reflect.ValueOf(v); rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return errors.Errorf("%s should be a non-nil pointer to struct, got %T", operation, v)
+	}
+	query, err := BuildQuery(operation, v, variables)
+	if err != nil {
+		return err
+	}
+	return c.Do(ctx, &structResult{v: v}, Request{Query: query, Variables: variables})
+}
+
+// structResult decodes data into struct by the response keys of BuildQuery
+type structResult struct {
+	v interface{}
+}
+
+func (r *structResult) UnmarshalJSON(data []byte) error {
+	return decodeValue(data, reflect.ValueOf(r.v).Elem())
+}
+
+// selectionField is a struct field in selection set
+type selectionField struct {
+	index []int
+	// selection is the field in GraphQL syntax, or empty for field selected in place
+	selection string
+	// key is the response key of selection
+	key string
+	// typeCondition is the type of inline fragment like User of `... on User`
+	typeCondition string
+	typ           reflect.Type
+}
+
+// selectionFields returns the fields of struct type t, which are not ignored
+func selectionFields(t reflect.Type) []selectionField {
+	var fields []selectionField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag, hasTag := f.Tag.Lookup("graphql")
+		tag = strings.TrimSpace(tag)
+		switch {
+		case tag == "-":
+			continue
+		case f.PkgPath != "" && !(f.Anonymous && f.Type.Kind() == reflect.Struct):
+			// unexported, but fields of embedded struct are promoted
+			continue
+		case strings.HasPrefix(tag, "..."):
+			fields = append(fields, selectionField{index: f.Index, typ: f.Type, selection: tag, typeCondition: typeCondition(tag)})
+		case f.Anonymous && !hasTag && isSelectionType(selectionElem(f.Type)):
+			fields = append(fields, selectionField{index: f.Index, typ: f.Type})
+		default:
+			if !hasTag {
+				tag = lowerCamelCase(f.Name)
+			}
+			fields = append(fields, selectionField{index: f.Index, typ: f.Type, selection: tag, key: responseKey(tag)})
+		}
+	}
+	return fields
+}
+
+// writeSelectionSet writes the fields of struct type t in braces
+func writeSelectionSet(b *strings.Builder, t reflect.Type, visiting map[reflect.Type]bool) error {
+	if visiting[t] {
+		return errors.Errorf("type %s selects itself recursively", t)
+	}
+	visiting[t] = true
+	defer delete(visiting, t)
+
+	b.WriteString(" {")
+	if err := writeFields(b, t, visiting); err != nil {
+		return err
+	}
+	b.WriteString(" }")
+	return nil
+}
+
+func writeFields(b *strings.Builder, t reflect.Type, visiting map[reflect.Type]bool) error {
+	fields := selectionFields(t)
+	if len(fields) == 0 {
+		return errors.Errorf("type %s has no field to select", t)
+	}
+	for _, f := range fields {
+		elem := selectionElem(f.typ)
+		if f.selection == "" {
+			if err := writeFields(b, elem, visiting); err != nil {
+				return err
+			}
+			continue
+		}
+		b.WriteString(" " + f.selection)
+		if isSelectionType(elem) {
+			if err := writeSelectionSet(b, elem, visiting); err != nil {
+				return err
+			}
+		} else if strings.HasPrefix(f.selection, "...") {
+			return errors.Errorf("inline fragment %q of %s should be a struct", f.selection, t)
+		}
+	}
+	return nil
+}
+
+// selectionElem returns the type in pointers, slices and arrays
+func selectionElem(t reflect.Type) reflect.Type {
+	for {
+		switch t.Kind() {
+		case reflect.Ptr, reflect.Slice, reflect.Array:
+			if isLeafType(t) {
+				return t
+			}
+			t = t.Elem()
+		default:
+			return t
+		}
+	}
+}
+
+// isSelectionType reports whether t is a struct having sub selections, struct implementing json.Unmarshaler like time.Time is scalar
+func isSelectionType(t reflect.Type) bool {
+	return t.Kind() == reflect.Struct && !isLeafType(t)
+}
+
+func isLeafType(t reflect.Type) bool {
+	return t.Implements(unmarshalerType) || reflect.PtrTo(t).Implements(unmarshalerType)
+}
+
+// responseKey returns the alias or the name of field selection like `u: user(id: $id) @include(if: $x)`
+func responseKey(selection string) string {
+	if i := strings.IndexAny(selection, "(@"); i >= 0 {
+		selection = selection[:i]
+	}
+	if i := strings.Index(selection, ":"); i >= 0 {
+		selection = selection[:i]
+	}
+	return strings.TrimSpace(selection)
+}
+
+// typeCondition returns the type condition of inline fragment like `... on User @include(if: $x)`
+func typeCondition(fragment string) string {
+	fragment = strings.TrimSpace(strings.TrimPrefix(fragment, "..."))
+	if !strings.HasPrefix(fragment, "on ") {
+		return ""
+	}
+	fragment = strings.TrimSpace(fragment[len("on "):])
+	if i := strings.IndexAny(fragment, " @{"); i >= 0 {
+		fragment = fragment[:i]
+	}
+	return fragment
+}
+
+// lowerCamelCase converts Go name to GraphQL field name, like ID to id, CommentKarma to commentKarma and URLPath to urlPath
+func lowerCamelCase(name string) string {
+	runes := []rune(name)
+	upper := 0
+	for upper < len(runes) && unicode.IsUpper(runes[upper]) {
+		upper++
+	}
+	if upper > 1 && upper < len(runes) {
+		// the last upper case letter starts the next word
+		upper--
+	}
+	for i := 0; i < upper; i++ {
+		runes[i] = unicode.ToLower(runes[i])
+	}
+	return string(runes)
+}
+
+// variableType infers GraphQL type of variable value
+func variableType(value interface{}) (string, error) {
+	if typer, ok := value.(GraphQLTyper); ok {
+		return typer.GraphQLType(), nil
+	}
+	if value == nil {
+		return "", errors.New("type can't be inferred from nil")
+	}
+	return typeOf(reflect.TypeOf(value))
+}
+
+func typeOf(t reflect.Type) (string, error) {
+	if t.Kind() != reflect.Ptr {
+		if t.Implements(typerType) {
+			return reflect.Zero(t).Interface().(GraphQLTyper).GraphQLType(), nil
+		}
+		// GraphQLType with pointer receiver, like elements of slice
+		if reflect.PtrTo(t).Implements(typerType) {
+			return reflect.New(t).Interface().(GraphQLTyper).GraphQLType(), nil
+		}
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		typ, err := typeOf(t.Elem())
+		return strings.TrimSuffix(typ, "!"), err
+	case reflect.Slice, reflect.Array:
+		typ, err := typeOf(t.Elem())
+		return "[" + typ + "]!", err
+	}
+	switch {
+	case t == fileType:
+		return "Upload!", nil
+	case t.PkgPath() != "":
+		return t.Name() + "!", nil
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return "String!", nil
+	case reflect.Bool:
+		return "Boolean!", nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "Int!", nil
+	case reflect.Float32, reflect.Float64:
+		return "Float!", nil
+	}
+	return "", errors.Errorf("type can't be inferred from %s", t)
+}
+
+// decodeValue decodes data into v, structs having sub selections are decoded by the response keys of their fields
+func decodeValue(data []byte, v reflect.Value) error {
+	if bytes.Equal(bytes.TrimSpace(data), []byte("null")) {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+	t := v.Type()
+	switch {
+	case isLeafType(t):
+	case t.Kind() == reflect.Ptr:
+		if v.IsNil() {
+			v.Set(reflect.New(t.Elem()))
+		}
+		return decodeValue(data, v.Elem())
+	case isSelectionType(t):
+		object := map[string]json.RawMessage{}
+		if err := json.Unmarshal(data, &object); err != nil {
+			return errors.Wrapf(err, "decode %s", t)
+		}
+		return decodeFields(object, v)
+	case (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) && isSelectionType(selectionElem(t)):
+		var items []json.RawMessage
+		if err := json.Unmarshal(data, &items); err != nil {
+			return errors.Wrapf(err, "decode %s", t)
+		}
+		if t.Kind() == reflect.Slice {
+			v.Set(reflect.MakeSlice(t, len(items), len(items)))
+		} else if len(items) > v.Len() {
+			return errors.Errorf("decode %s: too many items %d", t, len(items))
+		}
+		for i, item := range items {
+			if err := decodeValue(item, v.Index(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return errors.Wrapf(json.Unmarshal(data, v.Addr().Interface()), "decode %s", t)
+}
+
+// decodeFields decodes the fields of struct v from object, fields selected in place are decoded from the same object
+func decodeFields(object map[string]json.RawMessage, v reflect.Value) error {
+	for _, f := range selectionFields(v.Type()) {
+		field := v.FieldByIndex(f.index)
+		if f.key == "" {
+			if f.typeCondition != "" && field.Kind() == reflect.Ptr && !fragmentMatches(object, f) {
+				field.Set(reflect.Zero(field.Type()))
+				continue
+			}
+			for field.Kind() == reflect.Ptr {
+				if field.IsNil() {
+					field.Set(reflect.New(field.Type().Elem()))
+				}
+				field = field.Elem()
+			}
+			if err := decodeFields(object, field); err != nil {
+				return err
+			}
+			continue
+		}
+		data, ok := object[f.key]
+		if !ok {
+			continue
+		}
+		if err := decodeValue(data, field); err != nil {
+			return errors.WithMessagef(err, "field %s", f.key)
+		}
+	}
+	return nil
+}
+
+// fragmentMatches reports whether object is of the type condition of inline fragment f
+func fragmentMatches(object map[string]json.RawMessage, f selectionField) bool {
+	if data, ok := object["__typename"]; ok {
+		var typename string
+		return json.Unmarshal(data, &typename) == nil && typename == f.typeCondition
+	}
+	return hasFields(object, selectionElem(f.typ))
+}
+
+// hasFields reports whether any field of struct type t is in object
+func hasFields(object map[string]json.RawMessage, t reflect.Type) bool {
+	for _, f := range selectionFields(t) {
+		if f.key == "" {
+			if hasFields(object, selectionElem(f.typ)) {
+				return true
+			}
+		} else if _, ok := object[f.key]; ok {
+			return true
+		}
+	}
+	return false
+}
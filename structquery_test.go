@@ -0,0 +1,187 @@
+package gqlgo
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testID string
+
+type testRole string
+
+func (testRole) GraphQLType() string { return "Role" }
+
+type testEmail string
+
+func (*testEmail) GraphQLType() string { return "Email!" }
+
+type testNode struct {
+	ID testID
+}
+
+type testUser struct {
+	testNode
+	Name      *string
+	CreatedAt time.Time
+	Friends   []struct {
+		Name string
+	} `graphql:"friends(first: $first)"`
+	Skipped string `graphql:"-"`
+}
+
+type testQuery struct {
+	User  *testUser `graphql:"user(id: $id)"`
+	Admin testUser  `graphql:"admin: user(id: 1) @include(if: $admin)"`
+	Node  struct {
+		Typename string `graphql:"__typename"`
+		OnUser   struct {
+			Name string
+		} `graphql:"... on User"`
+		OnBot *struct {
+			Model string
+		} `graphql:"... on Bot"`
+	} `graphql:"node(id: $id, role: $role)"`
+	Raw json.RawMessage `graphql:"raw"`
+}
+
+const testQueryString = `query($admin: Boolean!, $first: Int, $id: testID!, $role: Role) {` +
+	` user(id: $id) { id name createdAt friends(first: $first) { name } }` +
+	` admin: user(id: 1) @include(if: $admin) { id name createdAt friends(first: $first) { name } }` +
+	` node(id: $id, role: $role) { __typename ... on User { name } ... on Bot { model } } raw }`
+
+func TestBuildQuery(t *testing.T) {
+	first := 2
+	query, err := BuildQuery("query", &testQuery{}, map[string]interface{}{
+		"id":    testID("1"),
+		"first": &first,
+		"admin": true,
+		"role":  testRole("ADMIN"),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, testQueryString, query)
+
+	query, err = BuildQuery("mutation", struct {
+		Upload bool `graphql:"upload(files: $files, tags: $tags)"`
+	}{}, map[string]interface{}{"files": []File{}, "tags": []*string{}})
+	require.NoError(t, err)
+	assert.Equal(t, `mutation($files: [Upload!]!, $tags: [String]!) { upload(files: $files, tags: $tags) }`, query)
+
+	// GraphQLType with pointer receiver
+	query, err = BuildQuery("mutation", struct {
+		Invite bool `graphql:"invite(to: $to, cc: $cc, from: $from)"`
+	}{}, map[string]interface{}{"to": []testEmail{}, "cc": []*testEmail{}, "from": new(testEmail)})
+	require.NoError(t, err)
+	assert.Equal(t, `mutation($cc: [Email]!, $from: Email!, $to: [Email!]!) { invite(to: $to, cc: $cc, from: $from) }`, query)
+
+	_, err = BuildQuery("query", 1, nil)
+	assert.Error(t, err)
+	_, err = BuildQuery("query", &testQuery{}, map[string]interface{}{"id": nil})
+	assert.EqualError(t, err, "variable $id: type can't be inferred from nil")
+	type recursive struct {
+		Best *recursive
+	}
+	_, err = BuildQuery("query", &recursive{}, nil)
+	assert.Error(t, err)
+}
+
+func TestEmbeddedPointer(t *testing.T) {
+	type Node struct {
+		ID testID
+	}
+	type user struct {
+		*Node
+		Name string
+	}
+	query, err := BuildQuery("query", struct {
+		User user `graphql:"user(id: 1)"`
+	}{}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, `query { user(id: 1) { id name } }`, query)
+
+	u := user{}
+	require.NoError(t, decodeValue([]byte(`{"id":"1","name":"a"}`), reflect.ValueOf(&u).Elem()))
+	require.NotNil(t, u.Node)
+	assert.Equal(t, testID("1"), u.ID)
+	assert.Equal(t, "a", u.Name)
+}
+
+func TestDecodeFragment(t *testing.T) {
+	as := assert.New(t)
+	node := struct {
+		OnUser *struct {
+			Name string
+		} `graphql:"... on User"`
+		OnBot *struct {
+			Model string
+		} `graphql:"... on Bot @include(if: $bot)"`
+	}{}
+	v := reflect.ValueOf(&node).Elem()
+	require.NoError(t, decodeValue([]byte(`{"__typename":"Bot","model":"x"}`), v))
+	as.Nil(node.OnUser)
+	as.Equal("x", node.OnBot.Model)
+	require.NoError(t, decodeValue([]byte(`{"name":"a"}`), v))
+	as.Equal("a", node.OnUser.Name)
+	as.Nil(node.OnBot)
+}
+
+func TestLowerCamelCase(t *testing.T) {
+	for name, expected := range map[string]string{
+		"ID":           "id",
+		"CommentKarma": "commentKarma",
+		"URLPath":      "urlPath",
+		"UserID":       "userID",
+		"A":            "a",
+	} {
+		assert.Equal(t, expected, lowerCamelCase(name))
+	}
+}
+
+func TestClientQuery(t *testing.T) {
+	as := assert.New(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := Request{}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		as.Equal(testQueryString, req.Query)
+		as.Equal(map[string]interface{}{"id": "1", "first": float64(2), "admin": true, "role": "ADMIN"}, req.Variables)
+		_, _ = w.Write([]byte(`{"data":{
+			"user":{"id":"1","name":"a","createdAt":"2020-01-02T03:04:05Z","friends":[{"name":"b"},{"name":"c"}]},
+			"admin":{"id":"2","name":null,"createdAt":"2020-01-02T03:04:05Z","friends":null},
+			"node":{"__typename":"User","name":"a"},
+			"raw":{"x":[1]}
+		}}`))
+	}))
+	defer server.Close()
+	client := NewClient(server.URL)
+
+	q := &testQuery{}
+	first := 2
+	require.NoError(t, client.Query(context.Background(), q, map[string]interface{}{
+		"id":    testID("1"),
+		"first": &first,
+		"admin": true,
+		"role":  testRole("ADMIN"),
+	}))
+	require.NotNil(t, q.User)
+	as.Equal(testID("1"), q.User.ID)
+	as.Equal("a", *q.User.Name)
+	as.Equal(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC), q.User.CreatedAt)
+	as.Len(q.User.Friends, 2)
+	as.Equal("c", q.User.Friends[1].Name)
+	as.Equal(testID("2"), q.Admin.ID)
+	as.Nil(q.Admin.Name)
+	as.Nil(q.Admin.Friends)
+	as.Equal("User", q.Node.Typename)
+	as.Equal("a", q.Node.OnUser.Name)
+	as.Nil(q.Node.OnBot)
+	as.JSONEq(`{"x":[1]}`, string(q.Raw))
+
+	as.Error(client.Query(context.Background(), testQuery{}, nil))
+}
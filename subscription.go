@@ -0,0 +1,227 @@
+package gqlgo
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+)
+
+// SubscriptionEvent is a message of Subscription.
+// Completed is true only in the last event when server completed the subscription.
+type SubscriptionEvent struct {
+	Data      json.RawMessage
+	Errors    GraphQLErrors
+	Completed bool
+}
+
+// subscriptionBufferSize is the maximum events of a Subscription waiting to be received
+const subscriptionBufferSize = 64
+
+// Subscription delivers messages by channel instead of SubscriptionHandler.
+// Events is never closed, receive it with Done in select, Done is closed after the last event received.
+// Events are queued by Subscription, so a slow receiver doesn't block the transport and other subscriptions,
+// but when subscriptionBufferSize events are waiting, the subscription is unsubscribed
+// and ended with ErrSubscriptionOverflow, dropping the waiting events.
+type Subscription struct {
+	id          string
+	events      chan SubscriptionEvent
+	queue       chan subscriptionItem
+	done        chan struct{}
+	mutex       sync.Mutex
+	err         error
+	unsubscribe func(id string) error
+}
+
+// subscriptionItem is an event waiting to be received, or the reason of ending after events before it received
+type subscriptionItem struct {
+	event *SubscriptionEvent
+	end   error
+}
+
+func newSubscription(unsubscribe func(id string) error) *Subscription {
+	s := &Subscription{
+		events:      make(chan SubscriptionEvent),
+		queue:       make(chan subscriptionItem, subscriptionBufferSize),
+		done:        make(chan struct{}),
+		unsubscribe: unsubscribe,
+	}
+	go s.deliver()
+	return s
+}
+
+// subscribeFunc subscribes with a callback called once when subscription is dropped by transport,
+// ctx applies only to subscribing, the caller unsubscribes when ctx cancelled after subscribed
+type subscribeFunc func(ctx context.Context, req Request, handler SubscriptionHandler, onRelease func(err error)) (id string, err error)
+
+// subscribeContext unsubscribes when ctx cancelled after subscribed
+func subscribeContext(ctx context.Context, req Request, handler SubscriptionHandler, subscribe subscribeFunc, unsubscribe func(id string) error) (string, error) {
+	released := make(chan struct{})
+	id, err := subscribe(ctx, req, handler, func(err error) {
+		close(released)
+	})
+	if err != nil {
+		return "", err
+	}
+	if ctx.Done() != nil {
+		go func() {
+			select {
+			case <-ctx.Done():
+				_ = unsubscribe(id)
+			case <-released:
+			}
+		}()
+	}
+	return id, nil
+}
+
+// subscribeChan adapts the SubscriptionHandler of transport to Subscription,
+// Subscription.Err returns ctx.Err() when ctx cancelled
+func subscribeChan(ctx context.Context, req Request, subscribe subscribeFunc, unsubscribe func(id string) error) (*Subscription, error) {
+	sub := newSubscription(unsubscribe)
+	id, err := subscribe(ctx, req, sub.handle, func(err error) {
+		if !sub.enqueue(subscriptionItem{end: err}) {
+			sub.finish(err)
+		}
+	})
+	if err != nil {
+		// transport may fail without onRelease, deliver goroutine exits by done
+		sub.finish(err)
+		return nil, err
+	}
+	sub.id = id
+	if ctx.Done() != nil {
+		go func() {
+			select {
+			case <-ctx.Done():
+				if sub.finish(ctx.Err()) {
+					_ = unsubscribe(id)
+				}
+			case <-sub.done:
+			}
+		}()
+	}
+	return sub, nil
+}
+
+// httpSubscription is a subscription of transports over HTTP
+type httpSubscription struct {
+	req     Request
+	handler SubscriptionHandler
+	// ctx is cancelled when subscription released, it's the context of the streaming response owned by subscription
+	ctx         context.Context
+	cancel      context.CancelFunc
+	onRelease   func(err error)
+	releaseOnce sync.Once
+}
+
+// release err is nil when unsubscribed, otherwise the reason of dropping subscription
+func (s *httpSubscription) release(err error) {
+	s.releaseOnce.Do(func() {
+		s.cancel()
+		if s.onRelease != nil {
+			if err == nil {
+				err = ErrSubscriptionClosed
+			}
+			s.onRelease(err)
+		}
+	})
+}
+
+func (s *Subscription) ID() string {
+	return s.id
+}
+
+func (s *Subscription) Events() <-chan SubscriptionEvent {
+	return s.events
+}
+
+// Done is closed when subscription ended
+func (s *Subscription) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err returns nil if subscription is active, otherwise the reason of ending,
+// one of ErrSubscriptionCompleted, ErrSubscriptionClosed, GraphQLErrors or transport error.
+func (s *Subscription) Err() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.err
+}
+
+// Close unsubscribes the subscription, it's safe to call Close multiple times
+func (s *Subscription) Close() error {
+	if !s.finish(ErrSubscriptionClosed) {
+		return nil
+	}
+	return s.unsubscribe(s.id)
+}
+
+// finish reports whether the subscription is finished by this call
+func (s *Subscription) finish(err error) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.err != nil {
+		return false
+	}
+	s.err = err
+	close(s.done)
+	return true
+}
+
+// handle queues the event without blocking the transport
+func (s *Subscription) handle(rawMsg json.RawMessage, gqlErrs GraphQLErrors, completed bool) error {
+	item := subscriptionItem{event: &SubscriptionEvent{
+		Data:      rawMsg,
+		Errors:    gqlErrs,
+		Completed: completed,
+	}}
+	switch {
+	case completed:
+		item.end = ErrSubscriptionCompleted
+	case rawMsg == nil && gqlErrs != nil:
+		item.end = gqlErrs
+	}
+	if !s.enqueue(item) {
+		s.finish(ErrSubscriptionOverflow)
+		return s.Err()
+	}
+	return nil
+}
+
+// enqueue reports whether item is queued, it's false if subscription ended or queue is full
+func (s *Subscription) enqueue(item subscriptionItem) bool {
+	select {
+	case <-s.done:
+		return false
+	default:
+	}
+	select {
+	case s.queue <- item:
+		return true
+	default:
+		return false
+	}
+}
+
+// deliver sends queued events to Events, and ends the subscription after the last event received
+func (s *Subscription) deliver() {
+	for {
+		var item subscriptionItem
+		select {
+		case item = <-s.queue:
+		case <-s.done:
+			return
+		}
+		if item.event != nil {
+			select {
+			case s.events <- *item.event:
+			case <-s.done:
+				return
+			}
+		}
+		if item.end != nil {
+			s.finish(item.end)
+			return
+		}
+	}
+}
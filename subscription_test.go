@@ -0,0 +1,68 @@
+package gqlgo
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubscription(t *testing.T) {
+	as := assert.New(t)
+	unsubscribed := 0
+	sub := newSubscription(func(id string) error {
+		unsubscribed++
+		return nil
+	})
+
+	// events are queued, and Done is closed after the last one received
+	as.NoError(sub.handle(json.RawMessage(`{"n":1}`), nil, false))
+	as.NoError(sub.handle(nil, nil, true))
+	as.Equal(SubscriptionEvent{Data: json.RawMessage(`{"n":1}`)}, <-sub.Events())
+	select {
+	case <-sub.Done():
+		as.Fail("subscription ended before the last event received")
+	default:
+	}
+	as.Nil(sub.Err())
+	as.Equal(SubscriptionEvent{Completed: true}, <-sub.Events())
+	<-sub.Done()
+	as.Equal(ErrSubscriptionCompleted, sub.Err())
+	as.Equal(ErrSubscriptionCompleted, sub.handle(json.RawMessage(`{"n":2}`), nil, false))
+	as.NoError(sub.Close())
+	as.Equal(0, unsubscribed)
+
+	// error message ends subscription
+	sub = newSubscription(nil)
+	gqlErrs := GraphQLErrors{{Message: "failed"}}
+	as.NoError(sub.handle(nil, gqlErrs, false))
+	as.Equal(SubscriptionEvent{Errors: gqlErrs}, <-sub.Events())
+	<-sub.Done()
+	as.Equal(gqlErrs, sub.Err())
+
+	// Close unsubscribes once
+	sub = newSubscription(func(id string) error {
+		unsubscribed++
+		return nil
+	})
+	as.NoError(sub.Close())
+	as.NoError(sub.Close())
+	<-sub.Done()
+	as.Equal(ErrSubscriptionClosed, sub.Err())
+	as.Equal(1, unsubscribed)
+}
+
+func TestSubscribeChanError(t *testing.T) {
+	as := assert.New(t)
+	failed := errors.New("closed")
+	var handler SubscriptionHandler
+	_, err := subscribeChan(context.Background(), Request{}, func(ctx context.Context, req Request, h SubscriptionHandler, onRelease func(err error)) (string, error) {
+		handler = h
+		return "", failed
+	}, nil)
+	as.Equal(failed, err)
+	// the subscription is finished, so its deliver goroutine exited
+	as.Equal(failed, handler(json.RawMessage(`{"n":1}`), nil, false))
+}
@@ -0,0 +1,157 @@
+package validator
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/poohvpn/gqlgo/ast"
+	"github.com/poohvpn/gqlgo/introspection"
+)
+
+// collectedField is a field with the type it's selected on, def is nil for unknown field
+type collectedField struct {
+	parent *introspection.Type
+	field  *ast.Field
+	def    *introspection.Field
+}
+
+// fieldsCanMerge reports fields of the same response key in set which can't be merged
+func (c *validation) fieldsCanMerge(set ast.SelectionSet, parent *introspection.Type) {
+	keys, fields := c.collectFields(set, parent, map[string]bool{})
+	for _, key := range keys {
+		list := fields[key]
+		for i := 0; i < len(list); i++ {
+			for j := i + 1; j < len(list); j++ {
+				if reason := c.fieldsConflict(list[i], list[j], false); reason != "" {
+					c.report(fmt.Sprintf("Fields %q conflict because %s. Use different aliases on the fields to fetch both if this was intentional.", key, reason),
+						list[i].field.Loc, list[j].field.Loc)
+				}
+			}
+		}
+	}
+}
+
+// collectFields groups fields in set by response key, fragments are expanded and keys are in order of appearance
+func (c *validation) collectFields(set ast.SelectionSet, parent *introspection.Type, visited map[string]bool) ([]string, map[string][]collectedField) {
+	var keys []string
+	fields := map[string][]collectedField{}
+	var collect func(set ast.SelectionSet, parent *introspection.Type)
+	collect = func(set ast.SelectionSet, parent *introspection.Type) {
+		for _, selection := range set {
+			switch s := selection.(type) {
+			case *ast.Field:
+				key := s.ResponseKey()
+				if _, ok := fields[key]; !ok {
+					keys = append(keys, key)
+				}
+				fields[key] = append(fields[key], collectedField{
+					parent: parent,
+					field:  s,
+					def:    c.fieldDef(parent, s.Name),
+				})
+			case *ast.InlineFragment:
+				t := parent
+				if s.TypeCondition != "" {
+					t = c.types[s.TypeCondition]
+				}
+				if isCompositeType(t) {
+					collect(s.SelectionSet, t)
+				}
+			case *ast.FragmentSpread:
+				fragment := c.doc.Fragment(s.Name)
+				if fragment == nil || visited[s.Name] {
+					continue
+				}
+				visited[s.Name] = true
+				if t := c.types[fragment.TypeCondition]; isCompositeType(t) {
+					collect(fragment.SelectionSet, t)
+				}
+			}
+		}
+	}
+	collect(set, parent)
+	return keys, fields
+}
+
+// fieldsConflict returns the reason why fields a and b of the same response key can't be merged, or empty if they can
+func (c *validation) fieldsConflict(a, b collectedField, mutuallyExclusive bool) string {
+	pair := [2]*ast.Field{a.field, b.field}
+	if a.field == b.field || c.comparedFields[pair] {
+		return ""
+	}
+	if c.comparedFields == nil {
+		c.comparedFields = make(map[[2]*ast.Field]bool)
+	}
+	// fields are compared once, it also stops the recursion of cyclic fragments
+	c.comparedFields[pair] = true
+	mutuallyExclusive = mutuallyExclusive || a.parent != b.parent &&
+		a.parent.Kind == introspection.KindObject && b.parent.Kind == introspection.KindObject
+	if !mutuallyExclusive {
+		if a.field.Name != b.field.Name {
+			return fmt.Sprintf("%q and %q are different fields", a.field.Name, b.field.Name)
+		}
+		if !sameArguments(a.field.Arguments, b.field.Arguments) {
+			return "they have differing arguments"
+		}
+	}
+	if a.def == nil || b.def == nil {
+		return ""
+	}
+	if c.typesConflict(&a.def.Type, &b.def.Type) {
+		return fmt.Sprintf("they return conflicting types \"%s\" and \"%s\"", a.def.Type, b.def.Type)
+	}
+	aType, bType := c.types[a.def.Type.NamedType()], c.types[b.def.Type.NamedType()]
+	if len(a.field.SelectionSet) == 0 || len(b.field.SelectionSet) == 0 || !isCompositeType(aType) || !isCompositeType(bType) {
+		return ""
+	}
+	aKeys, aFields := c.collectFields(a.field.SelectionSet, aType, map[string]bool{})
+	_, bFields := c.collectFields(b.field.SelectionSet, bType, map[string]bool{})
+	var reasons []string
+	for _, key := range aKeys {
+		for _, subA := range aFields[key] {
+			for _, subB := range bFields[key] {
+				if reason := c.fieldsConflict(subA, subB, mutuallyExclusive); reason != "" {
+					reasons = append(reasons, fmt.Sprintf("subfields %q conflict because %s", key, reason))
+					break
+				}
+			}
+		}
+	}
+	return strings.Join(reasons, " and ")
+}
+
+// typesConflict reports whether values of a and b have different shapes
+func (c *validation) typesConflict(a, b *introspection.TypeRef) bool {
+	switch {
+	case a.Kind == introspection.KindList || b.Kind == introspection.KindList:
+		return a.Kind != b.Kind || c.typesConflict(a.OfType, b.OfType)
+	case a.Kind == introspection.KindNonNull || b.Kind == introspection.KindNonNull:
+		return a.Kind != b.Kind || c.typesConflict(a.OfType, b.OfType)
+	}
+	if isLeafType(c.types[a.Name]) || isLeafType(c.types[b.Name]) {
+		return a.Name != b.Name
+	}
+	return false
+}
+
+func sameArguments(a, b []*ast.Argument) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for _, argA := range a {
+		argB := findArgument(b, argA.Name)
+		if argB == nil || argA.Value.String() != argB.Value.String() {
+			return false
+		}
+	}
+	return true
+}
+
+func findArgument(args []*ast.Argument, name string) *ast.Argument {
+	for _, arg := range args {
+		if arg.Name == name {
+			return arg
+		}
+	}
+	return nil
+}
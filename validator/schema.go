@@ -0,0 +1,397 @@
+package validator
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+	"github.com/poohvpn/gqlgo/ast"
+	"github.com/poohvpn/gqlgo/introspection"
+)
+
+// builtinSDL defines the types and directives every schema has, they are added by LoadSDL if not defined
+const builtinSDL = `
+scalar String
+scalar Int
+scalar Float
+scalar Boolean
+scalar ID
+
+directive @include(if: Boolean!) on FIELD | FRAGMENT_SPREAD | INLINE_FRAGMENT
+directive @skip(if: Boolean!) on FIELD | FRAGMENT_SPREAD | INLINE_FRAGMENT
+directive @deprecated(reason: String = "No longer supported") on FIELD_DEFINITION | ARGUMENT_DEFINITION | INPUT_FIELD_DEFINITION | ENUM_VALUE
+directive @specifiedBy(url: String!) on SCALAR
+
+type __Schema {
+  description: String
+  types: [__Type!]!
+  queryType: __Type!
+  mutationType: __Type
+  subscriptionType: __Type
+  directives: [__Directive!]!
+}
+
+type __Type {
+  kind: __TypeKind!
+  name: String
+  description: String
+  specifiedByURL: String
+  fields(includeDeprecated: Boolean = false): [__Field!]
+  interfaces: [__Type!]
+  possibleTypes: [__Type!]
+  enumValues(includeDeprecated: Boolean = false): [__EnumValue!]
+  inputFields(includeDeprecated: Boolean = false): [__InputValue!]
+  ofType: __Type
+}
+
+enum __TypeKind {
+  SCALAR
+  OBJECT
+  INTERFACE
+  UNION
+  ENUM
+  INPUT_OBJECT
+  LIST
+  NON_NULL
+}
+
+type __Field {
+  name: String!
+  description: String
+  args(includeDeprecated: Boolean = false): [__InputValue!]!
+  type: __Type!
+  isDeprecated: Boolean!
+  deprecationReason: String
+}
+
+type __InputValue {
+  name: String!
+  description: String
+  type: __Type!
+  defaultValue: String
+  isDeprecated: Boolean!
+  deprecationReason: String
+}
+
+type __EnumValue {
+  name: String!
+  description: String
+  isDeprecated: Boolean!
+  deprecationReason: String
+}
+
+type __Directive {
+  name: String!
+  description: String
+  locations: [__DirectiveLocation!]!
+  args(includeDeprecated: Boolean = false): [__InputValue!]!
+  isRepeatable: Boolean!
+}
+
+enum __DirectiveLocation {
+  QUERY
+  MUTATION
+  SUBSCRIPTION
+  FIELD
+  FRAGMENT_DEFINITION
+  FRAGMENT_SPREAD
+  INLINE_FRAGMENT
+  VARIABLE_DEFINITION
+  SCHEMA
+  SCALAR
+  OBJECT
+  FIELD_DEFINITION
+  ARGUMENT_DEFINITION
+  INTERFACE
+  UNION
+  ENUM
+  ENUM_VALUE
+  INPUT_OBJECT
+  INPUT_FIELD_DEFINITION
+}
+`
+
+// LoadIntrospection decodes the result of introspection.Query or introspection.FullQuery, data can be the whole response, its data or the __schema
+func LoadIntrospection(data []byte) (*introspection.Schema, error) {
+	var res struct {
+		Data      *introspection.Response `json:"data"`
+		Schema    *introspection.Schema   `json:"__schema"`
+		QueryType *introspection.TypeName `json:"queryType"`
+	}
+	if err := json.Unmarshal(data, &res); err != nil {
+		return nil, errors.Wrap(err, "json decode introspection")
+	}
+	switch {
+	case res.Data != nil:
+		return &res.Data.Schema, nil
+	case res.Schema != nil:
+		return res.Schema, nil
+	case res.QueryType != nil:
+		schema := &introspection.Schema{}
+		if err := json.Unmarshal(data, schema); err != nil {
+			return nil, errors.Wrap(err, "json decode introspection")
+		}
+		return schema, nil
+	}
+	return nil, errors.New("introspection has no __schema")
+}
+
+// LoadSDL builds the schema from schema definition language, built-in scalars, directives and introspection types are added
+func LoadSDL(sdl string) (*introspection.Schema, error) {
+	doc, err := ast.Parse(sdl)
+	if err != nil {
+		return nil, err
+	}
+	if len(doc.Operations) > 0 || len(doc.Fragments) > 0 {
+		return nil, errors.New("schema definition language should not have operations or fragments")
+	}
+	builtin, err := ast.Parse(builtinSDL)
+	if err != nil {
+		return nil, err
+	}
+	b := &schemaBuilder{
+		schema:     &introspection.Schema{},
+		types:      make(map[string]*introspection.Type),
+		directives: make(map[string]bool),
+		defined:    make(map[string]bool),
+	}
+	defs := append(append([]*ast.TypeDefinition{}, doc.Types...), builtin.Types...)
+	for _, def := range defs {
+		if def.Extend {
+			continue
+		}
+		if _, ok := b.types[def.Name]; ok {
+			if isBuiltinDefinition(builtin, def) {
+				continue
+			}
+			return nil, errors.Errorf("type %q is defined more than once", def.Name)
+		}
+		b.schema.Types = append(b.schema.Types, introspection.Type{
+			Kind: introspection.TypeKind(def.Kind),
+			Name: def.Name,
+		})
+		b.types[def.Name] = nil
+	}
+	for i := range b.schema.Types {
+		b.types[b.schema.Types[i].Name] = &b.schema.Types[i]
+	}
+	for _, def := range defs {
+		if err := b.addType(def, isBuiltinDefinition(builtin, def)); err != nil {
+			return nil, err
+		}
+	}
+	for _, def := range append(append([]*ast.DirectiveDefinition{}, doc.Directives...), builtin.Directives...) {
+		if err := b.addDirective(def); err != nil {
+			return nil, err
+		}
+	}
+	if err := b.setRoots(doc.Schemas); err != nil {
+		return nil, err
+	}
+	b.setPossibleTypes()
+	return b.schema, nil
+}
+
+func isBuiltinDefinition(builtin *ast.Document, def *ast.TypeDefinition) bool {
+	for _, t := range builtin.Types {
+		if t == def {
+			return true
+		}
+	}
+	return false
+}
+
+type schemaBuilder struct {
+	schema     *introspection.Schema
+	types      map[string]*introspection.Type
+	directives map[string]bool
+	// defined are names of types whose definitions are added
+	defined map[string]bool
+}
+
+func (b *schemaBuilder) typeRef(t *ast.Type) (introspection.TypeRef, error) {
+	ref := introspection.TypeRef{}
+	if t.Elem != nil {
+		elem, err := b.typeRef(t.Elem)
+		if err != nil {
+			return ref, err
+		}
+		ref = introspection.TypeRef{Kind: introspection.KindList, OfType: &elem}
+	} else {
+		named, ok := b.types[t.NamedType]
+		if !ok {
+			return ref, errors.Errorf("unknown type %q at %d:%d", t.NamedType, t.Loc.Line, t.Loc.Column)
+		}
+		ref = introspection.TypeRef{Kind: named.Kind, Name: named.Name}
+	}
+	if t.NonNull {
+		ofType := ref
+		ref = introspection.TypeRef{Kind: introspection.KindNonNull, OfType: &ofType}
+	}
+	return ref, nil
+}
+
+func (b *schemaBuilder) inputValues(defs []*ast.InputValueDefinition) ([]introspection.InputValue, error) {
+	values := make([]introspection.InputValue, len(defs))
+	for i, def := range defs {
+		typ, err := b.typeRef(def.Type)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = introspection.InputValue{
+			Name:        def.Name,
+			Description: def.Description,
+			Type:        typ,
+		}
+		if def.DefaultValue != nil {
+			defaultValue := def.DefaultValue.String()
+			values[i].DefaultValue = &defaultValue
+		}
+		values[i].IsDeprecated, values[i].DeprecationReason = deprecation(def.Directives)
+	}
+	return values, nil
+}
+
+// addType adds fields, values and members of type definition or extension, builtin definition is skipped if user defined it
+func (b *schemaBuilder) addType(def *ast.TypeDefinition, builtin bool) error {
+	t, ok := b.types[def.Name]
+	if !ok {
+		return errors.Errorf("cannot extend unknown type %q at %d:%d", def.Name, def.Loc.Line, def.Loc.Column)
+	}
+	if string(t.Kind) != string(def.Kind) {
+		return errors.Errorf("type %q is %s, but extended as %s at %d:%d", def.Name, t.Kind, def.Kind, def.Loc.Line, def.Loc.Column)
+	}
+	if !def.Extend {
+		if builtin && b.defined[def.Name] {
+			return nil
+		}
+		b.defined[def.Name] = true
+		t.Description = def.Description
+	}
+	for _, name := range def.Interfaces {
+		iface, ok := b.types[name]
+		if !ok || iface.Kind != introspection.KindInterface {
+			return errors.Errorf("type %q implements unknown interface %q", def.Name, name)
+		}
+		t.Interfaces = append(t.Interfaces, introspection.TypeRef{Kind: introspection.KindInterface, Name: name})
+	}
+	for _, fieldDef := range def.Fields {
+		args, err := b.inputValues(fieldDef.Arguments)
+		if err != nil {
+			return err
+		}
+		typ, err := b.typeRef(fieldDef.Type)
+		if err != nil {
+			return err
+		}
+		field := introspection.Field{
+			Name:        fieldDef.Name,
+			Description: fieldDef.Description,
+			Args:        args,
+			Type:        typ,
+		}
+		field.IsDeprecated, field.DeprecationReason = deprecation(fieldDef.Directives)
+		t.Fields = append(t.Fields, field)
+	}
+	for _, name := range def.Types {
+		member, ok := b.types[name]
+		if !ok || member.Kind != introspection.KindObject {
+			return errors.Errorf("union %q has unknown object type %q", def.Name, name)
+		}
+		t.PossibleTypes = append(t.PossibleTypes, introspection.TypeRef{Kind: introspection.KindObject, Name: name})
+	}
+	for _, valueDef := range def.EnumValues {
+		value := introspection.EnumValue{
+			Name:        valueDef.Name,
+			Description: valueDef.Description,
+		}
+		value.IsDeprecated, value.DeprecationReason = deprecation(valueDef.Directives)
+		t.EnumValues = append(t.EnumValues, value)
+	}
+	inputFields, err := b.inputValues(def.InputFields)
+	if err != nil {
+		return err
+	}
+	t.InputFields = append(t.InputFields, inputFields...)
+	return nil
+}
+
+func (b *schemaBuilder) addDirective(def *ast.DirectiveDefinition) error {
+	if b.directives[def.Name] {
+		return nil
+	}
+	b.directives[def.Name] = true
+	args, err := b.inputValues(def.Arguments)
+	if err != nil {
+		return err
+	}
+	b.schema.Directives = append(b.schema.Directives, introspection.Directive{
+		Name:         def.Name,
+		Description:  def.Description,
+		Locations:    def.Locations,
+		Args:         args,
+		IsRepeatable: def.Repeatable,
+	})
+	return nil
+}
+
+// setRoots uses schema definition, or types named Query, Mutation and Subscription
+func (b *schemaBuilder) setRoots(schemas []*ast.SchemaDefinition) error {
+	roots := map[ast.OperationType]string{}
+	if len(schemas) == 0 {
+		for operation, name := range map[ast.OperationType]string{
+			ast.Query:        "Query",
+			ast.Mutation:     "Mutation",
+			ast.Subscription: "Subscription",
+		} {
+			if _, ok := b.types[name]; ok {
+				roots[operation] = name
+			}
+		}
+	}
+	for _, schema := range schemas {
+		for _, def := range schema.OperationTypes {
+			if t, ok := b.types[def.Type]; !ok || t.Kind != introspection.KindObject {
+				return errors.Errorf("%s root type %q should be an object type", def.Operation, def.Type)
+			}
+			roots[def.Operation] = def.Type
+		}
+	}
+	if name, ok := roots[ast.Query]; ok {
+		b.schema.QueryType = &introspection.TypeName{Name: name}
+	} else {
+		return errors.New("schema has no query root type")
+	}
+	if name, ok := roots[ast.Mutation]; ok {
+		b.schema.MutationType = &introspection.TypeName{Name: name}
+	}
+	if name, ok := roots[ast.Subscription]; ok {
+		b.schema.SubscriptionType = &introspection.TypeName{Name: name}
+	}
+	return nil
+}
+
+// setPossibleTypes sets objects implementing each interface
+func (b *schemaBuilder) setPossibleTypes() {
+	for _, t := range b.schema.Types {
+		for _, iface := range t.Interfaces {
+			if t.Kind != introspection.KindObject {
+				continue
+			}
+			i := b.types[iface.Name]
+			i.PossibleTypes = append(i.PossibleTypes, introspection.TypeRef{Kind: introspection.KindObject, Name: t.Name})
+		}
+	}
+}
+
+func deprecation(directives []*ast.Directive) (bool, string) {
+	for _, directive := range directives {
+		if directive.Name != "deprecated" {
+			continue
+		}
+		if reason := directive.Argument("reason"); reason != nil && reason.Value.Kind != ast.NullValue {
+			return true, reason.Value.Raw
+		}
+		return true, "No longer supported"
+	}
+	return false, ""
+}
@@ -0,0 +1,220 @@
+package validator
+
+import (
+	"fmt"
+
+	"github.com/poohvpn/gqlgo/ast"
+	"github.com/poohvpn/gqlgo/introspection"
+)
+
+var (
+	stringType = introspection.TypeRef{Kind: introspection.KindScalar, Name: "String"}
+
+	typenameField = &introspection.Field{
+		Name: "__typename",
+		Type: introspection.TypeRef{Kind: introspection.KindNonNull, OfType: &stringType},
+	}
+	schemaField = &introspection.Field{
+		Name: "__schema",
+		Type: introspection.TypeRef{Kind: introspection.KindNonNull, OfType: &introspection.TypeRef{Kind: introspection.KindObject, Name: "__Schema"}},
+	}
+	typeField = &introspection.Field{
+		Name: "__type",
+		Args: []introspection.InputValue{{
+			Name: "name",
+			Type: introspection.TypeRef{Kind: introspection.KindNonNull, OfType: &stringType},
+		}},
+		Type: introspection.TypeRef{Kind: introspection.KindObject, Name: "__Type"},
+	}
+)
+
+// fieldDef returns the field of parent including meta fields, or nil if not found
+func (c *validation) fieldDef(parent *introspection.Type, name string) *introspection.Field {
+	switch name {
+	case typenameField.Name:
+		return typenameField
+	case schemaField.Name, typeField.Name:
+		if c.schema.QueryType != nil && parent.Name == c.schema.QueryType.Name && c.types["__Schema"] != nil {
+			if name == schemaField.Name {
+				return schemaField
+			}
+			return typeField
+		}
+	}
+	return parent.Field(name)
+}
+
+func (c *validation) selectionSet(set ast.SelectionSet, parent *introspection.Type) {
+	for _, selection := range set {
+		switch s := selection.(type) {
+		case *ast.Field:
+			c.field(s, parent)
+		case *ast.FragmentSpread:
+			c.validateDirectives(s.Directives, "FRAGMENT_SPREAD")
+			c.scope.spreads = append(c.scope.spreads, s)
+			fragment := c.doc.Fragment(s.Name)
+			if fragment == nil {
+				c.report(fmt.Sprintf("Unknown fragment %q.", s.Name), s.Loc)
+				continue
+			}
+			if t := c.types[fragment.TypeCondition]; isCompositeType(t) && !c.overlap(parent, t) {
+				c.report(fmt.Sprintf("Fragment %q cannot be spread here as objects of type %q can never be of type %q.", s.Name, parent.Name, t.Name), s.Loc)
+			}
+		case *ast.InlineFragment:
+			c.validateDirectives(s.Directives, "INLINE_FRAGMENT")
+			t := parent
+			if s.TypeCondition != "" {
+				t = c.types[s.TypeCondition]
+				switch {
+				case t == nil:
+					c.report(fmt.Sprintf("Unknown type %q.", s.TypeCondition), s.Loc)
+					continue
+				case !isCompositeType(t):
+					c.report(fmt.Sprintf("Fragment cannot condition on non composite type %q.", s.TypeCondition), s.Loc)
+					continue
+				case !c.overlap(parent, t):
+					c.report(fmt.Sprintf("Fragment cannot be spread here as objects of type %q can never be of type %q.", parent.Name, t.Name), s.Loc)
+				}
+			}
+			c.selectionSet(s.SelectionSet, t)
+		}
+	}
+	c.fieldsCanMerge(set, parent)
+}
+
+func (c *validation) field(field *ast.Field, parent *introspection.Type) {
+	c.validateDirectives(field.Directives, "FIELD")
+	def := c.fieldDef(parent, field.Name)
+	if def == nil {
+		c.report(fmt.Sprintf("Cannot query field %q on type %q.", field.Name, parent.Name), field.Loc)
+		c.unknownArguments(field.Arguments)
+		return
+	}
+	c.arguments(field.Arguments, def.Args, fmt.Sprintf("field \"%s.%s\"", parent.Name, field.Name), func(arg *introspection.InputValue) string {
+		return fmt.Sprintf("Field %q argument %q of type \"%s\" is required, but it was not provided.", field.Name, arg.Name, arg.Type)
+	}, field.Loc)
+	t := c.types[def.Type.NamedType()]
+	switch {
+	case t == nil:
+	case isLeafType(t):
+		if len(field.SelectionSet) > 0 {
+			c.report(fmt.Sprintf("Field %q must not have a selection since type \"%s\" has no subfields.", field.Name, def.Type), field.SelectionSet[0].Location())
+		}
+	case len(field.SelectionSet) == 0:
+		c.report(fmt.Sprintf("Field %q of type \"%s\" must have a selection of subfields. Did you mean \"%s { ... }\"?", field.Name, def.Type, field.Name), field.Loc)
+	default:
+		c.selectionSet(field.SelectionSet, t)
+	}
+}
+
+// arguments checks names and values of args against defs, owner like `field "Query.user"` is for unknown argument
+func (c *validation) arguments(args []*ast.Argument, defs []introspection.InputValue, owner string, required func(def *introspection.InputValue) string, loc ast.Location) {
+	names := map[string]bool{}
+	for _, arg := range args {
+		if names[arg.Name] {
+			c.report(fmt.Sprintf("There can be only one argument named %q.", arg.Name), arg.Loc)
+		}
+		names[arg.Name] = true
+		def := findInputValue(defs, arg.Name)
+		if def == nil {
+			c.report(fmt.Sprintf("Unknown argument %q on %s.", arg.Name, owner), arg.Loc)
+			c.unknownArguments([]*ast.Argument{arg})
+			continue
+		}
+		c.value(arg.Value, &def.Type, def.DefaultValue != nil)
+	}
+	for i := range defs {
+		def := &defs[i]
+		if !names[def.Name] && def.Type.Kind == introspection.KindNonNull && def.DefaultValue == nil {
+			c.report(required(def), loc)
+		}
+	}
+}
+
+// unknownArguments records variable usages in arguments without definition, so they are not reported as unused
+func (c *validation) unknownArguments(args []*ast.Argument) {
+	var walk func(v *ast.Value)
+	walk = func(v *ast.Value) {
+		switch v.Kind {
+		case ast.Variable:
+			c.scope.usages = append(c.scope.usages, variableUsage{name: v.Raw, loc: v.Loc})
+		case ast.ListValue:
+			for _, item := range v.List {
+				walk(item)
+			}
+		case ast.ObjectValue:
+			for _, field := range v.Fields {
+				walk(field.Value)
+			}
+		}
+	}
+	for _, arg := range args {
+		walk(arg.Value)
+	}
+}
+
+func (c *validation) validateDirectives(directives []*ast.Directive, location string) {
+	names := map[string]bool{}
+	for _, directive := range directives {
+		def := c.directives[directive.Name]
+		if def == nil {
+			c.report(fmt.Sprintf("Unknown directive \"@%s\".", directive.Name), directive.Loc)
+			c.unknownArguments(directive.Arguments)
+			continue
+		}
+		if !hasLocation(def.Locations, location) {
+			c.report(fmt.Sprintf("Directive \"@%s\" may not be used on %s.", directive.Name, location), directive.Loc)
+		}
+		if names[directive.Name] && !def.IsRepeatable {
+			c.report(fmt.Sprintf("The directive \"@%s\" can only be used once at this location.", directive.Name), directive.Loc)
+		}
+		names[directive.Name] = true
+		c.arguments(directive.Arguments, def.Args, fmt.Sprintf("directive \"@%s\"", directive.Name), func(arg *introspection.InputValue) string {
+			return fmt.Sprintf("Directive \"@%s\" argument %q of type \"%s\" is required, but it was not provided.", directive.Name, arg.Name, arg.Type)
+		}, directive.Loc)
+	}
+}
+
+func hasLocation(locations []string, location string) bool {
+	for _, l := range locations {
+		if l == location {
+			return true
+		}
+	}
+	return false
+}
+
+func findInputValue(values []introspection.InputValue, name string) *introspection.InputValue {
+	for i := range values {
+		if values[i].Name == name {
+			return &values[i]
+		}
+	}
+	return nil
+}
+
+// possibleTypes returns the names of objects t can be
+func (c *validation) possibleTypes(t *introspection.Type) map[string]bool {
+	names := map[string]bool{}
+	if t.Kind == introspection.KindObject {
+		names[t.Name] = true
+	}
+	for _, possibleType := range t.PossibleTypes {
+		names[possibleType.Name] = true
+	}
+	return names
+}
+
+// overlap reports whether an object can be of both composite types
+func (c *validation) overlap(a, b *introspection.Type) bool {
+	if a.Name == b.Name {
+		return true
+	}
+	possibleTypes := c.possibleTypes(a)
+	for name := range c.possibleTypes(b) {
+		if possibleTypes[name] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,496 @@
+// Package validator checks requests against a schema by the validation rules of GraphQL specification,
+// http://spec.graphql.org/draft/#sec-Validation
+package validator
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/poohvpn/gqlgo"
+	"github.com/poohvpn/gqlgo/ast"
+	"github.com/poohvpn/gqlgo/introspection"
+)
+
+// Validator implements gqlgo.Validator, it's safe for concurrent use
+type Validator struct {
+	schema     *introspection.Schema
+	types      map[string]*introspection.Type
+	directives map[string]*introspection.Directive
+}
+
+// New creates Validator of schema loaded by LoadIntrospection, LoadSDL or Client.Introspect
+func New(schema *introspection.Schema) *Validator {
+	v := &Validator{
+		schema:     schema,
+		types:      make(map[string]*introspection.Type),
+		directives: make(map[string]*introspection.Directive),
+	}
+	for i := range schema.Types {
+		v.types[schema.Types[i].Name] = &schema.Types[i]
+	}
+	for i := range schema.Directives {
+		v.directives[schema.Directives[i].Name] = &schema.Directives[i]
+	}
+	return v
+}
+
+// Validate checks the document and variables of req, gqlgo.GraphQLErrors is returned for invalid request
+func (v *Validator) Validate(req gqlgo.Request) error {
+	doc, err := req.Document()
+	if err != nil {
+		syntaxErr := &ast.SyntaxError{}
+		if errors.As(err, &syntaxErr) {
+			return gqlgo.GraphQLErrors{newError("Syntax Error: "+syntaxErr.Message, syntaxErr.Loc)}
+		}
+		return err
+	}
+	if errs := v.ValidateDocument(doc); len(errs) > 0 {
+		return errs
+	}
+	errs, err := v.ValidateVariables(doc, req.OperationName, req.Variables)
+	if err != nil {
+		return err
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// ValidateDocument checks doc by the validation rules
+func (v *Validator) ValidateDocument(doc *ast.Document) gqlgo.GraphQLErrors {
+	c := &validation{
+		Validator: v,
+		doc:       doc,
+		fragments: make(map[string]*scope),
+	}
+	c.validate()
+	return c.errors
+}
+
+// ValidateVariables checks variables against the variable definitions of the operation going to be executed
+func (v *Validator) ValidateVariables(doc *ast.Document, operationName string, variables map[string]interface{}) (gqlgo.GraphQLErrors, error) {
+	op := doc.Operation(operationName)
+	if op == nil {
+		if operationName != "" {
+			return gqlgo.GraphQLErrors{{Message: fmt.Sprintf("Unknown operation named %q.", operationName)}}, nil
+		}
+		return gqlgo.GraphQLErrors{{Message: "Must provide operation name if query contains multiple operations."}}, nil
+	}
+	values := map[string]interface{}{}
+	if len(variables) > 0 {
+		// variables are normalized by JSON, so they are checked as the server receives
+		data, err := json.Marshal(variables)
+		if err != nil {
+			return nil, errors.Wrap(err, "json encode variables")
+		}
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		if err = decoder.Decode(&values); err != nil {
+			return nil, errors.Wrap(err, "json decode variables")
+		}
+	}
+	c := &validation{Validator: v}
+	for _, def := range op.VariableDefinitions {
+		typ, ok := c.typeRef(def.Type)
+		if !ok {
+			continue
+		}
+		value, provided := values[def.Variable]
+		switch {
+		case !provided:
+			if def.DefaultValue == nil && typ.Kind == introspection.KindNonNull {
+				c.report(fmt.Sprintf("Variable \"$%s\" of required type \"%s\" was not provided.", def.Variable, typ), def.Loc)
+			}
+		case value == nil && typ.Kind == introspection.KindNonNull:
+			c.report(fmt.Sprintf("Variable \"$%s\" of non-null type \"%s\" must not be null.", def.Variable, typ), def.Loc)
+		default:
+			for _, reason := range c.coerceVariable(value, &typ, def.Variable) {
+				c.report(fmt.Sprintf("Variable \"$%s\" got invalid value %s; %s", def.Variable, jsonString(value), reason), def.Loc)
+			}
+		}
+	}
+	return c.errors, nil
+}
+
+func newError(message string, locs ...ast.Location) gqlgo.GraphQLError {
+	err := gqlgo.GraphQLError{Message: message}
+	for _, loc := range locs {
+		err.Locations = append(err.Locations, gqlgo.GraphQLErrorLocation{Line: loc.Line, Column: loc.Column})
+	}
+	return err
+}
+
+// variableUsage is a variable used in a position expecting typ
+type variableUsage struct {
+	name string
+	typ  *introspection.TypeRef
+	// hasDefault means the argument or input field has default value
+	hasDefault bool
+	loc        ast.Location
+}
+
+// scope keeps variable usages and fragment spreads of an operation or a fragment, excluding the spread fragments
+type scope struct {
+	usages  []variableUsage
+	spreads []*ast.FragmentSpread
+}
+
+// validation is the state of validating a document
+type validation struct {
+	*Validator
+	doc       *ast.Document
+	errors    gqlgo.GraphQLErrors
+	fragments map[string]*scope
+	scope     *scope
+
+	comparedFields map[[2]*ast.Field]bool
+}
+
+func (c *validation) report(message string, locs ...ast.Location) {
+	c.errors = append(c.errors, newError(message, locs...))
+}
+
+func (c *validation) validate() {
+	c.executableDefinitions()
+	c.operations()
+	c.fragmentDefinitions()
+	opScopes := make([]*scope, len(c.doc.Operations))
+	for i, op := range c.doc.Operations {
+		c.scope = &scope{}
+		opScopes[i] = c.scope
+		c.operation(op)
+	}
+	for _, fragment := range c.doc.Fragments {
+		if _, ok := c.fragments[fragment.Name]; ok {
+			continue
+		}
+		c.scope = &scope{}
+		c.fragments[fragment.Name] = c.scope
+		c.fragment(fragment)
+	}
+	used := map[string]bool{}
+	for i, op := range c.doc.Operations {
+		c.variables(op, opScopes[i], used)
+	}
+	for _, fragment := range c.doc.Fragments {
+		if !used[fragment.Name] {
+			c.report(fmt.Sprintf("Fragment %q is never used.", fragment.Name), fragment.Loc)
+		}
+	}
+	c.fragmentCycles()
+}
+
+func (c *validation) executableDefinitions() {
+	for _, schema := range c.doc.Schemas {
+		c.report("The schema definition is not executable.", schema.Loc)
+	}
+	for _, def := range c.doc.Types {
+		c.report(fmt.Sprintf("The %q definition is not executable.", def.Name), def.Loc)
+	}
+	for _, def := range c.doc.Directives {
+		c.report(fmt.Sprintf("The %q definition is not executable.", def.Name), def.Loc)
+	}
+}
+
+// operations checks names of operations and root fields of subscriptions
+func (c *validation) operations() {
+	names := map[string]bool{}
+	for _, op := range c.doc.Operations {
+		switch {
+		case op.Name == "" && len(c.doc.Operations) > 1:
+			c.report("This anonymous operation must be the only defined operation.", op.Loc)
+		case op.Name != "" && names[op.Name]:
+			c.report(fmt.Sprintf("There can be only one operation named %q.", op.Name), op.Loc)
+		}
+		names[op.Name] = true
+		if op.Operation != ast.Subscription {
+			continue
+		}
+		fields := c.collectRootFields(op.SelectionSet, map[string]bool{})
+		name := "Anonymous Subscription"
+		if op.Name != "" {
+			name = fmt.Sprintf("Subscription %q", op.Name)
+		}
+		if len(fields) > 1 {
+			c.report(name+" must select only one top level field.", fields[1].Loc)
+		}
+		for _, field := range fields {
+			if len(field.Name) > 1 && field.Name[:2] == "__" {
+				c.report(name+" must not select an introspection top level field.", field.Loc)
+			}
+		}
+	}
+}
+
+// collectRootFields returns the first field of each response key, fragments are expanded
+func (c *validation) collectRootFields(set ast.SelectionSet, visited map[string]bool) []*ast.Field {
+	var fields []*ast.Field
+	keys := map[string]bool{}
+	var collect func(set ast.SelectionSet)
+	collect = func(set ast.SelectionSet) {
+		for _, selection := range set {
+			switch s := selection.(type) {
+			case *ast.Field:
+				if !keys[s.ResponseKey()] {
+					keys[s.ResponseKey()] = true
+					fields = append(fields, s)
+				}
+			case *ast.InlineFragment:
+				collect(s.SelectionSet)
+			case *ast.FragmentSpread:
+				if fragment := c.doc.Fragment(s.Name); fragment != nil && !visited[s.Name] {
+					visited[s.Name] = true
+					collect(fragment.SelectionSet)
+				}
+			}
+		}
+	}
+	collect(set)
+	return fields
+}
+
+func (c *validation) fragmentDefinitions() {
+	names := map[string]bool{}
+	for _, fragment := range c.doc.Fragments {
+		if names[fragment.Name] {
+			c.report(fmt.Sprintf("There can be only one fragment named %q.", fragment.Name), fragment.Loc)
+		}
+		names[fragment.Name] = true
+	}
+}
+
+func (c *validation) operation(op *ast.OperationDefinition) {
+	var root *introspection.TypeName
+	location := "QUERY"
+	switch op.Operation {
+	case ast.Query:
+		root = c.schema.QueryType
+	case ast.Mutation:
+		root, location = c.schema.MutationType, "MUTATION"
+	case ast.Subscription:
+		root, location = c.schema.SubscriptionType, "SUBSCRIPTION"
+	}
+	names := map[string]bool{}
+	for _, def := range op.VariableDefinitions {
+		if names[def.Variable] {
+			c.report(fmt.Sprintf("There can be only one variable named \"$%s\".", def.Variable), def.Loc)
+		}
+		names[def.Variable] = true
+		c.validateDirectives(def.Directives, "VARIABLE_DEFINITION")
+		typ, ok := c.typeRef(def.Type)
+		if !ok {
+			continue
+		}
+		if named := c.types[typ.NamedType()]; !isInputType(named) {
+			c.report(fmt.Sprintf("Variable \"$%s\" cannot be non-input type %q.", def.Variable, def.Type), def.Type.Loc)
+			continue
+		}
+		if def.DefaultValue != nil {
+			c.value(def.DefaultValue, &typ, false)
+		}
+	}
+	c.validateDirectives(op.Directives, location)
+	if root == nil || c.types[root.Name] == nil {
+		c.report(fmt.Sprintf("Schema is not configured for %ss.", op.Operation), op.Loc)
+		return
+	}
+	c.selectionSet(op.SelectionSet, c.types[root.Name])
+}
+
+func (c *validation) fragment(fragment *ast.FragmentDefinition) {
+	c.validateDirectives(fragment.Directives, "FRAGMENT_DEFINITION")
+	t := c.types[fragment.TypeCondition]
+	switch {
+	case t == nil:
+		c.report(fmt.Sprintf("Unknown type %q.", fragment.TypeCondition), fragment.Loc)
+	case !isCompositeType(t):
+		c.report(fmt.Sprintf("Fragment %q cannot condition on non composite type %q.", fragment.Name, fragment.TypeCondition), fragment.Loc)
+	default:
+		c.selectionSet(fragment.SelectionSet, t)
+	}
+}
+
+// variables checks usages of variables in op and fragments spread by op, used fragments are marked
+func (c *validation) variables(op *ast.OperationDefinition, opScope *scope, used map[string]bool) {
+	usages := append([]variableUsage{}, opScope.usages...)
+	visited := map[string]bool{}
+	spreads := opScope.spreads
+	for len(spreads) > 0 {
+		spread := spreads[0]
+		spreads = spreads[1:]
+		if visited[spread.Name] {
+			continue
+		}
+		visited[spread.Name] = true
+		used[spread.Name] = true
+		if s := c.fragments[spread.Name]; s != nil {
+			usages = append(usages, s.usages...)
+			spreads = append(spreads, s.spreads...)
+		}
+	}
+	defs := map[string]*ast.VariableDefinition{}
+	for _, def := range op.VariableDefinitions {
+		if _, ok := defs[def.Variable]; !ok {
+			defs[def.Variable] = def
+		}
+	}
+	usedVariables := map[string]bool{}
+	for _, usage := range usages {
+		usedVariables[usage.name] = true
+		def, ok := defs[usage.name]
+		if !ok {
+			if op.Name == "" {
+				c.report(fmt.Sprintf("Variable \"$%s\" is not defined.", usage.name), usage.loc, op.Loc)
+			} else {
+				c.report(fmt.Sprintf("Variable \"$%s\" is not defined by operation %q.", usage.name, op.Name), usage.loc, op.Loc)
+			}
+			continue
+		}
+		typ, unknown := c.resolveType(def.Type)
+		if unknown != nil || usage.typ == nil || !isInputType(c.types[typ.NamedType()]) {
+			continue
+		}
+		if !c.allowedVariableUsage(&typ, def.DefaultValue, usage) {
+			c.report(fmt.Sprintf("Variable \"$%s\" of type \"%s\" used in position expecting type \"%s\".", usage.name, typ, usage.typ), def.Loc, usage.loc)
+		}
+	}
+	for _, def := range op.VariableDefinitions {
+		if usedVariables[def.Variable] {
+			continue
+		}
+		if op.Name == "" {
+			c.report(fmt.Sprintf("Variable \"$%s\" is never used.", def.Variable), def.Loc)
+		} else {
+			c.report(fmt.Sprintf("Variable \"$%s\" is never used in operation %q.", def.Variable, op.Name), def.Loc)
+		}
+	}
+}
+
+// allowedVariableUsage allows nullable variable in non-null position if either of them has non-null default value
+func (c *validation) allowedVariableUsage(typ *introspection.TypeRef, defaultValue *ast.Value, usage variableUsage) bool {
+	location := usage.typ
+	if location.Kind == introspection.KindNonNull && typ.Kind != introspection.KindNonNull {
+		hasDefault := defaultValue != nil && defaultValue.Kind != ast.NullValue
+		if !hasDefault && !usage.hasDefault {
+			return false
+		}
+		location = location.OfType
+	}
+	return c.isSubType(typ, location)
+}
+
+// isSubType reports whether value of typ can be used as superType
+func (c *validation) isSubType(typ, superType *introspection.TypeRef) bool {
+	switch {
+	case superType.Kind == introspection.KindNonNull:
+		return typ.Kind == introspection.KindNonNull && c.isSubType(typ.OfType, superType.OfType)
+	case typ.Kind == introspection.KindNonNull:
+		return c.isSubType(typ.OfType, superType)
+	case superType.Kind == introspection.KindList:
+		return typ.Kind == introspection.KindList && c.isSubType(typ.OfType, superType.OfType)
+	case typ.Kind == introspection.KindList:
+		return false
+	}
+	return typ.Name == superType.Name
+}
+
+// fragmentCycles reports fragments spreading themselves
+func (c *validation) fragmentCycles() {
+	done := map[string]bool{}
+	var path []*ast.FragmentSpread
+	inPath := map[string]int{}
+	var visit func(name string)
+	visit = func(name string) {
+		s := c.fragments[name]
+		if s == nil || done[name] {
+			return
+		}
+		done[name] = true
+		inPath[name] = len(path)
+		for _, spread := range s.spreads {
+			if i, ok := inPath[spread.Name]; ok {
+				cycle := append(append([]*ast.FragmentSpread{}, path[i:]...), spread)
+				via := ""
+				locs := make([]ast.Location, len(cycle))
+				for j, node := range cycle {
+					locs[j] = node.Loc
+					if j < len(cycle)-1 {
+						if via == "" {
+							via = " via "
+						} else {
+							via += ", "
+						}
+						via += node.Name
+					}
+				}
+				c.report(fmt.Sprintf("Cannot spread fragment %q within itself%s.", spread.Name, via), locs...)
+				continue
+			}
+			path = append(path, spread)
+			visit(spread.Name)
+			path = path[:len(path)-1]
+		}
+		delete(inPath, name)
+	}
+	for _, fragment := range c.doc.Fragments {
+		visit(fragment.Name)
+	}
+}
+
+// typeRef converts t to TypeRef, unknown type is reported
+func (c *validation) typeRef(t *ast.Type) (introspection.TypeRef, bool) {
+	ref, unknown := c.resolveType(t)
+	if unknown != nil {
+		c.report(fmt.Sprintf("Unknown type %q.", unknown.NamedType), unknown.Loc)
+		return ref, false
+	}
+	return ref, true
+}
+
+// resolveType converts t to TypeRef, or returns the unknown named type
+func (c *validation) resolveType(t *ast.Type) (introspection.TypeRef, *ast.Type) {
+	ref := introspection.TypeRef{}
+	if t.Elem != nil {
+		elem, unknown := c.resolveType(t.Elem)
+		if unknown != nil {
+			return ref, unknown
+		}
+		ref = introspection.TypeRef{Kind: introspection.KindList, OfType: &elem}
+	} else {
+		named := c.types[t.NamedType]
+		if named == nil {
+			return ref, t
+		}
+		ref = introspection.TypeRef{Kind: named.Kind, Name: named.Name}
+	}
+	if t.NonNull {
+		ofType := ref
+		ref = introspection.TypeRef{Kind: introspection.KindNonNull, OfType: &ofType}
+	}
+	return ref, nil
+}
+
+func isInputType(t *introspection.Type) bool {
+	return t != nil && (t.Kind == introspection.KindScalar || t.Kind == introspection.KindEnum || t.Kind == introspection.KindInputObject)
+}
+
+func isCompositeType(t *introspection.Type) bool {
+	return t != nil && (t.Kind == introspection.KindObject || t.Kind == introspection.KindInterface || t.Kind == introspection.KindUnion)
+}
+
+func isLeafType(t *introspection.Type) bool {
+	return t != nil && (t.Kind == introspection.KindScalar || t.Kind == introspection.KindEnum)
+}
+
+func jsonString(v interface{}) string {
+	buf := &bytes.Buffer{}
+	encoder := json.NewEncoder(buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(v); err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(bytes.TrimSuffix(buf.Bytes(), []byte("\n")))
+}
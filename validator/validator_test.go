@@ -0,0 +1,232 @@
+package validator
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/poohvpn/gqlgo"
+	"github.com/poohvpn/gqlgo/introspection"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testSDL = `
+schema { query: Query mutation: Mutation subscription: Subscription }
+
+scalar Upload
+
+interface Node { id: ID! }
+
+type User implements Node {
+  id: ID!
+  name: String
+  age: Int
+  role: Role
+  friends(first: Int = 10, role: Role): [User!]!
+  best: User
+}
+
+type Bot implements Node {
+  id: ID!
+  name: Int
+}
+
+union Actor = User | Bot
+
+enum Role { ADMIN GUEST }
+
+input UserFilter {
+  role: Role!
+  name: String
+  tags: [String!]
+}
+
+type Query {
+  user(id: ID!): User
+  users(filter: UserFilter, limit: Int! = 10): [User]
+  node(id: ID!): Node
+  nodes(ids: [ID!]): [Node]
+  actor: Actor
+}
+
+type Mutation {
+  upload(file: Upload!): Boolean
+}
+
+type Subscription {
+  userAdded: User
+  botAdded: Bot
+}
+
+directive @cached(ttl: Int) on FIELD
+
+directive @tag(name: String) repeatable on FIELD
+`
+
+func testValidator(t *testing.T) *Validator {
+	schema, err := LoadSDL(testSDL)
+	require.NoError(t, err)
+	return New(schema)
+}
+
+func messages(err error) []string {
+	gqlErrs := gqlgo.GraphQLErrors{}
+	if !errors.As(err, &gqlErrs) {
+		return nil
+	}
+	var res []string
+	for _, e := range gqlErrs {
+		res = append(res, e.Message)
+	}
+	return res
+}
+
+func TestValidateValid(t *testing.T) {
+	v := testValidator(t)
+	for _, query := range []string{
+		`{ user(id: 1) { id name friends { id } } }`,
+		`query Q($id: ID = 1, $f: UserFilter) { user(id: $id) { ...U } users(filter: $f) { id } } fragment U on User { name best { ...B } } fragment B on User { id }`,
+		`{ node(id: "1") { id ... on User { name } ... on Bot { bot: name } } }`,
+		`{ actor { __typename ... on User { name age } ... on Bot { age: name } } }`,
+		`{ users(filter: {role: ADMIN, tags: "a"}) { id @cached(ttl: 1) @include(if: true) } }`,
+		`query($limit: Int) { users(limit: $limit) { id } }`,
+		`query($role: Role = GUEST) { users(filter: {role: $role}) { id } }`,
+		`{ __schema { types { name } } __type(name: "User") { fields { name } } }`,
+		`subscription { userAdded { id } }`,
+	} {
+		assert.NoError(t, v.Validate(gqlgo.Request{Query: query}), query)
+	}
+	assert.NoError(t, v.Validate(gqlgo.Request{
+		Query:     `mutation($f: Upload!) { upload(file: $f) }`,
+		Variables: map[string]interface{}{"f": "file"},
+	}))
+}
+
+func TestValidateInvalid(t *testing.T) {
+	v := testValidator(t)
+	for query, expected := range map[string][]string{
+		`{ user(id: 1) { id`:                    {`Syntax Error: Expected Name, found <EOF>`},
+		`{ user(id: 1) { nam } }`:               {`Cannot query field "nam" on type "User".`},
+		`{ actor { id } }`:                      {`Cannot query field "id" on type "Actor".`},
+		`{ user { id } }`:                       {`Field "user" argument "id" of type "ID!" is required, but it was not provided.`},
+		`{ user(id: 1, x: 2) { id } }`:          {`Unknown argument "x" on field "Query.user".`},
+		`{ user(id: 1) }`:                       {`Field "user" of type "User" must have a selection of subfields. Did you mean "user { ... }"?`},
+		`{ user(id: 1) { name { a } } }`:        {`Field "name" must not have a selection since type "String" has no subfields.`},
+		`{ user(id: 1.5) { id } }`:              {`Expected value of type "ID", found 1.5; ID cannot represent a non-string and non-integer value: 1.5`},
+		`{ users(filter: {name: "a"}) { id } }`: {`Field "UserFilter.role" of required type "Role!" was not provided.`},
+		`{ users(filter: {role: OWNER, x: 1}) { id } }`: {
+			`Value "OWNER" does not exist in "Role" enum.`,
+			`Field "x" is not defined by type "UserFilter".`,
+		},
+		`{ users(limit: null) { id } }`: {`Expected value of type "Int!", found null.`},
+		`{ user(id: 1) { id @unknown name @include(if: true) @include(if: false) } }`: {
+			`Unknown directive "@unknown".`,
+			`The directive "@include" can only be used once at this location.`,
+		},
+		`query @cached { user(id: 1) { id } }`:              {`Directive "@cached" may not be used on QUERY.`},
+		`{ user(id: 1) { ...F } }`:                          {`Unknown fragment "F".`},
+		`{ user(id: 1) { id } } fragment F on User { id }`:  {`Fragment "F" is never used.`},
+		`{ user(id: 1) { ...F } } fragment F on Bot { id }`: {`Fragment "F" cannot be spread here as objects of type "User" can never be of type "Bot".`},
+		`{ user(id: 1) { ... on Role { id } } }`:            {`Fragment cannot condition on non composite type "Role".`},
+		`{ user(id: 1) { ...F } } fragment F on User { best { ...G } } fragment G on User { best { ...F } }`: {
+			`Cannot spread fragment "F" within itself via G.`,
+		},
+		`query Q { user(id: 1) { id } } query Q { user(id: 2) { id } }`: {`There can be only one operation named "Q".`},
+		`{ user(id: 1) { id } } query Q { user(id: 2) { id } }`:         {`This anonymous operation must be the only defined operation.`},
+		`subscription S { userAdded { id } botAdded { id } }`:           {`Subscription "S" must select only one top level field.`},
+		`query Q($id: ID!, $id: ID) { user(id: $id) { id } }`:           {`There can be only one variable named "$id".`},
+		`query Q($u: User) { user(id: 1) { id } }`: {
+			`Variable "$u" cannot be non-input type "User".`,
+			`Variable "$u" is never used in operation "Q".`,
+		},
+		`query Q { user(id: $id) { id } }`:             {`Variable "$id" is not defined by operation "Q".`},
+		`query($id: ID) { user(id: $id) { id } }`:      {`Variable "$id" of type "ID" used in position expecting type "ID!".`},
+		`query($id: String!) { user(id: $id) { id } }`: {`Variable "$id" of type "String!" used in position expecting type "ID!".`},
+		`query($x: Unknown) { user(id: 1) { id } }`:    {`Unknown type "Unknown".`, `Variable "$x" is never used.`},
+		`{ user(id: 1) { name: age } user(id: 1) { name } }`: {
+			`Fields "user" conflict because subfields "name" conflict because "age" and "name" are different fields. Use different aliases on the fields to fetch both if this was intentional.`,
+		},
+		`{ user(id: 1) { id } user(id: 2) { id } }`: {
+			`Fields "user" conflict because they have differing arguments. Use different aliases on the fields to fetch both if this was intentional.`,
+		},
+		`{ actor { ... on User { name } ... on Bot { name } } node(id: 1) { ... on User { x: name } ... on Bot { x: name } } }`: {
+			`Fields "name" conflict because they return conflicting types "String" and "Int". Use different aliases on the fields to fetch both if this was intentional.`,
+			`Fields "x" conflict because they return conflicting types "String" and "Int". Use different aliases on the fields to fetch both if this was intentional.`,
+		},
+		`type T { a: Int }`: {`The "T" definition is not executable.`},
+	} {
+		assert.Equal(t, expected, messages(v.Validate(gqlgo.Request{Query: query})), query)
+	}
+}
+
+func TestValidateLocations(t *testing.T) {
+	v := testValidator(t)
+	err := v.Validate(gqlgo.Request{Query: "query Q {\n  user(id: 1) {\n    id\n  }\n  user(id: $id) { id }\n}"})
+	gqlErrs := gqlgo.GraphQLErrors{}
+	require.True(t, errors.As(err, &gqlErrs))
+	require.Len(t, gqlErrs, 2)
+	assert.Equal(t, []gqlgo.GraphQLErrorLocation{{Line: 2, Column: 3}, {Line: 5, Column: 3}}, gqlErrs[0].Locations)
+	assert.Equal(t, []gqlgo.GraphQLErrorLocation{{Line: 5, Column: 12}, {Line: 1, Column: 1}}, gqlErrs[1].Locations)
+}
+
+func TestValidateVariables(t *testing.T) {
+	v := testValidator(t)
+	query := `query Q($id: ID!, $f: UserFilter, $limit: Int = 1, $ids: [ID!]) { user(id: $id) { id } users(filter: $f, limit: $limit) { id } a: users { id friends(first: $limit) { id } } b: nodes(ids: $ids) { id } }`
+	for variables, expected := range map[string][]string{
+		`{"id": 1, "f": {"role": "ADMIN", "tags": ["a"]}, "ids": "1"}`: nil,
+		`{}`:                       {`Variable "$id" of required type "ID!" was not provided.`},
+		`{"id": null, "limit": 1}`: {`Variable "$id" of non-null type "ID!" must not be null.`},
+		`{"id": true, "limit": 1.5}`: {
+			`Variable "$id" got invalid value true; ID cannot represent value: true`,
+			`Variable "$limit" got invalid value 1.5; Int cannot represent non-integer value: 1.5`,
+		},
+		`{"id": "1", "f": {"role": "OWNER", "tags": [null], "x": 1}, "ids": [1, null]}`: {
+			`Variable "$f" got invalid value {"role":"OWNER","tags":[null],"x":1}; Value "OWNER" does not exist in "Role" enum at "f.role".`,
+			`Variable "$f" got invalid value {"role":"OWNER","tags":[null],"x":1}; Expected non-nullable type "String!" not to be null at "f.tags.0".`,
+			`Variable "$f" got invalid value {"role":"OWNER","tags":[null],"x":1}; Field "x" is not defined by type "UserFilter".`,
+			`Variable "$ids" got invalid value [1,null]; Expected non-nullable type "ID!" not to be null at "ids.1".`,
+		},
+		`{"id": "1", "f": {}}`: {`Variable "$f" got invalid value {}; Field "role" of required type "Role!" was not provided.`},
+	} {
+		values := map[string]interface{}{}
+		require.NoError(t, json.Unmarshal([]byte(variables), &values))
+		err := v.Validate(gqlgo.Request{Query: query, Variables: values})
+		if expected == nil {
+			assert.NoError(t, err, variables)
+		} else {
+			assert.Equal(t, expected, messages(err), variables)
+		}
+	}
+
+	err := v.Validate(gqlgo.Request{Query: `query A { user(id: 1) { id } } query B { user(id: 1) { id } }`})
+	assert.Equal(t, []string{`Must provide operation name if query contains multiple operations.`}, messages(err))
+	err = v.Validate(gqlgo.Request{Query: `query A { user(id: 1) { id } }`, OperationName: "C"})
+	assert.Equal(t, []string{`Unknown operation named "C".`}, messages(err))
+}
+
+func TestLoadIntrospection(t *testing.T) {
+	schema, err := LoadSDL(testSDL)
+	require.NoError(t, err)
+	data, err := json.Marshal(map[string]interface{}{"data": map[string]interface{}{"__schema": schema}})
+	require.NoError(t, err)
+
+	loaded, err := LoadIntrospection(data)
+	require.NoError(t, err)
+	assert.Equal(t, schema.SDL(), loaded.SDL())
+	v := New(loaded)
+	assert.NoError(t, v.Validate(gqlgo.Request{Query: `{ user(id: 1) { id } }`}))
+	assert.Equal(t, []string{`Cannot query field "x" on type "Query".`}, messages(v.Validate(gqlgo.Request{Query: `{ x }`})))
+	assert.NoError(t, v.Validate(gqlgo.Request{Query: `{ user(id: 1) @tag(name: "a") @tag(name: "b") { id } }`}))
+	assert.Equal(t, []string{`The directive "@cached" can only be used once at this location.`},
+		messages(v.Validate(gqlgo.Request{Query: `{ user(id: 1) @cached @cached { id } }`})))
+	assert.NoError(t, v.Validate(gqlgo.Request{Query: introspection.Query, OperationName: introspection.OperationName}))
+	assert.NoError(t, v.Validate(gqlgo.Request{Query: introspection.FullQuery, OperationName: introspection.OperationName}))
+
+	_, err = LoadIntrospection([]byte(`{"data":null}`))
+	assert.Error(t, err)
+	_, err = LoadSDL(`type Query { a: Unknown }`)
+	assert.Error(t, err)
+	_, err = LoadSDL(`type A { a: Int }`)
+	assert.Error(t, err)
+}
@@ -0,0 +1,236 @@
+package validator
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/poohvpn/gqlgo/ast"
+	"github.com/poohvpn/gqlgo/introspection"
+)
+
+// value checks literal v against typ, variables are recorded as usages, hasDefault means the position has default value
+func (c *validation) value(v *ast.Value, typ *introspection.TypeRef, hasDefault bool) {
+	if v.Kind == ast.Variable {
+		c.scope.usages = append(c.scope.usages, variableUsage{
+			name:       v.Raw,
+			typ:        typ,
+			hasDefault: hasDefault,
+			loc:        v.Loc,
+		})
+		return
+	}
+	if typ.Kind == introspection.KindNonNull {
+		if v.Kind == ast.NullValue {
+			c.report(fmt.Sprintf("Expected value of type \"%s\", found null.", typ), v.Loc)
+			return
+		}
+		typ = typ.OfType
+	}
+	if v.Kind == ast.NullValue {
+		return
+	}
+	if typ.Kind == introspection.KindList {
+		if v.Kind != ast.ListValue {
+			c.value(v, typ.OfType, false)
+			return
+		}
+		for _, item := range v.List {
+			c.value(item, typ.OfType, false)
+		}
+		return
+	}
+	t := c.types[typ.Name]
+	if t == nil {
+		return
+	}
+	switch t.Kind {
+	case introspection.KindInputObject:
+		if v.Kind != ast.ObjectValue {
+			c.report(fmt.Sprintf("Expected value of type %q, found %s.", t.Name, v), v.Loc)
+			return
+		}
+		names := map[string]bool{}
+		for _, field := range v.Fields {
+			if names[field.Name] {
+				c.report(fmt.Sprintf("There can be only one input field named %q.", field.Name), field.Loc)
+			}
+			names[field.Name] = true
+			def := t.InputField(field.Name)
+			if def == nil {
+				c.report(fmt.Sprintf("Field %q is not defined by type %q.", field.Name, t.Name), field.Loc)
+				c.unknownArguments([]*ast.Argument{{Value: field.Value}})
+				continue
+			}
+			c.value(field.Value, &def.Type, def.DefaultValue != nil)
+		}
+		for _, def := range t.InputFields {
+			if !names[def.Name] && def.Type.Kind == introspection.KindNonNull && def.DefaultValue == nil {
+				c.report(fmt.Sprintf("Field \"%s.%s\" of required type \"%s\" was not provided.", t.Name, def.Name, def.Type), v.Loc)
+			}
+		}
+	case introspection.KindEnum:
+		switch {
+		case v.Kind != ast.EnumValue:
+			c.report(fmt.Sprintf("Enum %q cannot represent non-enum value: %s.", t.Name, v), v.Loc)
+		case !hasEnumValue(t, v.Raw):
+			c.report(fmt.Sprintf("Value %q does not exist in %q enum.", v.Raw, t.Name), v.Loc)
+		}
+	case introspection.KindScalar:
+		if reason := literalScalarError(t.Name, v); reason != "" {
+			c.report(fmt.Sprintf("Expected value of type %q, found %s; %s", t.Name, v, reason), v.Loc)
+		}
+	}
+}
+
+// literalScalarError checks literal of built-in scalars, custom scalars accept any literal
+func literalScalarError(name string, v *ast.Value) string {
+	switch name {
+	case "Int":
+		if v.Kind != ast.IntValue {
+			return fmt.Sprintf("Int cannot represent non-integer value: %s", v)
+		}
+		if _, err := strconv.ParseInt(v.Raw, 10, 32); err != nil {
+			return fmt.Sprintf("Int cannot represent non 32-bit signed integer value: %s", v)
+		}
+	case "Float":
+		if v.Kind != ast.IntValue && v.Kind != ast.FloatValue {
+			return fmt.Sprintf("Float cannot represent non numeric value: %s", v)
+		}
+	case "String":
+		if v.Kind != ast.StringValue && v.Kind != ast.BlockValue {
+			return fmt.Sprintf("String cannot represent a non string value: %s", v)
+		}
+	case "Boolean":
+		if v.Kind != ast.BooleanValue {
+			return fmt.Sprintf("Boolean cannot represent a non boolean value: %s", v)
+		}
+	case "ID":
+		if v.Kind != ast.StringValue && v.Kind != ast.BlockValue && v.Kind != ast.IntValue {
+			return fmt.Sprintf("ID cannot represent a non-string and non-integer value: %s", v)
+		}
+	}
+	return ""
+}
+
+func hasEnumValue(t *introspection.Type, name string) bool {
+	for _, value := range t.EnumValues {
+		if value.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// coerceVariable checks value decoded from JSON against typ, the reasons of invalid value are returned.
+// path starts with the variable name, it's in reasons of nested values.
+func (c *validation) coerceVariable(value interface{}, typ *introspection.TypeRef, path ...string) []string {
+	at := ""
+	if len(path) > 1 {
+		at = fmt.Sprintf(" at %q", strings.Join(path, "."))
+	}
+	if typ.Kind == introspection.KindNonNull {
+		if value == nil {
+			return []string{fmt.Sprintf("Expected non-nullable type \"%s\" not to be null%s.", typ, at)}
+		}
+		typ = typ.OfType
+	}
+	if value == nil {
+		return nil
+	}
+	if typ.Kind == introspection.KindList {
+		list, ok := value.([]interface{})
+		if !ok {
+			return c.coerceVariable(value, typ.OfType, path...)
+		}
+		var reasons []string
+		for i, item := range list {
+			reasons = append(reasons, c.coerceVariable(item, typ.OfType, appendPath(path, strconv.Itoa(i))...)...)
+		}
+		return reasons
+	}
+	t := c.types[typ.Name]
+	if t == nil {
+		return nil
+	}
+	switch t.Kind {
+	case introspection.KindInputObject:
+		fields, ok := value.(map[string]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("Expected type %q to be an object%s.", t.Name, at)}
+		}
+		names := make([]string, 0, len(fields))
+		for name := range fields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		var reasons []string
+		for _, name := range names {
+			def := t.InputField(name)
+			if def == nil {
+				reasons = append(reasons, fmt.Sprintf("Field %q is not defined by type %q%s.", name, t.Name, at))
+				continue
+			}
+			reasons = append(reasons, c.coerceVariable(fields[name], &def.Type, appendPath(path, name)...)...)
+		}
+		for _, def := range t.InputFields {
+			if _, ok := fields[def.Name]; !ok && def.Type.Kind == introspection.KindNonNull && def.DefaultValue == nil {
+				reasons = append(reasons, fmt.Sprintf("Field %q of required type \"%s\" was not provided%s.", def.Name, def.Type, at))
+			}
+		}
+		return reasons
+	case introspection.KindEnum:
+		s, ok := value.(string)
+		if !ok || !hasEnumValue(t, s) {
+			return []string{fmt.Sprintf("Value %s does not exist in %q enum%s.", jsonString(value), t.Name, at)}
+		}
+	case introspection.KindScalar:
+		if reason := variableScalarError(t.Name, value); reason != "" {
+			return []string{reason + at}
+		}
+	}
+	return nil
+}
+
+// variableScalarError checks JSON value of built-in scalars, custom scalars accept any value
+func variableScalarError(name string, value interface{}) string {
+	number, isNumber := value.(json.Number)
+	switch name {
+	case "Int":
+		f, err := number.Float64()
+		if !isNumber || err != nil || f != math.Trunc(f) {
+			return fmt.Sprintf("Int cannot represent non-integer value: %s", jsonString(value))
+		}
+		if f > math.MaxInt32 || f < math.MinInt32 {
+			return fmt.Sprintf("Int cannot represent non 32-bit signed integer value: %s", jsonString(value))
+		}
+	case "Float":
+		if !isNumber {
+			return fmt.Sprintf("Float cannot represent non numeric value: %s", jsonString(value))
+		}
+	case "String":
+		if _, ok := value.(string); !ok {
+			return fmt.Sprintf("String cannot represent a non string value: %s", jsonString(value))
+		}
+	case "Boolean":
+		if _, ok := value.(bool); !ok {
+			return fmt.Sprintf("Boolean cannot represent a non boolean value: %s", jsonString(value))
+		}
+	case "ID":
+		if _, ok := value.(string); ok {
+			return ""
+		}
+		if f, err := number.Float64(); !isNumber || err != nil || f != math.Trunc(f) {
+			return fmt.Sprintf("ID cannot represent value: %s", jsonString(value))
+		}
+	}
+	return ""
+}
+
+// appendPath copies path, so paths of siblings don't share the array
+func appendPath(path []string, key string) []string {
+	return append(append(make([]string, 0, len(path)+1), path...), key)
+}
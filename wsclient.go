@@ -1,11 +1,15 @@
 package gqlgo
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"math"
+	"net"
 	"net/http"
+	"sort"
+	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -16,33 +20,68 @@ import (
 	"github.com/poohvpn/gqlgo/gqlws"
 )
 
+// WSClient owns the websocket connection in a single loop goroutine, which is started by the first subscription.
+// Public methods talk to the loop by commands, handlers are called by the goroutine reading the connection.
 type WSClient struct {
 	*WSOption
 
-	endpoint          string
-	conn              *websocket.Conn
-	id                int64
-	subs              sync.Map
-	status            gqlws.Status
-	unsentRawMsgQueue [][]byte
-	lastKA            time.Time
-	reconnectBackoff  *backoff.Backoff
-	msgWriteMutex     sync.Mutex
+	endpoint string
+	id       int64
+	subs     sync.Map
+	notifier wsNotifier
+
+	// persistedQueries is shared with Client created by NewClient
+	persistedQueries *persistedQueryState
+
+	loopOnce    sync.Once
+	commands    chan wsCommand
+	dialResults chan wsDialResult
+	inputs      chan wsInput
+	loopDone    chan struct{}
+
+	// written by loop only, readers outside of loop take stateMutex
+	stateMutex sync.RWMutex
+	status     gqlws.Status
+	conn       *websocket.Conn
+	protocol   wsProtocol
+
+	// owned by loop
+	acked            bool
+	dialCancel       context.CancelFunc
+	started          map[string]bool
+	waiters          []wsWaiter
+	ackTimer         *time.Timer
+	ackTimeout       <-chan time.Time
+	reconnectTimer   *time.Timer
+	reconnectTimeout <-chan time.Time
+	pingTicker       *time.Ticker
+	pingTick         <-chan time.Time
+	reconnectAttempt uint32
+	reconnectBackoff *backoff.Backoff
+
+	// minKeepAliveTimeout is the KeepAliveTimeout which can be checked, tests make it shorter
+	minKeepAliveTimeout time.Duration
 }
 
 func NewWSClient(endpoint string, opt ...WSOption) *WSClient {
 	client := &WSClient{
-		WSOption: &WSOption{},
+		WSOption:    &WSOption{},
+		commands:    make(chan wsCommand),
+		dialResults: make(chan wsDialResult),
+		inputs:      make(chan wsInput),
+		loopDone:    make(chan struct{}),
 		reconnectBackoff: &backoff.Backoff{
 			Factor: 1.5,
 			Min:    time.Second,
 			Max:    30 * time.Second,
 		},
+		minKeepAliveTimeout: time.Second * 10,
 	}
 	if len(opt) > 0 {
 		client.WSOption = &opt[0]
 	}
 	client.endpoint = endpoint
+	client.persistedQueries = &persistedQueryState{}
 	if client.Dialer == nil {
 		client.Dialer = websocket.DefaultDialer
 	}
@@ -52,33 +91,312 @@ func NewWSClient(endpoint string, opt ...WSOption) *WSClient {
 	if client.KeepAliveTimeout == 0 {
 		client.KeepAliveTimeout = time.Second * 30
 	}
+	if client.AckTimeout == 0 {
+		client.AckTimeout = time.Second * 10
+	}
 	return client
 }
 
+var defaultConnectionParams = struct {
+	Headers map[string]string `json:"headers"`
+}{
+	Headers: map[string]string{
+		"content-type": "application/json",
+	},
+}
+
+type wsCommandType int
+
+const (
+	wsCommandSubscribe wsCommandType = iota
+	wsCommandUnsubscribe
+	wsCommandUnsubscribeAll
+	wsCommandClose
+)
+
+type wsCommand struct {
+	typ   wsCommandType
+	id    string
+	sub   *wsSubscription
+	reply chan error
+}
+
+type wsDialResult struct {
+	conn     *websocket.Conn
+	protocol wsProtocol
+	// initPayload is the payload of connection_init
+	initPayload interface{}
+	err         error
+}
+
+// wsInput is sent by the goroutine reading conn
+type wsInput struct {
+	conn *websocket.Conn
+	err  error
+	ev   wsEvent
+	// ended means ev.id was completed or failed by server
+	ended bool
+	// stop means ev.id is unknown and should be stopped
+	stop bool
+	// persisted means ev.id failed by persisted query errors, and should be started again with query
+	persisted bool
+}
+
+// wsWaiter is a subscriber waiting for connection_ack
+type wsWaiter struct {
+	id    string
+	reply chan error
+}
+
+// wsSubscription is kept until unsubscribed, so it can be started again after reconnecting
+type wsSubscription struct {
+	req         Request
+	handler     SubscriptionHandler
+	done        chan struct{}
+	onRelease   func(err error)
+	releaseOnce sync.Once
+
+	// hashOnly is 1 if the last start message has the hash of persisted query but no query, it's accessed atomically
+	hashOnly int32
+}
+
+// release wakes up the goroutine watching the context of subscription,
+// err is nil when unsubscribed, otherwise the reason of dropping subscription.
+func (s *wsSubscription) release(err error) {
+	s.releaseOnce.Do(func() {
+		close(s.done)
+		if s.onRelease != nil {
+			if err == nil {
+				err = ErrSubscriptionClosed
+			}
+			s.onRelease(err)
+		}
+	})
+}
+
+// wsNotifier calls callbacks in order, without blocking the loop
+type wsNotifier struct {
+	mutex   sync.Mutex
+	queue   []func()
+	running bool
+}
+
+func (n *wsNotifier) notify(f func()) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.queue = append(n.queue, f)
+	if !n.running {
+		n.running = true
+		go n.run()
+	}
+}
+
+func (n *wsNotifier) run() {
+	for {
+		n.mutex.Lock()
+		if len(n.queue) == 0 {
+			n.running = false
+			n.mutex.Unlock()
+			return
+		}
+		f := n.queue[0]
+		n.queue = n.queue[1:]
+		n.mutex.Unlock()
+		f()
+	}
+}
+
 func (c *WSClient) Subscribe(req Request, handler SubscriptionHandler) (id string, err error) {
+	return c.SubscribeContext(context.Background(), req, handler)
+}
+
+// SubscribeContext returns after connection_ack received.
+// ctx applies to waiting for connection_ack, cancelling ctx after subscribed will unsubscribe.
+// Cancelling ctx doesn't fail the connecting shared by other subscribers.
+func (c *WSClient) SubscribeContext(ctx context.Context, req Request, handler SubscriptionHandler) (id string, err error) {
+	return subscribeContext(ctx, req, handler, c.subscribe, c.Unsubscribe)
+}
+
+func (c *WSClient) subscribe(ctx context.Context, req Request, handler SubscriptionHandler, onRelease func(err error)) (id string, err error) {
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	default:
+	}
 	id = fmt.Sprint(atomic.AddInt64(&c.id, 1))
-	err = c.sendMessage(gqlws.MsgTypeStart, id, req)
+	sub := &wsSubscription{
+		req:       req,
+		handler:   handler,
+		done:      make(chan struct{}),
+		onRelease: onRelease,
+	}
+	reply := make(chan error, 1)
+	err = c.command(ctx, wsCommand{
+		typ:   wsCommandSubscribe,
+		id:    id,
+		sub:   sub,
+		reply: reply,
+	})
 	if err != nil {
-		return
+		return "", err
 	}
-	c.subs.Store(id, handler)
-	return
+	select {
+	case err = <-reply:
+		if err != nil {
+			return "", err
+		}
+	case <-ctx.Done():
+		_ = c.Unsubscribe(id)
+		return "", ctx.Err()
+	}
+	return id, nil
+}
+
+func (c *WSClient) SubscribeChan(req Request) (*Subscription, error) {
+	return c.SubscribeChanContext(context.Background(), req)
+}
+
+// SubscribeChanContext is like SubscribeContext, Subscription.Err returns ctx.Err() when ctx cancelled
+func (c *WSClient) SubscribeChanContext(ctx context.Context, req Request) (*Subscription, error) {
+	return subscribeChan(ctx, req, c.subscribe, c.Unsubscribe)
 }
 
 func (c *WSClient) Unsubscribe(id string) error {
-	if _, ok := c.subs.Load(id); ok {
-		c.subs.Delete(id)
-		return c.sendMessage(gqlws.MsgTypeStop, id, nil)
-	}
-	return nil
+	return c.call(wsCommand{typ: wsCommandUnsubscribe, id: id})
 }
 
 func (c *WSClient) UnsubscribeAll() error {
+	return c.call(wsCommand{typ: wsCommandUnsubscribeAll})
+}
+
+// Close unsubscribes all subscriptions and closes connection, WSClient can't be used after closed
+func (c *WSClient) Close() error {
+	return c.call(wsCommand{typ: wsCommandClose})
+}
+
+// Status returns the connection status
+func (c *WSClient) Status() gqlws.Status {
+	c.stateMutex.RLock()
+	defer c.stateMutex.RUnlock()
+	return c.status
+}
+
+// Subprotocol returns the subprotocol negotiated with server, empty before connected
+func (c *WSClient) Subprotocol() string {
+	c.stateMutex.RLock()
+	defer c.stateMutex.RUnlock()
+	if c.protocol == nil {
+		return ""
+	}
+	return c.protocol.subprotocol()
+}
+
+func (c *WSClient) UnderlyingConn() *websocket.Conn {
+	if c == nil {
+		return nil
+	}
+	c.stateMutex.RLock()
+	defer c.stateMutex.RUnlock()
+	return c.conn
+}
+
+// call sends a command and waits for the reply, command is ignored after closed
+func (c *WSClient) call(cmd wsCommand) error {
+	cmd.reply = make(chan error, 1)
+	err := c.command(context.Background(), cmd)
+	if err == errWSClientClosed {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return <-cmd.reply
+}
+
+func (c *WSClient) command(ctx context.Context, cmd wsCommand) error {
+	c.loopOnce.Do(func() {
+		go c.loop()
+	})
+	select {
+	case c.commands <- cmd:
+		return nil
+	case <-c.loopDone:
+		return errWSClientClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *WSClient) loop() {
+	defer close(c.loopDone)
+	for c.status != gqlws.StatusClosed {
+		select {
+		case cmd := <-c.commands:
+			c.handleCommand(cmd)
+		case res := <-c.dialResults:
+			c.handleDialResult(res)
+		case in := <-c.inputs:
+			c.handleInput(in)
+		case <-c.ackTimeout:
+			c.connectionFailed(ErrConnectionAckTimeout)
+		case <-c.reconnectTimeout:
+			c.reconnectTimer = nil
+			c.reconnectTimeout = nil
+			c.dial()
+		case <-c.pingTick:
+			if ping := c.protocol.pingMessage(); ping != nil {
+				_ = c.sendMessage(ping)
+			}
+		}
+	}
+}
+
+func (c *WSClient) handleCommand(cmd wsCommand) {
+	switch cmd.typ {
+	case wsCommandSubscribe:
+		c.subs.Store(cmd.id, cmd.sub)
+		switch c.status {
+		case gqlws.StatusInitial:
+			c.waiters = append(c.waiters, wsWaiter{id: cmd.id, reply: cmd.reply})
+			c.setStatus(gqlws.StatusConnecting)
+			c.dial()
+		case gqlws.StatusOpen:
+			if c.acked {
+				cmd.reply <- c.start(cmd.id, cmd.sub, false)
+				return
+			}
+			c.waiters = append(c.waiters, wsWaiter{id: cmd.id, reply: cmd.reply})
+		default:
+			c.waiters = append(c.waiters, wsWaiter{id: cmd.id, reply: cmd.reply})
+		}
+	case wsCommandUnsubscribe:
+		var err error
+		if c.deleteSub(cmd.id, nil) && c.started[cmd.id] {
+			delete(c.started, cmd.id)
+			err = c.sendMessage(c.protocol.stopMessage(cmd.id))
+		}
+		cmd.reply <- err
+	case wsCommandUnsubscribeAll:
+		cmd.reply <- c.unsubscribeAll(nil)
+	case wsCommandClose:
+		if c.Log != nil {
+			c.Log("closing")
+		}
+		err := c.unsubscribeAll(errWSClientClosed)
+		c.shutdown(errWSClientClosed)
+		cmd.reply <- err
+	}
+}
+
+func (c *WSClient) unsubscribeAll(reason error) error {
 	var errs []error
-	c.subs.Range(func(id, value interface{}) bool {
-		c.subs.Delete(id)
-		if err := c.sendMessage(gqlws.MsgTypeStop, id.(string), nil); err != nil {
-			errs = append(errs, err)
+	c.subs.Range(func(id, _ interface{}) bool {
+		c.deleteSub(id.(string), reason)
+		if c.started[id.(string)] {
+			delete(c.started, id.(string))
+			if err := c.sendMessage(c.protocol.stopMessage(id.(string))); err != nil {
+				errs = append(errs, err)
+			}
 		}
 		return true
 	})
@@ -88,211 +406,504 @@ func (c *WSClient) UnsubscribeAll() error {
 	return nil
 }
 
-func (c *WSClient) connect() error {
-	var (
-		httpResp *http.Response
-		err      error
-	)
+// deleteSub reports whether the subscription existed
+func (c *WSClient) deleteSub(id string, err error) bool {
+	sub, ok := c.subs.Load(id)
+	if !ok {
+		return false
+	}
+	c.subs.Delete(id)
+	sub.(*wsSubscription).release(err)
+	return true
+}
+
+func (c *WSClient) hasSubs() bool {
+	has := false
+	c.subs.Range(func(_, _ interface{}) bool {
+		has = true
+		return false
+	})
+	return has
+}
+
+func (c *WSClient) setStatus(status gqlws.Status) {
+	c.stateMutex.Lock()
+	defer c.stateMutex.Unlock()
+	c.status = status
+}
+
+func (c *WSClient) setConn(conn *websocket.Conn, protocol wsProtocol) {
+	c.stateMutex.Lock()
+	defer c.stateMutex.Unlock()
+	c.conn = conn
+	if protocol != nil {
+		c.protocol = protocol
+	}
+}
+
+// dial runs in background and sends the result to loop.
+// The dialing is shared by subscribers, so it's cancelled only by shutdown but not by ctx of any subscriber.
+func (c *WSClient) dial() {
+	subprotocols, err := c.subprotocols()
+	if err != nil {
+		c.handleDialResult(wsDialResult{err: err})
+		return
+	}
 	httpHeaders := make(http.Header)
 	for k, v := range c.Headers {
 		httpHeaders.Set(k, v)
 	}
-	c.conn, httpResp, err = c.Dialer.Dial(c.endpoint, httpHeaders)
-	if err != nil {
-		var savedBody []byte
-		if httpResp != nil && httpResp.Body != nil {
-			savedBody, _ = ioutil.ReadAll(httpResp.Body)
+	dialer := *c.Dialer
+	dialer.Subprotocols = subprotocols
+	endpoint := c.endpoint
+	connectionParams := c.ConnectionParams
+	ctx, cancel := context.WithCancel(context.Background())
+	c.dialCancel = cancel
+	go func() {
+		res := wsDialResult{}
+		if connectionParams != nil {
+			res.initPayload, res.err = connectionParams(ctx)
+			if res.err != nil {
+				res.err = errors.Wrap(res.err, "websocket connection params")
+				c.sendDialResult(res)
+				return
+			}
+		} else {
+			res.initPayload = defaultConnectionParams
 		}
-		return &DetailError{
-			OriginError: err,
-			Response:    httpResp,
-			Content:     string(savedBody),
+		conn, httpResp, err := dialer.DialContext(ctx, endpoint, httpHeaders)
+		if err != nil {
+			var savedBody []byte
+			if httpResp != nil && httpResp.Body != nil {
+				savedBody, _ = ioutil.ReadAll(httpResp.Body)
+			}
+			res.err = &DetailError{
+				OriginError: err,
+				Response:    httpResp,
+				Content:     string(savedBody),
+			}
+		} else {
+			// server may not reply Sec-WebSocket-Protocol, then use the first offered one
+			selected := conn.Subprotocol()
+			if selected == "" {
+				selected = subprotocols[0]
+			}
+			if protocol, ok := wsProtocols[selected]; ok {
+				res.conn = conn
+				res.protocol = protocol
+			} else {
+				_ = conn.Close()
+				res.err = errors.Errorf("server selected unsupported websocket subprotocol: %s", selected)
+			}
+		}
+		c.sendDialResult(res)
+	}()
+}
+
+func (c *WSClient) sendDialResult(res wsDialResult) {
+	select {
+	case c.dialResults <- res:
+	case <-c.loopDone:
+		if res.conn != nil {
+			_ = res.conn.Close()
 		}
 	}
+}
 
-	c.status = gqlws.StatusOpen
-	j, _ := json.Marshal(&gqlws.Message{
-		Type: gqlws.MsgTypeConnectionInit,
-		Payload: struct {
-			Headers map[string]string `json:"headers"`
-		}{
-			Headers: map[string]string{
-				"content-type": "application/json",
-			},
-		},
+// subprotocols returns the subprotocols offered in handshake, in order of preference
+func (c *WSClient) subprotocols() ([]string, error) {
+	if c.Protocol == "" {
+		return []string{gqlws.ProtocolGraphQLWS, gqlws.ProtocolGraphQLTransportWS}, nil
+	}
+	if _, ok := wsProtocols[c.Protocol]; !ok {
+		return nil, errors.Errorf("unsupported websocket subprotocol: %s", c.Protocol)
+	}
+	return []string{c.Protocol}, nil
+}
+
+func (c *WSClient) handleDialResult(res wsDialResult) {
+	if c.dialCancel != nil {
+		c.dialCancel()
+		c.dialCancel = nil
+	}
+	if res.err != nil {
+		c.connectionFailed(res.err)
+		return
+	}
+	c.setConn(res.conn, res.protocol)
+	c.setStatus(gqlws.StatusOpen)
+	c.acked = false
+	c.started = make(map[string]bool)
+	go c.read(res.conn, res.protocol)
+	if onConnected := c.OnConnected; onConnected != nil {
+		c.notify(onConnected)
+	}
+
+	_ = c.sendMessage(&gqlws.Message{
+		Type:    gqlws.MsgTypeConnectionInit,
+		Payload: res.initPayload,
 	})
-	go c.run()
+	c.ackTimer = time.NewTimer(c.AckTimeout)
+	c.ackTimeout = c.ackTimer.C
+}
 
-	_ = c.sendRawMessage(j)
-	c.flushUnsentMessage()
+func (c *WSClient) handleInput(in wsInput) {
+	if in.conn != c.conn {
+		return
+	}
+	if in.err != nil {
+		if !c.acked {
+			c.connectionFailed(in.err)
+			return
+		}
+		c.disconnect(in.err)
+		c.retry(in.err, true)
+		return
+	}
+	switch {
+	case in.ended:
+		c.deleteSub(in.ev.id, nil)
+		delete(c.started, in.ev.id)
+		return
+	case in.persisted:
+		sub, ok := c.subs.Load(in.ev.id)
+		if !ok || !c.started[in.ev.id] {
+			return
+		}
+		// server doesn't know the hash, or doesn't support persisted queries
+		if _, notSupported := persistedQueryErrors(c.protocol.errors(in.ev.payload)); notSupported {
+			c.persistedQueries.setUnsupported()
+		}
+		_ = c.start(in.ev.id, sub.(*wsSubscription), true)
+		return
+	case in.stop:
+		if c.acked {
+			_ = c.sendMessage(c.protocol.stopMessage(in.ev.id))
+		}
+		return
+	}
+	switch in.ev.typ {
+	case wsEventConnectionAck:
+		if c.acked {
+			return
+		}
+		c.acked = true
+		c.stopAckTimer()
+		c.startPingTicker()
+		c.reconnectAttempt = 0
+		c.reconnectBackoff.Reset()
+		if onAck := c.OnAck; onAck != nil {
+			c.notify(onAck)
+		}
+		errs := c.resubscribe()
+		for _, w := range c.waiters {
+			w.reply <- errs[w.id]
+		}
+		c.waiters = nil
+	case wsEventConnectionError:
+		c.connectionFailed(&ConnectionError{Payload: in.ev.payload})
+	case wsEventPing:
+		if pong := c.protocol.pongMessage(in.ev.payload); pong != nil {
+			_ = c.sendMessage(pong)
+		}
+	}
+}
 
-	return nil
+// connectionFailed handles the failure before connection_ack, subscribers waiting for connection_ack get err
+func (c *WSClient) connectionFailed(err error) {
+	if c.Log != nil {
+		c.Log("connection failed: " + err.Error())
+	}
+	for _, w := range c.waiters {
+		c.deleteSub(w.id, nil)
+		w.reply <- err
+	}
+	c.waiters = nil
+	if onConnectionError := c.OnConnectionError; onConnectionError != nil {
+		c.notify(func() {
+			onConnectionError(err)
+		})
+	}
+	c.disconnect(err)
+	c.retry(err, false)
+}
+
+func (c *WSClient) notify(f func()) {
+	c.notifier.notify(f)
+}
+
+func (c *WSClient) stopAckTimer() {
+	if c.ackTimer != nil {
+		c.ackTimer.Stop()
+		c.ackTimer = nil
+		c.ackTimeout = nil
+	}
+}
+
+// startPingTicker pings server at half of KeepAliveTimeout, if the protocol has ping pong,
+// so the pong keeps the connection alive when there is no data
+func (c *WSClient) startPingTicker() {
+	if c.KeepAliveTimeout <= c.minKeepAliveTimeout || c.protocol.pingMessage() == nil {
+		return
+	}
+	c.pingTicker = time.NewTicker(c.KeepAliveTimeout / 2)
+	c.pingTick = c.pingTicker.C
+}
+
+func (c *WSClient) stopPingTicker() {
+	if c.pingTicker != nil {
+		c.pingTicker.Stop()
+		c.pingTicker = nil
+		c.pingTick = nil
+	}
+}
+
+func (c *WSClient) disconnect(err error) {
+	c.stopAckTimer()
+	c.stopPingTicker()
+	if c.conn != nil {
+		_ = c.conn.Close()
+		c.setConn(nil, nil)
+		if onDisconnected := c.OnDisconnected; onDisconnected != nil {
+			c.notify(func() {
+				onDisconnected(err)
+			})
+		}
+	}
+	c.acked = false
+	c.started = nil
 }
 
-func (c *WSClient) sendMessage(typ, id string, payload interface{}) error {
-	j, err := json.Marshal(&gqlws.Message{
-		Type:    typ,
-		ID:      id,
-		Payload: payload,
+// retry reconnects immediately when an acknowledged connection broken, otherwise after backoff.
+// Without remaining subscriptions, WSClient goes back to initial status and connects at next subscribing.
+func (c *WSClient) retry(err error, healthy bool) {
+	if !c.hasSubs() {
+		c.reconnectAttempt = 0
+		c.reconnectBackoff.Reset()
+		c.setStatus(gqlws.StatusInitial)
+		return
+	}
+	if c.NotReconnect {
+		c.shutdown(err)
+		return
+	}
+	if healthy {
+		c.reconnectAttempt = 0
+		c.reconnectBackoff.Reset()
+	} else if c.reconnectAttempt >= c.ReconnectAttempts {
+		if c.Log != nil {
+			c.Log("give up reconnecting")
+		}
+		if onGiveUp := c.OnGiveUp; onGiveUp != nil {
+			c.notify(onGiveUp)
+		}
+		c.shutdown(err)
+		return
+	}
+	c.reconnectAttempt++
+	if c.Log != nil {
+		c.Log(fmt.Sprintf("reconnecting, attempt %d", c.reconnectAttempt))
+	}
+	if onReconnecting := c.OnReconnecting; onReconnecting != nil {
+		attempt := c.reconnectAttempt
+		c.notify(func() {
+			onReconnecting(attempt)
+		})
+	}
+	c.setStatus(gqlws.StatusReconnecting)
+	if healthy {
+		c.dial()
+		return
+	}
+	c.reconnectTimer = time.NewTimer(c.reconnectBackoff.Duration())
+	c.reconnectTimeout = c.reconnectTimer.C
+}
+
+// shutdown drops all subscriptions, then loop exits
+func (c *WSClient) shutdown(err error) {
+	for _, w := range c.waiters {
+		w.reply <- err
+	}
+	c.waiters = nil
+	c.subs.Range(func(id, _ interface{}) bool {
+		c.deleteSub(id.(string), err)
+		return true
 	})
-	if err != nil {
+	c.disconnect(err)
+	if c.dialCancel != nil {
+		c.dialCancel()
+		c.dialCancel = nil
+	}
+	if c.reconnectTimer != nil {
+		c.reconnectTimer.Stop()
+		c.reconnectTimer = nil
+		c.reconnectTimeout = nil
+	}
+	c.setStatus(gqlws.StatusClosed)
+}
+
+// start sends the start message of sub, with only the hash of persisted query unless withQuery is true.
+// sub is deleted with the error if it can't be started.
+func (c *WSClient) start(id string, sub *wsSubscription, withQuery bool) error {
+	if err := c.sendStart(id, sub, withQuery); err != nil {
+		delete(c.started, id)
+		c.deleteSub(id, err)
 		return err
 	}
-	switch c.status {
-	case gqlws.StatusInitial:
-		c.status = gqlws.StatusConnecting
-		c.unsentRawMsgQueue = append(c.unsentRawMsgQueue, j)
-		err = c.connect()
-		if err != nil {
+	c.started[id] = true
+	return nil
+}
+
+func (c *WSClient) sendStart(id string, sub *wsSubscription, withQuery bool) error {
+	req := sub.req
+	hashOnly := int32(0)
+	if c.PersistedQueries && !c.persistedQueries.isUnsupported() {
+		var err error
+		if req, err = persistedRequest(req, withQuery); err != nil {
 			return err
 		}
-		return nil
-	case gqlws.StatusConnecting, gqlws.StatusReconnecting:
-		c.unsentRawMsgQueue = append(c.unsentRawMsgQueue, j)
-		return nil
-	case gqlws.StatusOpen:
-		return c.sendRawMessage(j)
-	default:
-		return errors.New("a message was not sent because graphql websocket client is already closed")
+		if !withQuery {
+			hashOnly = 1
+		}
 	}
+	atomic.StoreInt32(&sub.hashOnly, hashOnly)
+	return c.sendMessage(c.protocol.startMessage(id, req))
 }
 
-func (c *WSClient) sendRawMessage(b []byte) error {
-	c.msgWriteMutex.Lock()
-	defer c.msgWriteMutex.Unlock()
-	if c.Log != nil {
-		c.Log("send " + string(b))
+// resubscribe sends start messages of all subs in subscribing order, and returns the errors of subs failed to start
+func (c *WSClient) resubscribe() map[string]error {
+	var ids []string
+	c.subs.Range(func(id, _ interface{}) bool {
+		ids = append(ids, id.(string))
+		return true
+	})
+	sort.Slice(ids, func(i, j int) bool {
+		a, _ := strconv.ParseInt(ids[i], 10, 64)
+		b, _ := strconv.ParseInt(ids[j], 10, 64)
+		return a < b
+	})
+	errs := make(map[string]error)
+	for _, id := range ids {
+		if sub, ok := c.subs.Load(id); ok && !c.started[id] {
+			if err := c.start(id, sub.(*wsSubscription), false); err != nil {
+				errs[id] = err
+			}
+		}
 	}
-	w, err := c.conn.NextWriter(websocket.TextMessage)
+	return errs
+}
+
+func (c *WSClient) sendMessage(msg *gqlws.Message) error {
+	j, err := json.Marshal(msg)
 	if err != nil {
 		return err
 	}
-	defer w.Close()
-	_, err = w.Write(b)
-	return err
+	if c.Log != nil {
+		c.Log("send " + string(j))
+	}
+	return c.conn.WriteMessage(websocket.TextMessage, j)
 }
 
-func (c *WSClient) run() {
-	for {
-		if c.KeepAliveTimeout > time.Second*10 &&
-			c.lastKA != (time.Time{}) &&
-			time.Now().After(c.lastKA.Add(c.KeepAliveTimeout)) {
-			c.reconnect()
-			return
+// input sends to loop, reports false if loop exited
+func (c *WSClient) input(in wsInput) bool {
+	select {
+	case c.inputs <- in:
+		return true
+	case <-c.loopDone:
+		return false
+	}
+}
+
+// read reads messages until connection broken. Once the server sends keepalive message or websocket ping,
+// or at connection_ack of protocol which client pings, read deadline is kept at KeepAliveTimeout after
+// the last frame received, so a silent connection is reconnected.
+// Servers of subscriptions-transport-ws never sending ka are not checked, because they may be silent when there is no data.
+func (c *WSClient) read(conn *websocket.Conn, protocol wsProtocol) {
+	checkKA := c.KeepAliveTimeout > c.minKeepAliveTimeout
+	armed := false
+	alive := func(keepAlive bool) {
+		armed = armed || keepAlive
+		if checkKA && armed {
+			_ = conn.SetReadDeadline(time.Now().Add(c.KeepAliveTimeout))
+		}
+	}
+	// ping handler is called by ReadJSON in this goroutine
+	conn.SetPingHandler(func(data string) error {
+		alive(true)
+		err := conn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(time.Second))
+		if err == websocket.ErrCloseSent {
+			return nil
 		}
+		return err
+	})
+	for {
 		msg := gqlws.ResponseMessage{}
-		err := c.conn.ReadJSON(&msg)
+		err := conn.ReadJSON(&msg)
 		if err != nil {
-			c.reconnect()
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				err = ErrKeepAliveTimeout
+			}
+			if c.Log != nil {
+				c.Log("read: " + err.Error())
+			}
+			c.input(wsInput{conn: conn, err: err})
 			return
 		}
 		if c.Log != nil {
 			j, _ := json.Marshal(msg)
 			c.Log("recv " + string(j))
 		}
-		switch msg.Type {
-		case gqlws.MsgTypeConnectionError:
-		case gqlws.MsgTypeConnectionAck:
-		case gqlws.MsgTypeConnectionKeepAlive:
-			c.lastKA = time.Now()
-		case gqlws.MsgTypeComplete:
-			if h, ok := c.subs.Load(msg.ID); ok {
-				if h != nil {
-					_ = h.(SubscriptionHandler)(nil, nil, true)
+		ev := protocol.event(&msg)
+		alive(ev.typ == wsEventKeepAlive || ev.typ == wsEventPing ||
+			ev.typ == wsEventConnectionAck && protocol.pingMessage() != nil)
+		switch ev.typ {
+		case wsEventConnectionAck, wsEventConnectionError:
+			if !c.input(wsInput{conn: conn, ev: ev}) {
+				return
+			}
+		case wsEventPing:
+			if !c.input(wsInput{conn: conn, ev: ev}) {
+				return
+			}
+		case wsEventComplete:
+			if sub, ok := c.subs.Load(ev.id); ok {
+				if h := sub.(*wsSubscription).handler; h != nil {
+					_ = h(nil, nil, true)
 				}
-				c.subs.Delete(msg.ID)
-			} else {
-				_ = c.sendMessage(gqlws.MsgTypeStop, msg.ID, nil)
+				c.input(wsInput{conn: conn, ev: ev, ended: true})
 			}
-		case gqlws.MsgTypeError:
-			if h, ok := c.subs.Load(msg.ID); ok {
-				if h != nil {
-					_ = h.(SubscriptionHandler)(nil, GraphQLErrors{{Message: string(msg.Payload)}}, false)
+		case wsEventError:
+			if sub, ok := c.subs.Load(ev.id); ok {
+				errs := protocol.errors(ev.payload)
+				if atomic.LoadInt32(&sub.(*wsSubscription).hashOnly) == 1 {
+					if notFound, notSupported := persistedQueryErrors(errs); notFound || notSupported {
+						c.input(wsInput{conn: conn, ev: ev, persisted: true})
+						continue
+					}
+				}
+				if h := sub.(*wsSubscription).handler; h != nil {
+					_ = h(nil, errs, false)
 				}
-				c.subs.Delete(msg.ID)
+				c.input(wsInput{conn: conn, ev: ev, ended: true})
 			} else {
-				_ = c.sendMessage(gqlws.MsgTypeStop, msg.ID, nil)
+				c.input(wsInput{conn: conn, ev: ev, stop: true})
 			}
-		case gqlws.MsgTypeData:
-			if h, ok := c.subs.Load(msg.ID); ok {
-				if h != nil {
-					resp := rawResponse{}
-					if err := json.Unmarshal(msg.Payload, &resp); err != nil {
+		case wsEventData:
+			if sub, ok := c.subs.Load(ev.id); ok {
+				if h := sub.(*wsSubscription).handler; h != nil {
+					data, errs, err := executionResult(ev.payload)
+					if err != nil {
 						continue
 					}
-					var errs GraphQLErrors
-					if len(resp.Errors) > 0 {
-						errs = resp.Errors
-					}
-					stopErr := h.(SubscriptionHandler)(resp.Data, errs, false)
+					stopErr := h(data, errs, false)
 					if stopErr != nil {
-						_ = c.Unsubscribe(msg.ID)
+						_ = c.Unsubscribe(ev.id)
 					}
 				}
 			} else {
-				_ = c.sendMessage(gqlws.MsgTypeStop, msg.ID, nil)
-			}
-		}
-	}
-}
-
-func (c *WSClient) Close() error {
-	if c.status != gqlws.StatusClosed && c.conn != nil {
-		if c.Log != nil {
-			c.Log("closing")
-		}
-		var err error
-		err = c.UnsubscribeAll()
-		if err != nil {
-			return err
-		}
-		err = c.conn.Close()
-		if err != nil {
-			return err
-		}
-		c.status = gqlws.StatusClosed
-		c.conn = nil
-		return nil
-	}
-	return nil
-}
-
-func (c *WSClient) reconnect() {
-	_ = c.Close()
-	if c.NotReconnect {
-		return
-	}
-
-	if c.Log != nil {
-		c.Log("reconnecting")
-	}
-	c.id = 0
-	c.status = gqlws.StatusReconnecting
-	c.lastKA = time.Time{}
-	for {
-		err := c.connect()
-		if err != nil {
-			if c.reconnectBackoff.Attempt() > float64(c.ReconnectAttempts) {
-				return
+				c.input(wsInput{conn: conn, ev: ev, stop: true})
 			}
-			time.Sleep(c.reconnectBackoff.Duration())
-			continue
 		}
-		c.reconnectBackoff.Reset()
-		break
-	}
-}
-
-func (c *WSClient) flushUnsentMessage() {
-	for _, rawMsg := range c.unsentRawMsgQueue {
-		_ = c.sendRawMessage(rawMsg)
 	}
-	c.unsentRawMsgQueue = nil
-}
-
-func (c *WSClient) UnderlyingConn() *websocket.Conn {
-	if c == nil {
-		return nil
-	}
-	return c.conn
 }
@@ -0,0 +1,838 @@
+package gqlgo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/pkg/errors"
+	"github.com/poohvpn/gqlgo/gqlws"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testWSServer acks connection_init, and replies {"n":1} for every start or subscribe message
+type testWSServer struct {
+	*httptest.Server
+	subprotocols    []string
+	noAck           bool
+	noPong          bool
+	connectionError interface{}
+	// persistedQueries makes server reply PersistedQueryNotFound to start messages of unknown hashes
+	persistedQueries bool
+	hashesMutex      sync.Mutex
+	hashes           map[string]bool
+	received         chan gqlws.ResponseMessage
+	conns            chan *testWSConn
+}
+
+type testWSConn struct {
+	*websocket.Conn
+	writeMutex sync.Mutex
+}
+
+func (c *testWSConn) send(msg gqlws.Message) {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	_ = c.WriteJSON(msg)
+}
+
+func newTestWSServer(subprotocols ...string) *testWSServer {
+	s := &testWSServer{
+		subprotocols: subprotocols,
+		received:     make(chan gqlws.ResponseMessage, 1024),
+		conns:        make(chan *testWSConn, 1024),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+func (s *testWSServer) endpoint() string {
+	return "ws" + strings.TrimPrefix(s.URL, "http")
+}
+
+func (s *testWSServer) serve(w http.ResponseWriter, r *http.Request) {
+	upgrader := websocket.Upgrader{Subprotocols: s.subprotocols}
+	wsConn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	conn := &testWSConn{Conn: wsConn}
+	s.conns <- conn
+	go func() {
+		defer conn.Close()
+		for {
+			msg := gqlws.ResponseMessage{}
+			if err := conn.ReadJSON(&msg); err != nil {
+				return
+			}
+			s.received <- msg
+			switch msg.Type {
+			case gqlws.MsgTypeConnectionInit:
+				switch {
+				case s.connectionError != nil:
+					conn.send(gqlws.Message{Type: gqlws.MsgTypeConnectionError, Payload: s.connectionError})
+				case !s.noAck:
+					conn.send(gqlws.Message{Type: gqlws.MsgTypeConnectionAck})
+				}
+			case gqlws.MsgTypeStart:
+				if s.persistedQueries && !s.persistedQuery(msg.Payload) {
+					conn.send(gqlws.Message{Type: gqlws.MsgTypeError, ID: msg.ID, Payload: json.RawMessage(`[{"message":"PersistedQueryNotFound"}]`)})
+					continue
+				}
+				conn.send(gqlws.Message{Type: gqlws.MsgTypeData, ID: msg.ID, Payload: json.RawMessage(`{"data":{"n":1}}`)})
+			case gqlws.MsgTypeSubscribe:
+				conn.send(gqlws.Message{Type: gqlws.MsgTypeNext, ID: msg.ID, Payload: json.RawMessage(`{"data":{"n":1}}`)})
+			case gqlws.MsgTypePing:
+				if !s.noPong {
+					conn.send(gqlws.Message{Type: gqlws.MsgTypePong})
+				}
+			}
+		}
+	}()
+}
+
+// persistedQuery registers query of payload and reports whether its hash is known
+func (s *testWSServer) persistedQuery(payload json.RawMessage) bool {
+	req := testAPQRequest{}
+	_ = json.Unmarshal(payload, &req)
+	s.hashesMutex.Lock()
+	defer s.hashesMutex.Unlock()
+	if s.hashes == nil {
+		s.hashes = map[string]bool{}
+	}
+	if req.Query != "" {
+		s.hashes[sha256Hash(req.Query)] = true
+	}
+	return s.hashes[req.Extensions.PersistedQuery.Sha256Hash]
+}
+
+// expect waits for a message of typ received by server
+func (s *testWSServer) expect(t *testing.T, typ string) gqlws.ResponseMessage {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case msg := <-s.received:
+			if msg.Type == typ {
+				return msg
+			}
+		case <-timeout:
+			t.Fatalf("server did not receive %s", typ)
+		}
+	}
+}
+
+func recvData(t *testing.T, data <-chan json.RawMessage) json.RawMessage {
+	t.Helper()
+	select {
+	case d := <-data:
+		return d
+	case <-time.After(5 * time.Second):
+		t.Fatal("subscription data timeout")
+		return nil
+	}
+}
+
+func dataHandler(data chan<- json.RawMessage) SubscriptionHandler {
+	return func(rawMsg json.RawMessage, gqlErrs GraphQLErrors, completed bool) error {
+		if rawMsg != nil {
+			data <- rawMsg
+		}
+		return nil
+	}
+}
+
+func TestWSClientSubscribe(t *testing.T) {
+	for _, tc := range []struct {
+		subprotocol string
+		stop        string
+	}{
+		{gqlws.ProtocolGraphQLWS, gqlws.MsgTypeStop},
+		{gqlws.ProtocolGraphQLTransportWS, gqlws.MsgTypeComplete},
+	} {
+		t.Run(tc.subprotocol, func(t *testing.T) {
+			as := assert.New(t)
+			server := newTestWSServer(tc.subprotocol)
+			defer server.Close()
+			client := NewWSClient(server.endpoint())
+			defer client.Close()
+
+			data := make(chan json.RawMessage, 1)
+			id, err := client.Subscribe(Request{Query: "subscription{n}"}, dataHandler(data))
+			require.NoError(t, err)
+			as.Equal(tc.subprotocol, client.Subprotocol())
+			as.Equal(gqlws.StatusOpen, client.Status())
+			as.JSONEq(`{"n":1}`, string(recvData(t, data)))
+
+			as.NoError(client.Unsubscribe(id))
+			as.Equal(id, server.expect(t, tc.stop).ID)
+		})
+	}
+}
+
+func TestWSClientResubscribe(t *testing.T) {
+	as := assert.New(t)
+	server := newTestWSServer(gqlws.ProtocolGraphQLTransportWS)
+	defer server.Close()
+	client := NewWSClient(server.endpoint())
+	defer client.Close()
+
+	data := make(chan json.RawMessage, 1)
+	id, err := client.Subscribe(Request{Query: "subscription{n}"}, dataHandler(data))
+	require.NoError(t, err)
+	recvData(t, data)
+	as.Equal(id, server.expect(t, gqlws.MsgTypeSubscribe).ID)
+
+	conn := <-server.conns
+	_ = conn.Close()
+	recvData(t, data)
+	as.Equal(id, server.expect(t, gqlws.MsgTypeSubscribe).ID)
+}
+
+func TestWSClientConnectionError(t *testing.T) {
+	as := assert.New(t)
+	server := newTestWSServer(gqlws.ProtocolGraphQLWS)
+	server.connectionError = map[string]string{"message": "unauthorized"}
+	defer server.Close()
+	callbackErr := make(chan error, 1)
+	client := NewWSClient(server.endpoint(), WSOption{
+		OnConnectionError: func(err error) {
+			callbackErr <- err
+		},
+	})
+	defer client.Close()
+
+	_, err := client.Subscribe(Request{Query: "subscription{n}"}, nil)
+	connErr := &ConnectionError{}
+	require.True(t, errors.As(err, &connErr))
+	as.JSONEq(`{"message":"unauthorized"}`, string(connErr.Payload))
+	as.Equal(err, <-callbackErr)
+	as.Eventually(func() bool {
+		return client.Status() == gqlws.StatusInitial
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestWSClientAckTimeout(t *testing.T) {
+	server := newTestWSServer(gqlws.ProtocolGraphQLWS)
+	server.noAck = true
+	defer server.Close()
+	client := NewWSClient(server.endpoint(), WSOption{AckTimeout: 50 * time.Millisecond})
+	defer client.Close()
+
+	_, err := client.Subscribe(Request{Query: "subscription{n}"}, nil)
+	assert.Equal(t, ErrConnectionAckTimeout, err)
+}
+
+func TestWSClientSubscribeContext(t *testing.T) {
+	as := assert.New(t)
+	server := newTestWSServer(gqlws.ProtocolGraphQLWS)
+	defer server.Close()
+	client := NewWSClient(server.endpoint())
+	defer client.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	data := make(chan json.RawMessage, 1)
+	id, err := client.SubscribeContext(ctx, Request{Query: "subscription{n}"}, dataHandler(data))
+	require.NoError(t, err)
+	recvData(t, data)
+	cancel()
+	as.Equal(id, server.expect(t, gqlws.MsgTypeStop).ID)
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	_, err = client.SubscribeContext(ctx, Request{Query: "subscription{n}"}, nil)
+	as.Equal(context.Canceled, err)
+}
+
+func TestWSClientSubscribeChan(t *testing.T) {
+	as := assert.New(t)
+	server := newTestWSServer(gqlws.ProtocolGraphQLWS)
+	defer server.Close()
+	client := NewWSClient(server.endpoint())
+
+	sub, err := client.SubscribeChan(Request{Query: "subscription{n}"})
+	require.NoError(t, err)
+	ev := <-sub.Events()
+	as.JSONEq(`{"n":1}`, string(ev.Data))
+	as.Nil(sub.Err())
+
+	conn := <-server.conns
+	conn.send(gqlws.Message{Type: gqlws.MsgTypeComplete, ID: sub.ID()})
+	ev = <-sub.Events()
+	as.True(ev.Completed)
+	<-sub.Done()
+	as.Equal(ErrSubscriptionCompleted, sub.Err())
+
+	sub, err = client.SubscribeChan(Request{Query: "subscription{n}"})
+	require.NoError(t, err)
+	<-sub.Events()
+	as.NoError(client.Close())
+	<-sub.Done()
+	as.Equal(errWSClientClosed, sub.Err())
+	as.Equal(gqlws.StatusClosed, client.Status())
+
+	_, err = client.Subscribe(Request{Query: "subscription{n}"}, nil)
+	as.Equal(errWSClientClosed, err)
+}
+
+func TestWSClientSubscribeChanSlowReceiver(t *testing.T) {
+	as := assert.New(t)
+	server := newTestWSServer(gqlws.ProtocolGraphQLWS)
+	defer server.Close()
+	client := NewWSClient(server.endpoint())
+	defer client.Close()
+
+	slow, err := client.SubscribeChan(Request{Query: "subscription{n}"})
+	require.NoError(t, err)
+	server.expect(t, gqlws.MsgTypeStart)
+	conn := <-server.conns
+	// with the first data replied by server, queue is full
+	for i := 1; i < subscriptionBufferSize; i++ {
+		conn.send(gqlws.Message{Type: gqlws.MsgTypeData, ID: slow.ID(), Payload: json.RawMessage(`{"data":{"n":2}}`)})
+	}
+
+	// events of slow are waiting, but other subscriptions still receive theirs
+	data := make(chan json.RawMessage, 1)
+	_, err = client.Subscribe(Request{Query: "subscription{n}"}, dataHandler(data))
+	require.NoError(t, err)
+	as.JSONEq(`{"n":1}`, string(recvData(t, data)))
+	select {
+	case <-slow.Done():
+		as.Fail("subscription ended before overflow")
+	default:
+	}
+
+	// more events overflow slow, even if one of them is taken from queue and waiting to be received
+	for i := 0; i < 2; i++ {
+		conn.send(gqlws.Message{Type: gqlws.MsgTypeData, ID: slow.ID(), Payload: json.RawMessage(`{"data":{"n":3}}`)})
+	}
+	select {
+	case <-slow.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("subscription not ended by overflow")
+	}
+	as.Equal(ErrSubscriptionOverflow, slow.Err())
+	as.Equal(slow.ID(), server.expect(t, gqlws.MsgTypeStop).ID)
+}
+
+func TestWSClientConcurrency(t *testing.T) {
+	server := newTestWSServer(gqlws.ProtocolGraphQLWS, gqlws.ProtocolGraphQLTransportWS)
+	defer server.Close()
+	client := NewWSClient(server.endpoint())
+	defer client.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			data := make(chan json.RawMessage, 1)
+			id, err := client.Subscribe(Request{Query: "subscription{n}"}, dataHandler(data))
+			if !assert.NoError(t, err) {
+				return
+			}
+			recvData(t, data)
+			_ = client.UnderlyingConn()
+			_ = client.Subprotocol()
+			// stop message may fail on the connection closed by server
+			if i%2 == 0 {
+				_ = client.Unsubscribe(id)
+			}
+		}(i)
+	}
+	go func() {
+		conn := <-server.conns
+		time.Sleep(10 * time.Millisecond)
+		_ = conn.Close()
+	}()
+	wg.Wait()
+	_ = client.UnsubscribeAll()
+}
+
+func TestWSClientLifecycle(t *testing.T) {
+	server := newTestWSServer(gqlws.ProtocolGraphQLWS)
+	events := make(chan string, 16)
+	client := NewWSClient(server.endpoint(), WSOption{
+		ReconnectAttempts: 1,
+		OnConnected: func() {
+			events <- "connected"
+		},
+		OnAck: func() {
+			events <- "ack"
+		},
+		OnDisconnected: func(err error) {
+			events <- "disconnected"
+		},
+		OnReconnecting: func(attempt uint32) {
+			events <- fmt.Sprint("reconnecting ", attempt)
+		},
+		OnGiveUp: func() {
+			events <- "give up"
+		},
+	})
+
+	sub, err := client.SubscribeChan(Request{Query: "subscription{n}"})
+	require.NoError(t, err)
+	<-sub.Events()
+	conn := <-server.conns
+	_ = conn.Close()
+	<-sub.Events()
+	server.Close()
+	conn = <-server.conns
+	_ = conn.Close()
+	<-sub.Done()
+
+	var got []string
+	for len(got) < 9 {
+		select {
+		case ev := <-events:
+			got = append(got, ev)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("lifecycle events: %v", got)
+		}
+	}
+	assert.Equal(t, []string{
+		"connected", "ack", "disconnected",
+		"reconnecting 1", "connected", "ack", "disconnected",
+		"reconnecting 1", "give up",
+	}, got)
+}
+
+func TestWSClientConnectionParams(t *testing.T) {
+	as := assert.New(t)
+	server := newTestWSServer(gqlws.ProtocolGraphQLTransportWS)
+	defer server.Close()
+	var token int64
+	client := NewWSClient(server.endpoint(), WSOption{
+		ConnectionParams: func(ctx context.Context) (interface{}, error) {
+			return map[string]string{
+				"Authorization": fmt.Sprint("Bearer ", atomic.AddInt64(&token, 1)),
+			}, nil
+		},
+	})
+	defer client.Close()
+
+	data := make(chan json.RawMessage, 1)
+	_, err := client.Subscribe(Request{Query: "subscription{n}"}, dataHandler(data))
+	require.NoError(t, err)
+	as.JSONEq(`{"Authorization":"Bearer 1"}`, string(server.expect(t, gqlws.MsgTypeConnectionInit).Payload))
+	recvData(t, data)
+
+	conn := <-server.conns
+	_ = conn.Close()
+	as.JSONEq(`{"Authorization":"Bearer 2"}`, string(server.expect(t, gqlws.MsgTypeConnectionInit).Payload))
+	recvData(t, data)
+}
+
+func TestWSClientSubscribeContextSharedDial(t *testing.T) {
+	as := assert.New(t)
+	server := newTestWSServer(gqlws.ProtocolGraphQLWS)
+	defer server.Close()
+	called := make(chan struct{}, 1)
+	release := make(chan struct{})
+	client := NewWSClient(server.endpoint(), WSOption{
+		ConnectionParams: func(ctx context.Context) (interface{}, error) {
+			called <- struct{}{}
+			select {
+			case <-release:
+				return nil, nil
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		},
+	})
+	defer client.Close()
+
+	// the first subscriber triggers dialing and gives up
+	ctx, cancel := context.WithCancel(context.Background())
+	firstErr := make(chan error, 1)
+	go func() {
+		_, err := client.SubscribeContext(ctx, Request{Query: "subscription{n}"}, nil)
+		firstErr <- err
+	}()
+	<-called
+	secondErr := make(chan error, 1)
+	data := make(chan json.RawMessage, 1)
+	go func() {
+		_, err := client.Subscribe(Request{Query: "subscription{n}"}, dataHandler(data))
+		secondErr <- err
+	}()
+	cancel()
+	as.Equal(context.Canceled, <-firstErr)
+
+	close(release)
+	require.NoError(t, <-secondErr)
+	as.JSONEq(`{"n":1}`, string(recvData(t, data)))
+}
+
+func TestWSClientSubscribeChanContext(t *testing.T) {
+	server := newTestWSServer(gqlws.ProtocolGraphQLWS)
+	defer server.Close()
+	client := NewWSClient(server.endpoint())
+	defer client.Close()
+
+	for i := 0; i < 20; i++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		sub, err := client.SubscribeChanContext(ctx, Request{Query: "subscription{n}"})
+		require.NoError(t, err)
+		<-sub.Events()
+		cancel()
+		<-sub.Done()
+		assert.Equal(t, context.Canceled, sub.Err())
+		assert.Equal(t, sub.ID(), server.expect(t, gqlws.MsgTypeStop).ID)
+	}
+}
+
+// newKeepAliveClient subscribes with KeepAliveTimeout of 100ms, and returns the connection of server and disconnected errors
+func newKeepAliveClient(t *testing.T, server *testWSServer) (*WSClient, *testWSConn, <-chan error) {
+	disconnected := make(chan error, 1)
+	client := NewWSClient(server.endpoint(), WSOption{
+		KeepAliveTimeout: 100 * time.Millisecond,
+		OnDisconnected: func(err error) {
+			disconnected <- err
+		},
+	})
+	client.minKeepAliveTimeout = 0
+	_, err := client.Subscribe(Request{Query: "subscription{n}"}, nil)
+	require.NoError(t, err)
+	return client, <-server.conns, disconnected
+}
+
+func TestWSClientKeepAliveTimeout(t *testing.T) {
+	t.Run("silent after ka", func(t *testing.T) {
+		server := newTestWSServer(gqlws.ProtocolGraphQLWS)
+		defer server.Close()
+		client, conn, disconnected := newKeepAliveClient(t, server)
+		defer client.Close()
+
+		conn.send(gqlws.Message{Type: gqlws.MsgTypeConnectionKeepAlive})
+		select {
+		case err := <-disconnected:
+			assert.Equal(t, ErrKeepAliveTimeout, err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("connection is not closed by keepalive timeout")
+		}
+	})
+	t.Run("silent after connection_ack", func(t *testing.T) {
+		server := newTestWSServer(gqlws.ProtocolGraphQLTransportWS)
+		server.noPong = true
+		defer server.Close()
+		client, _, disconnected := newKeepAliveClient(t, server)
+		defer client.Close()
+
+		server.expect(t, gqlws.MsgTypePing)
+		select {
+		case err := <-disconnected:
+			assert.Equal(t, ErrKeepAliveTimeout, err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("connection is not closed by keepalive timeout")
+		}
+	})
+	t.Run("silent after websocket ping", func(t *testing.T) {
+		server := newTestWSServer(gqlws.ProtocolGraphQLTransportWS)
+		server.noPong = true
+		defer server.Close()
+		client, conn, disconnected := newKeepAliveClient(t, server)
+		defer client.Close()
+
+		for i := 0; i < 8; i++ {
+			conn.writeMutex.Lock()
+			_ = conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(time.Second))
+			conn.writeMutex.Unlock()
+			time.Sleep(30 * time.Millisecond)
+		}
+		select {
+		case err := <-disconnected:
+			t.Fatalf("disconnected by %v while server pinging", err)
+		default:
+		}
+		select {
+		case err := <-disconnected:
+			assert.Equal(t, ErrKeepAliveTimeout, err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("connection is not closed by keepalive timeout")
+		}
+	})
+}
+
+func TestWSClientKeepAliveData(t *testing.T) {
+	t.Run("data after ka", func(t *testing.T) {
+		server := newTestWSServer(gqlws.ProtocolGraphQLWS)
+		defer server.Close()
+		client, conn, disconnected := newKeepAliveClient(t, server)
+		defer client.Close()
+
+		conn.send(gqlws.Message{Type: gqlws.MsgTypeConnectionKeepAlive})
+		for i := 0; i < 10; i++ {
+			time.Sleep(30 * time.Millisecond)
+			conn.send(gqlws.Message{Type: gqlws.MsgTypeData, ID: "1", Payload: json.RawMessage(`{"data":{"n":1}}`)})
+		}
+		select {
+		case err := <-disconnected:
+			t.Fatalf("disconnected by %v while data flowing", err)
+		default:
+		}
+	})
+	t.Run("pong of client ping", func(t *testing.T) {
+		server := newTestWSServer(gqlws.ProtocolGraphQLTransportWS)
+		defer server.Close()
+		client, _, disconnected := newKeepAliveClient(t, server)
+		defer client.Close()
+
+		select {
+		case err := <-disconnected:
+			t.Fatalf("disconnected by %v while server replying pong", err)
+		case <-time.After(300 * time.Millisecond):
+		}
+		server.expect(t, gqlws.MsgTypePing)
+	})
+	t.Run("server without keepalive", func(t *testing.T) {
+		server := newTestWSServer(gqlws.ProtocolGraphQLWS)
+		defer server.Close()
+		client, _, disconnected := newKeepAliveClient(t, server)
+		defer client.Close()
+
+		select {
+		case err := <-disconnected:
+			t.Fatalf("disconnected by %v without keepalive", err)
+		case <-time.After(300 * time.Millisecond):
+		}
+	})
+}
+
+func TestWSClientPingPong(t *testing.T) {
+	as := assert.New(t)
+	server := newTestWSServer(gqlws.ProtocolGraphQLTransportWS)
+	defer server.Close()
+	disconnected := make(chan error, 1)
+	client := NewWSClient(server.endpoint(), WSOption{
+		KeepAliveTimeout: 200 * time.Millisecond,
+		OnDisconnected: func(err error) {
+			disconnected <- err
+		},
+	})
+	client.minKeepAliveTimeout = 0
+	defer client.Close()
+
+	_, err := client.Subscribe(Request{Query: "subscription{n}"}, nil)
+	require.NoError(t, err)
+	conn := <-server.conns
+	for i := 0; i < 6; i++ {
+		conn.send(gqlws.Message{Type: gqlws.MsgTypePing, Payload: map[string]int{"i": i}})
+		as.JSONEq(fmt.Sprintf(`{"i":%d}`, i), string(server.expect(t, gqlws.MsgTypePong).Payload))
+		time.Sleep(50 * time.Millisecond)
+	}
+	select {
+	case err := <-disconnected:
+		t.Fatalf("disconnected by %v while server pinging", err)
+	default:
+	}
+}
+
+func TestWSClientProtocolNegotiation(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		server   []string
+		protocol string
+		expected string
+	}{
+		{"server preference", []string{gqlws.ProtocolGraphQLTransportWS, gqlws.ProtocolGraphQLWS}, "", gqlws.ProtocolGraphQLTransportWS},
+		{"client option", []string{gqlws.ProtocolGraphQLWS, gqlws.ProtocolGraphQLTransportWS}, gqlws.ProtocolGraphQLTransportWS, gqlws.ProtocolGraphQLTransportWS},
+		{"server without subprotocol", nil, "", gqlws.ProtocolGraphQLWS},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			server := newTestWSServer(tc.server...)
+			defer server.Close()
+			client := NewWSClient(server.endpoint(), WSOption{Protocol: tc.protocol})
+			defer client.Close()
+
+			data := make(chan json.RawMessage, 1)
+			_, err := client.Subscribe(Request{Query: "subscription{n}"}, dataHandler(data))
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, client.Subprotocol())
+			assert.JSONEq(t, `{"n":1}`, string(recvData(t, data)))
+		})
+	}
+
+	client := NewWSClient("ws://127.0.0.1:1", WSOption{Protocol: "graphql-unknown"})
+	defer client.Close()
+	_, err := client.Subscribe(Request{Query: "subscription{n}"}, nil)
+	assert.EqualError(t, err, "unsupported websocket subprotocol: graphql-unknown")
+}
+
+func TestWSClientSubprotocolHandshake(t *testing.T) {
+	as := assert.New(t)
+	offered := make(chan []string, 1)
+	selected := ""
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		offered <- websocket.Subprotocols(r)
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, http.Header{"Sec-Websocket-Protocol": {selected}})
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_, _, _ = conn.ReadMessage()
+		_ = conn.WriteJSON(gqlws.Message{Type: gqlws.MsgTypeConnectionAck})
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	defer server.Close()
+	endpoint := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	// both subprotocols are offered by default, or only the one of option
+	for _, tc := range []struct {
+		protocol string
+		offered  []string
+	}{
+		{"", []string{gqlws.ProtocolGraphQLWS, gqlws.ProtocolGraphQLTransportWS}},
+		{gqlws.ProtocolGraphQLTransportWS, []string{gqlws.ProtocolGraphQLTransportWS}},
+	} {
+		selected = tc.offered[0]
+		client := NewWSClient(endpoint, WSOption{Protocol: tc.protocol})
+		_, err := client.Subscribe(Request{Query: "subscription{n}"}, nil)
+		as.NoError(err)
+		as.Equal(tc.offered, <-offered)
+		_ = client.Close()
+	}
+
+	// the subprotocol selected by server must be supported
+	selected = "graphql-unknown"
+	client := NewWSClient(endpoint, WSOption{NotReconnect: true})
+	defer client.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := client.SubscribeContext(ctx, Request{Query: "subscription{n}"}, nil)
+	as.EqualError(err, "server selected unsupported websocket subprotocol: graphql-unknown")
+}
+
+func TestWSClientReconnectCallback(t *testing.T) {
+	as := assert.New(t)
+	server := newTestWSServer(gqlws.ProtocolGraphQLWS)
+	defer server.Close()
+	reconnecting := make(chan uint32, 1)
+	client := NewWSClient(server.endpoint(), WSOption{
+		OnReconnecting: func(attempt uint32) {
+			reconnecting <- attempt
+		},
+	})
+	defer client.Close()
+
+	data := make(chan json.RawMessage, 1)
+	id1, err := client.Subscribe(Request{Query: "subscription{n}"}, dataHandler(data))
+	require.NoError(t, err)
+	recvData(t, data)
+	id2, err := client.Subscribe(Request{Query: "subscription{m}"}, nil)
+	require.NoError(t, err)
+	as.NoError(client.Unsubscribe(id2))
+	as.Equal(id2, server.expect(t, gqlws.MsgTypeStop).ID)
+
+	conn := <-server.conns
+	_ = conn.Close()
+	select {
+	case attempt := <-reconnecting:
+		as.Equal(uint32(1), attempt)
+	case <-time.After(5 * time.Second):
+		t.Fatal("OnReconnecting is not called")
+	}
+	// only the active subscription is started again, with the same id
+	start := server.expect(t, gqlws.MsgTypeStart)
+	as.Equal(id1, start.ID)
+	recvData(t, data)
+	select {
+	case msg := <-server.received:
+		t.Fatalf("unexpected message %s %s", msg.Type, msg.ID)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	id3, err := client.Subscribe(Request{Query: "subscription{n}"}, nil)
+	require.NoError(t, err)
+	as.NotContains([]string{id1, id2}, id3)
+}
+
+func TestWSClientSubscribeContextAckDeadline(t *testing.T) {
+	server := newTestWSServer(gqlws.ProtocolGraphQLWS)
+	server.noAck = true
+	defer server.Close()
+	client := NewWSClient(server.endpoint())
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := client.SubscribeContext(ctx, Request{Query: "subscription{n}"}, nil)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.True(t, time.Since(start) < time.Second)
+	server.expect(t, gqlws.MsgTypeConnectionInit)
+}
+
+func TestWSClientStartAfterAck(t *testing.T) {
+	as := assert.New(t)
+	server := newTestWSServer(gqlws.ProtocolGraphQLWS)
+	server.noAck = true
+	defer server.Close()
+	client := NewWSClient(server.endpoint())
+	defer client.Close()
+
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := client.Subscribe(Request{Query: "subscription{n}"}, nil)
+			errs <- err
+		}()
+	}
+	server.expect(t, gqlws.MsgTypeConnectionInit)
+	conn := <-server.conns
+	select {
+	case msg := <-server.received:
+		t.Fatalf("%s received before connection_ack", msg.Type)
+	case err := <-errs:
+		t.Fatalf("subscribed before connection_ack: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	conn.send(gqlws.Message{Type: gqlws.MsgTypeConnectionAck})
+	as.NoError(<-errs)
+	as.NoError(<-errs)
+	server.expect(t, gqlws.MsgTypeStart)
+	server.expect(t, gqlws.MsgTypeStart)
+}
+
+func TestWSClientConnectionErrorWaiters(t *testing.T) {
+	server := newTestWSServer(gqlws.ProtocolGraphQLWS)
+	server.connectionError = "forbidden"
+	defer server.Close()
+	client := NewWSClient(server.endpoint())
+	defer client.Close()
+
+	errs := make(chan error, 3)
+	for i := 0; i < 3; i++ {
+		go func() {
+			_, err := client.Subscribe(Request{Query: "subscription{n}"}, nil)
+			errs <- err
+		}()
+	}
+	for i := 0; i < 3; i++ {
+		connErr := &ConnectionError{}
+		require.True(t, errors.As(<-errs, &connErr))
+		assert.JSONEq(t, `"forbidden"`, string(connErr.Payload))
+	}
+	assert.Never(t, func() bool {
+		select {
+		case msg := <-server.received:
+			return msg.Type == gqlws.MsgTypeStart
+		default:
+			return false
+		}
+	}, 50*time.Millisecond, 10*time.Millisecond)
+}
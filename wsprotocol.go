@@ -0,0 +1,180 @@
+package gqlgo
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+	"github.com/poohvpn/gqlgo/gqlws"
+)
+
+type wsEventType int
+
+const (
+	wsEventUnknown wsEventType = iota
+	wsEventConnectionAck
+	wsEventConnectionError
+	wsEventKeepAlive
+	wsEventPing
+	wsEventData
+	wsEventError
+	wsEventComplete
+)
+
+// wsEvent is a server message translated to protocol independent form
+type wsEvent struct {
+	typ     wsEventType
+	id      string
+	payload json.RawMessage
+}
+
+// wsProtocol translates between WSClient and the message set of a websocket subprotocol
+type wsProtocol interface {
+	subprotocol() string
+	startMessage(id string, req Request) *gqlws.Message
+	stopMessage(id string) *gqlws.Message
+	// pingMessage and pongMessage return nil when protocol has no ping pong
+	pingMessage() *gqlws.Message
+	pongMessage(payload json.RawMessage) *gqlws.Message
+	event(msg *gqlws.ResponseMessage) wsEvent
+	errors(payload json.RawMessage) GraphQLErrors
+}
+
+var wsProtocols = map[string]wsProtocol{
+	gqlws.ProtocolGraphQLWS:          graphQLWS{},
+	gqlws.ProtocolGraphQLTransportWS: graphQLTransportWS{},
+}
+
+func subscribePayload(req Request) *gqlws.SubscribePayload {
+	return &gqlws.SubscribePayload{
+		Query:         req.Query,
+		Variables:     req.Variables,
+		OperationName: req.OperationName,
+		Extensions:    req.Extensions,
+	}
+}
+
+// graphQLWS implements apollographql/subscriptions-transport-ws
+type graphQLWS struct{}
+
+func (graphQLWS) subprotocol() string {
+	return gqlws.ProtocolGraphQLWS
+}
+
+func (graphQLWS) startMessage(id string, req Request) *gqlws.Message {
+	return &gqlws.Message{Type: gqlws.MsgTypeStart, ID: id, Payload: subscribePayload(req)}
+}
+
+func (graphQLWS) stopMessage(id string) *gqlws.Message {
+	return &gqlws.Message{Type: gqlws.MsgTypeStop, ID: id}
+}
+
+func (graphQLWS) pingMessage() *gqlws.Message {
+	return nil
+}
+
+func (graphQLWS) pongMessage(json.RawMessage) *gqlws.Message {
+	return nil
+}
+
+func (graphQLWS) event(msg *gqlws.ResponseMessage) wsEvent {
+	ev := wsEvent{id: msg.ID, payload: msg.Payload}
+	switch msg.Type {
+	case gqlws.MsgTypeConnectionAck:
+		ev.typ = wsEventConnectionAck
+	case gqlws.MsgTypeConnectionError:
+		ev.typ = wsEventConnectionError
+	case gqlws.MsgTypeConnectionKeepAlive:
+		ev.typ = wsEventKeepAlive
+	case gqlws.MsgTypeData:
+		ev.typ = wsEventData
+	case gqlws.MsgTypeError:
+		ev.typ = wsEventError
+	case gqlws.MsgTypeComplete:
+		ev.typ = wsEventComplete
+	}
+	return ev
+}
+
+// subscriptions-transport-ws servers send either a single error object or a list of errors
+func (graphQLWS) errors(payload json.RawMessage) GraphQLErrors {
+	var errs GraphQLErrors
+	if err := json.Unmarshal(payload, &errs); err == nil && len(errs) > 0 {
+		return errs
+	}
+	var gqlErr GraphQLError
+	if err := json.Unmarshal(payload, &gqlErr); err == nil && gqlErr.Message != "" {
+		return GraphQLErrors{gqlErr}
+	}
+	return GraphQLErrors{{Message: string(payload)}}
+}
+
+// graphQLTransportWS implements enisdenjo/graphql-ws
+type graphQLTransportWS struct{}
+
+func (graphQLTransportWS) subprotocol() string {
+	return gqlws.ProtocolGraphQLTransportWS
+}
+
+func (graphQLTransportWS) startMessage(id string, req Request) *gqlws.Message {
+	return &gqlws.Message{Type: gqlws.MsgTypeSubscribe, ID: id, Payload: subscribePayload(req)}
+}
+
+func (graphQLTransportWS) stopMessage(id string) *gqlws.Message {
+	return &gqlws.Message{Type: gqlws.MsgTypeComplete, ID: id}
+}
+
+func (graphQLTransportWS) pingMessage() *gqlws.Message {
+	return &gqlws.Message{Type: gqlws.MsgTypePing}
+}
+
+func (graphQLTransportWS) pongMessage(payload json.RawMessage) *gqlws.Message {
+	msg := &gqlws.Message{Type: gqlws.MsgTypePong}
+	if len(payload) > 0 {
+		msg.Payload = payload
+	}
+	return msg
+}
+
+func (graphQLTransportWS) event(msg *gqlws.ResponseMessage) wsEvent {
+	ev := wsEvent{id: msg.ID, payload: msg.Payload}
+	switch msg.Type {
+	case gqlws.MsgTypeConnectionAck:
+		ev.typ = wsEventConnectionAck
+	case gqlws.MsgTypePing:
+		ev.typ = wsEventPing
+	case gqlws.MsgTypePong:
+		ev.typ = wsEventKeepAlive
+	case gqlws.MsgTypeNext:
+		ev.typ = wsEventData
+	case gqlws.MsgTypeError:
+		ev.typ = wsEventError
+	case gqlws.MsgTypeComplete:
+		ev.typ = wsEventComplete
+	}
+	return ev
+}
+
+func (graphQLTransportWS) errors(payload json.RawMessage) GraphQLErrors {
+	var errs GraphQLErrors
+	if err := json.Unmarshal(payload, &errs); err != nil || len(errs) == 0 {
+		return GraphQLErrors{{Message: string(payload)}}
+	}
+	return errs
+}
+
+// executionResult splits the payload of websocket data message, or the next event of SSE and multipart subscription
+func executionResult(payload json.RawMessage) (json.RawMessage, GraphQLErrors, error) {
+	res := gqlws.ExecutionResult{}
+	if err := json.Unmarshal(payload, &res); err != nil {
+		return nil, nil, errors.Wrap(err, "json decode execution result")
+	}
+	var errs GraphQLErrors
+	if len(res.Errors) > 0 {
+		errs = graphQLTransportWS{}.errors(res.Errors)
+	}
+	// nil rawMsg is reserved for error message
+	if res.Data == nil {
+		res.Data = json.RawMessage("null")
+	}
+	return res.Data, errs, nil
+}
@@ -0,0 +1,84 @@
+package gqlgo
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/poohvpn/gqlgo/gqlws"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWSProtocolMessages(t *testing.T) {
+	as := assert.New(t)
+	req := Request{Query: "subscription{n}"}
+
+	ws := wsProtocols[gqlws.ProtocolGraphQLWS]
+	as.Equal(gqlws.ProtocolGraphQLWS, ws.subprotocol())
+	as.Equal(&gqlws.Message{Type: gqlws.MsgTypeStart, ID: "1", Payload: subscribePayload(req)}, ws.startMessage("1", req))
+	as.Equal(&gqlws.Message{Type: gqlws.MsgTypeStop, ID: "1"}, ws.stopMessage("1"))
+	as.Nil(ws.pingMessage())
+	as.Nil(ws.pongMessage(nil))
+
+	transportWS := wsProtocols[gqlws.ProtocolGraphQLTransportWS]
+	as.Equal(gqlws.ProtocolGraphQLTransportWS, transportWS.subprotocol())
+	as.Equal(&gqlws.Message{Type: gqlws.MsgTypeSubscribe, ID: "1", Payload: subscribePayload(req)}, transportWS.startMessage("1", req))
+	as.Equal(&gqlws.Message{Type: gqlws.MsgTypeComplete, ID: "1"}, transportWS.stopMessage("1"))
+	as.Equal(&gqlws.Message{Type: gqlws.MsgTypePing}, transportWS.pingMessage())
+	as.Equal(&gqlws.Message{Type: gqlws.MsgTypePong}, transportWS.pongMessage(nil))
+	as.Equal(&gqlws.Message{Type: gqlws.MsgTypePong, Payload: json.RawMessage(`{"a":1}`)}, transportWS.pongMessage(json.RawMessage(`{"a":1}`)))
+}
+
+func TestWSProtocolEvents(t *testing.T) {
+	for _, tc := range []struct {
+		protocol string
+		msgType  string
+		expected wsEventType
+	}{
+		{gqlws.ProtocolGraphQLWS, gqlws.MsgTypeConnectionAck, wsEventConnectionAck},
+		{gqlws.ProtocolGraphQLWS, gqlws.MsgTypeConnectionError, wsEventConnectionError},
+		{gqlws.ProtocolGraphQLWS, gqlws.MsgTypeConnectionKeepAlive, wsEventKeepAlive},
+		{gqlws.ProtocolGraphQLWS, gqlws.MsgTypeData, wsEventData},
+		{gqlws.ProtocolGraphQLWS, gqlws.MsgTypeError, wsEventError},
+		{gqlws.ProtocolGraphQLWS, gqlws.MsgTypeComplete, wsEventComplete},
+		{gqlws.ProtocolGraphQLWS, gqlws.MsgTypeNext, wsEventUnknown},
+		{gqlws.ProtocolGraphQLTransportWS, gqlws.MsgTypeConnectionAck, wsEventConnectionAck},
+		{gqlws.ProtocolGraphQLTransportWS, gqlws.MsgTypePing, wsEventPing},
+		{gqlws.ProtocolGraphQLTransportWS, gqlws.MsgTypePong, wsEventKeepAlive},
+		{gqlws.ProtocolGraphQLTransportWS, gqlws.MsgTypeNext, wsEventData},
+		{gqlws.ProtocolGraphQLTransportWS, gqlws.MsgTypeError, wsEventError},
+		{gqlws.ProtocolGraphQLTransportWS, gqlws.MsgTypeComplete, wsEventComplete},
+		{gqlws.ProtocolGraphQLTransportWS, gqlws.MsgTypeData, wsEventUnknown},
+	} {
+		payload := json.RawMessage(`{"data":{"n":1}}`)
+		ev := wsProtocols[tc.protocol].event(&gqlws.ResponseMessage{Type: tc.msgType, ID: "1", Payload: payload})
+		assert.Equal(t, wsEvent{typ: tc.expected, id: "1", payload: payload}, ev, "%s %s", tc.protocol, tc.msgType)
+	}
+}
+
+func TestWSProtocolErrors(t *testing.T) {
+	as := assert.New(t)
+	ws := wsProtocols[gqlws.ProtocolGraphQLWS]
+	as.Equal(GraphQLErrors{{Message: "a"}, {Message: "b"}}, ws.errors(json.RawMessage(`[{"message":"a"},{"message":"b"}]`)))
+	as.Equal(GraphQLErrors{{Message: "a"}}, ws.errors(json.RawMessage(`{"message":"a"}`)))
+	as.Equal(GraphQLErrors{{Message: `"a"`}}, ws.errors(json.RawMessage(`"a"`)))
+
+	transportWS := wsProtocols[gqlws.ProtocolGraphQLTransportWS]
+	as.Equal(GraphQLErrors{{Message: "a"}}, transportWS.errors(json.RawMessage(`[{"message":"a"}]`)))
+	as.Equal(GraphQLErrors{{Message: `{"message":"a"}`}}, transportWS.errors(json.RawMessage(`{"message":"a"}`)))
+}
+
+func TestExecutionResult(t *testing.T) {
+	as := assert.New(t)
+	data, errs, err := executionResult(json.RawMessage(`{"data":{"n":1}}`))
+	as.NoError(err)
+	as.JSONEq(`{"n":1}`, string(data))
+	as.Nil(errs)
+
+	data, errs, err = executionResult(json.RawMessage(`{"errors":[{"message":"a"}]}`))
+	as.NoError(err)
+	as.Equal(json.RawMessage("null"), data, "nil data is reserved for error message")
+	as.Equal(GraphQLErrors{{Message: "a"}}, errs)
+
+	_, _, err = executionResult(json.RawMessage(`[`))
+	as.Error(err)
+}